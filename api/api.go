@@ -3,193 +3,315 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
-	"google.golang.org/appengine"
+	"golang.org/x/net/context"
 
 	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/web"
 )
 
 const (
-	APIVersion = "v1.0.0"
+	// APIVersion lists the versions of the API served, v1 below /api/ and v2 below /api/v2/.
+	APIVersion = "v1.0.0, v2.0.0"
 )
 
+// Config configures an API handler.
+type Config struct {
+	// Context derives the request context passed to the store.
+	// Defaults to the context of the request.
+	Context func(*http.Request) context.Context
+	// PageSize is the default number of posts per listing page.
+	// It is bounded by models.MaxPageSize.
+	PageSize int
+	// Moderators may see the real authors of anonymous posts.
+	Moderators models.Moderators
+	// ReportThreshold is the number of pending reports hiding a post until a moderator
+	// reviews it. Defaults to models.DefaultReportThreshold, negative values never hide posts.
+	ReportThreshold int
+	// EditWindow is the time after submitting a post during which its author may edit it.
+	// Defaults to models.DefaultEditWindow, negative values never expire.
+	EditWindow time.Duration
+}
+
 // Handler is a simple API handler.
 type Handler struct {
-	mux *http.ServeMux
-}
-
-// New initializes a new API handler bound to the given database.
-func New() *Handler {
-	mux := http.NewServeMux()
-	api := &Handler{mux}
-	mux.HandleFunc("/api/", api.status)
-	mux.HandleFunc("/api/add", api.add)
-	mux.HandleFunc("/api/list", api.list)
-	mux.HandleFunc("/api/show", api.show)
-	mux.HandleFunc("/api/vote", api.vote)
-	mux.HandleFunc("/api/karma", api.karma)
+	mux    *http.ServeMux
+	store  models.Store
+	config Config
+	// patterns lists the patterns registered on the mux in order.
+	patterns []string
+}
+
+// New initializes a new API handler bound to the given store.
+func New(store models.Store, config Config) *Handler {
+	if config.Context == nil {
+		config.Context = func(r *http.Request) context.Context { return r.Context() }
+	}
+	config.PageSize = models.Listing{Limit: config.PageSize}.PageSize()
+	if config.ReportThreshold == 0 {
+		config.ReportThreshold = models.DefaultReportThreshold
+	}
+	if config.EditWindow == 0 {
+		config.EditWindow = models.DefaultEditWindow
+	}
+	api := &Handler{mux: http.NewServeMux(), store: store, config: config}
+	api.handle("/api/", http.HandlerFunc(api.status))
+	api.handle("/api/add", api.auth(api.add, models.ScopePost, false))
+	api.handle("/api/list", api.auth(api.list, models.ScopeRead, true))
+	api.handle("/api/show", api.auth(api.show, models.ScopeRead, true))
+	api.handle("/api/vote", api.auth(api.vote, models.ScopeVote, false))
+	api.handle("/api/karma", api.auth(api.karma, models.ScopeRead, false))
+	api.handle("/api/users/", api.users())
+	api.handle("/api/c/", api.communities())
+	api.handle("/api/moderate", api.auth(api.moderate, models.ScopeModerate, false))
+	api.handle("/api/modlog", api.auth(api.modlog, models.ScopeModerate, false))
+	api.handle("/api/report", api.auth(api.report, models.ScopePost, false))
+	api.handle("/api/reports", api.auth(api.reports, models.ScopeModerate, false))
+	api.handle("/api/posts/", api.posts())
+	api.handle("/api/v2/", api.v2())
+	api.handle("/api/openapi.json", http.HandlerFunc(api.openapi))
 	return api
 }
 
+// handle registers the handler for the pattern on the mux.
+func (handler *Handler) handle(pattern string, h http.Handler) {
+	handler.mux.Handle(pattern, h)
+	handler.patterns = append(handler.patterns, pattern)
+}
+
 // ServeHTTP serves HTTP requests.
 func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler.mux.ServeHTTP(w, r)
 }
 
-// /add DATA={user, color, text, topic} -> {id}
-func (handler *Handler) add(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+// /add DATA={color, text, topic, community, anonymous} -> {id}
+// The post is submitted by the owner of the API token, which needs the post scope.
+// The author of anonymous posts is hidden from readers. Replies belong to the community of their parent.
+// Invalid text or colors are rejected with 422 naming the invalid field.
+func (handler *Handler) add(w http.ResponseWriter, r *http.Request, caller string) {
+	id, ok := handler.submitPost(w, r, caller)
+	if !ok {
+		return
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(AddResponse{ID: id}); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// submitPost submits the post described by the request body on behalf of the caller.
+// It reports whether the post has been stored, otherwise the error has been answered.
+func (handler *Handler) submitPost(w http.ResponseWriter, r *http.Request, caller string) (int64, bool) {
+	c := handler.config.Context(r)
 	decoder := json.NewDecoder(r.Body)
-	add := struct {
-		Author string `json:"user"`
-		Color  string `json:"color"`
-		Text   string `json:"text"`
-		Parent int64  `json:"topic"`
-	}{}
+	var add AddRequest
 	if err := decoder.Decode(&add); err != nil {
-		http.Error(w, "Failed to parse JSON: "+err.Error(), http.StatusBadRequest)
-		return
+		writeError(w, http.StatusBadRequest, "Failed to parse JSON: "+err.Error())
+		return 0, false
 	}
-	id, err := models.SubmitPost(c, add.Author, add.Text, add.Color, add.Parent)
+	id, err := handler.store.SubmitPost(c, caller, add.Text, add.Color, add.Community, add.Parent, add.Anonymous)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	enc := json.NewEncoder(w)
-	if err := enc.Encode(struct {
-		ID int64 `json:"id"`
-	}{
-		ID: id,
-	}); err != nil {
-		http.Error(w, "Failed to encode JSON: "+err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
+		return 0, false
 	}
+	return id, true
+}
+
+// list?sort={hot,top,best}&limit={n}&cursor={cursor}&html={bool} -> [JSONPost...]
+// The cursor of the next page is returned in the X-Next-Cursor header.
+func (handler *Handler) list(w http.ResponseWriter, r *http.Request, caller string) {
+	handler.listPosts(w, r, caller, "")
 }
 
-// list -> [JSONPost...]
-func (handler *Handler) list(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-	posts, ids, err := models.TopPosts(c, 30, -10.0)
+// listPosts serves a listing of the top-level posts of a community, or of all posts if it is empty.
+func (handler *Handler) listPosts(w http.ResponseWriter, r *http.Request, caller, community string) {
+	c := handler.config.Context(r)
+	query := r.URL.Query()
+	ranking, err := models.ParseRanking(query.Get("sort"))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	limit := handler.config.PageSize
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid limit: "+err.Error())
+			return
+		}
+	}
+	posts, ids, next, err := handler.store.TopPosts(c, models.Listing{
+		Ranking:   ranking,
+		Limit:     limit,
+		MinRank:   -10.0,
+		Cursor:    query.Get("cursor"),
+		Community: community,
+	})
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, caller, handler.config.Moderators, posts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-	jsonPosts, err := models.ToJSONComments(c, posts, ids)
+	jsonPosts, err := models.ToJSONComments(posts, ids, names)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	renderHTML(r, jsonPosts)
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(jsonPosts); err != nil {
-		http.Error(w, "Failed to encode JSON: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
 		return
 	}
 }
 
-// show DATA={id} -> {JSONPost}
-func (handler *Handler) show(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+// show?html={bool} DATA={id, depth} -> {JSONPost}
+// Comments are nested up to the given depth, comments with omitted replies are marked with more.
+// Anonymous posts are shown under pseudonyms stable within the thread.
+// The post is marked as locked if its whole thread is locked.
+func (handler *Handler) show(w http.ResponseWriter, r *http.Request, caller string) {
 	dec := json.NewDecoder(r.Body)
-	req := struct {
-		ID int64 `json:"id"`
-	}{}
+	req := ShowRequest{Depth: models.DefaultThreadDepth}
 	if err := dec.Decode(&req); err != nil {
-		http.Error(w, "Failed to decode JSON: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to decode JSON: "+err.Error())
 		return
 	}
-	post, err := models.GetPost(c, req.ID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	numVotes, err := models.NumberOfVotes(c, req.ID)
+	handler.showPost(w, r, caller, req.ID, req.Depth)
+}
+
+// showPost encodes a post with its comments nested up to the given depth.
+func (handler *Handler) showPost(w http.ResponseWriter, r *http.Request, caller string, id int64, depth int) {
+	c := handler.config.Context(r)
+	post, err := handler.store.GetPost(c, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
 	encoder := json.NewEncoder(w)
-	comments, ids, err := models.GetComments(c, req.ID)
+	rootID := post.ThreadRoot(id)
+	root := post
+	if rootID != id {
+		if root, err = handler.store.GetPost(c, rootID); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	comments, ids, err := handler.store.GetThread(c, rootID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-	jsonComments, err := models.ToJSONComments(c, comments, ids)
+	names, err := models.LoadNames(c, handler.store, caller, handler.config.Moderators, append(comments, post))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-	if err := encoder.Encode(struct {
-		ID       int64             `json:"id"`
-		Author   string            `json:"user"`
-		Text     string            `json:"text"`
-		Votes    int               `json:"votes"`
-		Date     int64             `json:"timestamp"`
-		Color    string            `json:"color"`
-		Comments []models.JSONPost `json:"comments"`
-	}{
-		Color:    post.Color,
-		ID:       req.ID,
-		Author:   post.Author,
-		Text:     post.Text,
-		Votes:    numVotes,
-		Date:     post.Date.Unix(),
-		Comments: jsonComments,
+	names.Pseudonyms = models.Pseudonyms(rootID, root, comments, ids)
+	thread := models.BuildThread(id, post, comments, ids, depth)
+	jsonComments := models.ToJSONThread(thread, names)
+	renderHTML(r, jsonComments)
+	var textHTML string
+	if wantsHTML(r) {
+		textHTML = string(web.RenderText(names.Text(post)))
+	}
+	if err := encoder.Encode(ShowResponse{
+		Color:      post.Color,
+		ID:         id,
+		Author:     names.Author(id, post),
+		Text:       names.Text(post),
+		Votes:      post.Score(),
+		Date:       post.Date.Unix(),
+		Community:  post.Community,
+		Anonymous:  post.Anonymous,
+		RealAuthor: names.RealAuthor(post),
+		Removed:    post.Removed,
+		Locked:     root.Locked,
+		Pinned:     post.Pinned,
+		Hidden:     post.Hidden,
+		Edited:     post.Revisions > 0,
+		Deleted:    post.Deleted,
+		TextHTML:   textHTML,
+		Comments:   jsonComments,
 	}); err != nil {
-		http.Error(w, "Failed to encode JSON: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
 	}
 }
 
-// /vote DATA={post, user, upvote} -> {votes}
-func (handler *Handler) vote(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
+// /vote DATA={post, upvote} -> {votes, upvoted, downvoted}
+// Voting the same way twice retracts the vote, voting the opposite way flips it.
+// The vote is cast by the owner of the API token, which needs the vote scope.
+func (handler *Handler) vote(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
 	dec := json.NewDecoder(r.Body)
-	req := struct {
-		Post   int64  `json:"post"`
-		Author string `json:"user"`
-		Upvote bool   `json:"upvote"`
-	}{}
+	var req VoteRequest
 	if err := dec.Decode(&req); err != nil {
-		http.Error(w, "Failed to decode JSON: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to decode JSON: "+err.Error())
 		return
 	}
-	_, err := models.SubmitVote(c, req.Author, req.Post, req.Upvote)
+	voted, err := handler.store.SubmitVote(c, caller, req.Post, req.Upvote)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
-	numVotes, err := models.NumberOfVotes(c, req.Post)
+	handler.encodeVote(w, r, req.Post, voted, req.Upvote, http.StatusOK)
+}
+
+// encodeVote encodes the score of a post and the caller's vote on it, if they voted,
+// with the given status, which is only sent once the score has been loaded.
+func (handler *Handler) encodeVote(w http.ResponseWriter, r *http.Request, id int64, voted, upvote bool, status int) {
+	numVotes, err := handler.store.NumberOfVotes(handler.config.Context(r), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, err)
 		return
 	}
+	w.WriteHeader(status)
 	enc := json.NewEncoder(w)
-	if err := enc.Encode(struct {
-		Votes int `json:"votes"`
-	}{
-		Votes: numVotes,
+	if err := enc.Encode(VoteResponse{
+		Votes:     numVotes,
+		Upvoted:   voted && upvote,
+		Downvoted: voted && !upvote,
 	}); err != nil {
-		http.Error(w, "Failed to encode JSON: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
 	}
 }
 
-// /karma DATA={user} -> {karma}
-func (handler *Handler) karma(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-	dec := json.NewDecoder(r.Body)
-	req := struct {
-		User string `json:"user"`
-	}{}
-	if err := dec.Decode(&req); err != nil {
-		http.Error(w, "Failed to decode JSON: "+err.Error(), http.StatusBadRequest)
+// /karma -> {karma}
+// Returns the karma of the owner of the API token, which needs the read scope.
+func (handler *Handler) karma(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	karma, err := handler.store.GetKarma(c, caller)
+	if err != nil {
+		storeError(w, err)
 		return
 	}
-	karma := models.GetKarma(c, req.User)
 	enc := json.NewEncoder(w)
-	if err := enc.Encode(struct {
-		Karma int `json:"karma"`
-	}{
-		Karma: karma,
-	}); err != nil {
-		http.Error(w, "Failed to encode JSON: "+err.Error(), http.StatusInternalServerError)
+	if err := enc.Encode(KarmaResponse{Karma: karma}); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// wantsHTML reports if the client requested the rendered text of posts with ?html=true.
+func wantsHTML(r *http.Request) bool {
+	html, _ := strconv.ParseBool(r.URL.Query().Get("html"))
+	return html
+}
+
+// renderHTML sets the rendered text of the posts and their replies if the client requested it.
+func renderHTML(r *http.Request, posts []models.JSONPost) {
+	if !wantsHTML(r) {
+		return
+	}
+	for i := range posts {
+		posts[i].TextHTML = string(web.RenderText(posts[i].Text))
+		renderHTML(r, posts[i].Replies)
 	}
 }
 
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/models/memory"
+)
+
+// testAPI serves the API on a memory store for the tests.
+type testAPI struct {
+	t       *testing.T
+	store   *memory.Store
+	handler *Handler
+}
+
+func newTestAPI(t *testing.T, config Config) *testAPI {
+	store := memory.New()
+	return &testAPI{t, store, New(store, config)}
+}
+
+// user creates a user with an API token granting the scopes and returns the user and the token secret.
+func (api *testAPI) user(login string, scopes ...string) (models.User, string) {
+	c := context.Background()
+	user, err := api.store.EnsureUser(c, login)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	token, secret, err := models.NewToken(user.ID, "test", scopes)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	if err := api.store.CreateToken(c, token); err != nil {
+		api.t.Fatal(err)
+	}
+	return user, secret
+}
+
+// do sends a request with the body encoded as JSON, if not nil, and the token, if not empty.
+func (api *testAPI) do(method, path, secret string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			api.t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &buf)
+	if secret != "" {
+		r.Header.Set("Authorization", "Bearer "+secret)
+	}
+	w := httptest.NewRecorder()
+	api.handler.ServeHTTP(w, r)
+	return w
+}
+
+// post submits a post via /add and returns its ID.
+func (api *testAPI) post(secret string, req AddRequest) int64 {
+	w := api.do(http.MethodPost, "/api/add", secret, req)
+	if w.Code != http.StatusOK {
+		api.t.Fatalf("add: got %d %s", w.Code, w.Body)
+	}
+	var resp AddResponse
+	decode(api.t, w, &resp)
+	return resp.ID
+}
+
+// decode decodes the JSON body of a response.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("could not decode %q: %v", w.Body, err)
+	}
+}
+
+// expectError verifies the status and the code of an error response.
+func expectError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) Error {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d: %s", w.Code, status, w.Body)
+	}
+	var resp Error
+	decode(t, w, &resp)
+	if resp.Code != code {
+		t.Errorf("got code %q, want %q", resp.Code, code)
+	}
+	return resp
+}
+
+func TestListPagination(t *testing.T) {
+	api := newTestAPI(t, Config{})
+	_, secret := api.user("alice", models.ScopePost)
+	for i := 0; i < 5; i++ {
+		api.post(secret, AddRequest{Color: "blue", Text: "post " + strconv.Itoa(i)})
+	}
+	seen := map[int64]bool{}
+	path := "/api/list?sort=top&limit=2"
+	for _, want := range []int{2, 2, 1} {
+		w := api.do(http.MethodGet, path, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: got %d %s", w.Code, w.Body)
+		}
+		cursor := w.Header().Get("X-Next-Cursor")
+		var posts []models.JSONPost
+		decode(t, w, &posts)
+		if len(posts) != want {
+			t.Fatalf("got %d posts, want %d", len(posts), want)
+		}
+		for _, post := range posts {
+			if seen[post.ID] {
+				t.Errorf("post %d listed twice", post.ID)
+			}
+			seen[post.ID] = true
+		}
+		if (cursor == "") != (want == 1) {
+			t.Fatalf("got cursor %q on page of %d posts", cursor, want)
+		}
+		path = "/api/list?sort=top&limit=2&cursor=" + cursor
+	}
+	resp := expectError(t, api.do(http.MethodGet, "/api/list?cursor=invalid", "", nil), http.StatusUnprocessableEntity, CodeInvalidInput)
+	if resp.Field != "cursor" {
+		t.Errorf("got field %q, want cursor", resp.Field)
+	}
+	resp = expectError(t, api.do(http.MethodGet, "/api/list?sort=new", "", nil), http.StatusUnprocessableEntity, CodeInvalidInput)
+	if resp.Field != "sort" {
+		t.Errorf("got field %q, want sort", resp.Field)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	api := newTestAPI(t, Config{})
+	_, reader := api.user("alice", models.ScopeRead)
+	post := AddRequest{Color: "blue", Text: "hello"}
+	expectError(t, api.do(http.MethodPost, "/api/add", "", post), http.StatusUnauthorized, CodeUnauthorized)
+	expectError(t, api.do(http.MethodPost, "/api/add", "zwig_invalid", post), http.StatusUnauthorized, CodeUnauthorized)
+	expectError(t, api.do(http.MethodPost, "/api/add", reader, post), http.StatusForbidden, CodeForbidden)
+	expectError(t, api.do(http.MethodGet, "/api/modlog", reader, nil), http.StatusForbidden, CodeForbidden)
+	if w := api.do(http.MethodGet, "/api/list", "", nil); w.Code != http.StatusOK {
+		t.Errorf("list without token: got %d %s", w.Code, w.Body)
+	}
+	if w := api.do(http.MethodGet, "/api/karma", reader, nil); w.Code != http.StatusOK {
+		t.Errorf("karma: got %d %s", w.Code, w.Body)
+	}
+}
+
+// failingStore fails to look up posts with an internal error.
+type failingStore struct {
+	*memory.Store
+}
+
+func (store failingStore) GetPost(c context.Context, id int64) (models.Post, error) {
+	return models.Post{}, errors.New("GetPost: could not connect to 10.0.0.1")
+}
+
+func TestErrorStatuses(t *testing.T) {
+	api := newTestAPI(t, Config{})
+	_, secret := api.user("alice", models.ScopePost, models.ScopeRead, models.ScopeVote)
+	_, bob := api.user("bob", models.ScopePost)
+	id := api.post(secret, AddRequest{Color: "blue", Text: "hello"})
+	path := "/api/posts/" + strconv.FormatInt(id, 10)
+	if w := api.do(http.MethodDelete, path, secret, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		name    string
+		w       *httptest.ResponseRecorder
+		status  int
+		code    string
+		message string
+		field   string
+	}{
+		{"missing post", api.do(http.MethodPost, "/api/show", "", ShowRequest{ID: 42}),
+			http.StatusNotFound, CodeNotFound, "not found", ""},
+		{"vote on missing post", api.do(http.MethodPost, "/api/vote", secret, VoteRequest{Post: 42, Upvote: true}),
+			http.StatusNotFound, CodeNotFound, "not found", ""},
+		{"missing user", api.do(http.MethodGet, "/api/users/nobody", "", nil),
+			http.StatusNotFound, CodeNotFound, "not found", ""},
+		{"missing community", api.do(http.MethodGet, "/api/c/nothing/list", "", nil),
+			http.StatusNotFound, CodeNotFound, "not found", ""},
+		{"invalid color", api.do(http.MethodPost, "/api/add", secret, AddRequest{Color: "purple", Text: "hello"}),
+			http.StatusUnprocessableEntity, CodeInvalidInput, "color must be one of blue, red, orange, green", "color"},
+		{"empty text", api.do(http.MethodPost, "/api/add", secret, AddRequest{Color: "blue", Text: " "}),
+			http.StatusUnprocessableEntity, CodeInvalidInput, "text must not be empty", "text"},
+		{"edit by other user", api.do(http.MethodPut, path, bob, EditRequest{Text: "hijacked"}),
+			http.StatusForbidden, CodeForbidden, "forbidden", ""},
+		{"edit of deleted post", api.do(http.MethodPut, path, secret, EditRequest{Text: "again"}),
+			http.StatusConflict, CodeLocked, "locked", ""},
+		{"internal error", func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			New(failingStore{api.store}, Config{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/show", strings.NewReader(`{"id": 1}`)))
+			return w
+		}(), http.StatusInternalServerError, CodeInternal, "internal error", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := expectError(t, test.w, test.status, test.code)
+			if resp.Message != test.message || resp.Field != test.field {
+				t.Errorf("got message %q for field %q, want %q for %q", resp.Message, resp.Field, test.message, test.field)
+			}
+		})
+	}
+	expectError(t, api.do(http.MethodPost, "/api/add", secret, "not an object"), http.StatusBadRequest, CodeBadRequest)
+}
+
+func TestEditAndDelete(t *testing.T) {
+	api := newTestAPI(t, Config{EditWindow: time.Hour})
+	_, alice := api.user("alice", models.ScopePost, models.ScopeRead)
+	_, bob := api.user("bob", models.ScopePost)
+	id := api.post(alice, AddRequest{Color: "blue", Text: "hello"})
+	path := "/api/posts/" + strconv.FormatInt(id, 10)
+	expectError(t, api.do(http.MethodPut, path, bob, EditRequest{Text: "hijacked"}), http.StatusForbidden, CodeForbidden)
+	expectError(t, api.do(http.MethodDelete, path, bob, nil), http.StatusForbidden, CodeForbidden)
+	w := api.do(http.MethodPut, path, alice, EditRequest{Text: "edited"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit: got %d %s", w.Code, w.Body)
+	}
+	var post models.JSONPost
+	decode(t, w, &post)
+	if post.Text != "edited" || !post.Edited {
+		t.Errorf("got %+v, want edited text", post)
+	}
+	w = api.do(http.MethodGet, path+"/revisions", alice, nil)
+	var revisions []models.JSONRevision
+	decode(t, w, &revisions)
+	if len(revisions) != 1 {
+		t.Errorf("got %d revisions, want 1", len(revisions))
+	}
+	if w := api.do(http.MethodPatch, path, alice, nil); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "DELETE, PUT" {
+		t.Errorf("patch: got %d with Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+	if w := api.do(http.MethodDelete, path, alice, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d %s", w.Code, w.Body)
+	}
+	expectError(t, api.do(http.MethodPut, path, alice, EditRequest{Text: "again"}), http.StatusConflict, CodeLocked)
+}
+
+func TestEditWindow(t *testing.T) {
+	api := newTestAPI(t, Config{EditWindow: time.Nanosecond})
+	_, alice := api.user("alice", models.ScopePost)
+	id := api.post(alice, AddRequest{Color: "blue", Text: "hello"})
+	time.Sleep(time.Millisecond)
+	path := "/api/posts/" + strconv.FormatInt(id, 10)
+	expectError(t, api.do(http.MethodPut, path, alice, EditRequest{Text: "late"}), http.StatusConflict, CodeLocked)
+}
+
+func TestLockedThread(t *testing.T) {
+	api := newTestAPI(t, Config{Moderators: models.Moderators{"mod"}})
+	_, alice := api.user("alice", models.ScopePost, models.ScopeVote)
+	_, mod := api.user("mod", models.ScopeModerate)
+	id := api.post(alice, AddRequest{Color: "blue", Text: "hello"})
+	expectError(t, api.do(http.MethodPost, "/api/moderate", alice, ModerateRequest{Post: id, Action: models.ActionLock}), http.StatusForbidden, CodeForbidden)
+	w := api.do(http.MethodPost, "/api/moderate", mod, ModerateRequest{Post: id, Action: models.ActionLock, Reason: "heated"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("moderate: got %d %s", w.Code, w.Body)
+	}
+	expectError(t, api.do(http.MethodPost, "/api/vote", alice, VoteRequest{Post: id, Upvote: true}), http.StatusConflict, CodeLocked)
+	expectError(t, api.do(http.MethodPost, "/api/add", alice, AddRequest{Color: "blue", Text: "reply", Parent: id}), http.StatusConflict, CodeLocked)
+	path := "/api/v2/posts/" + strconv.FormatInt(id, 10) + "/votes"
+	expectError(t, api.do(http.MethodPost, path, alice, CastVoteRequest{Upvote: true}), http.StatusConflict, CodeLocked)
+}
+
+func TestRestrictedCommunity(t *testing.T) {
+	api := newTestAPI(t, Config{})
+	owner, secret := api.user("alice", models.ScopePost)
+	_, bob := api.user("bob", models.ScopePost)
+	community, err := models.NewCommunity("news", "News", "", owner.ID, models.VisibilityRestricted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.store.CreateCommunity(context.Background(), community); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, api.do(http.MethodPost, "/api/add", bob, AddRequest{Color: "blue", Text: "hello", Community: "news"}), http.StatusForbidden, CodeForbidden)
+	api.post(secret, AddRequest{Color: "blue", Text: "hello", Community: "news"})
+	w := api.do(http.MethodGet, "/api/c/news/list", "", nil)
+	var posts []models.JSONPost
+	decode(t, w, &posts)
+	if len(posts) != 1 || posts[0].Community != "news" {
+		t.Errorf("got %+v, want the post of the community", posts)
+	}
+}
+
+func TestV2(t *testing.T) {
+	api := newTestAPI(t, Config{})
+	user, secret := api.user("alice", models.ScopePost, models.ScopeRead, models.ScopeVote)
+	w := api.do(http.MethodPost, "/api/v2/posts", secret, AddRequest{Color: "blue", Text: "hello"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d %s", w.Code, w.Body)
+	}
+	var post models.JSONPost
+	decode(t, w, &post)
+	path := "/api/v2/posts/" + strconv.FormatInt(post.ID, 10)
+	if location := w.Header().Get("Location"); location != path {
+		t.Errorf("got location %q, want %q", location, path)
+	}
+	if w := api.do(http.MethodGet, path, "", nil); w.Code != http.StatusOK {
+		t.Errorf("get: got %d %s", w.Code, w.Body)
+	}
+	expectError(t, api.do(http.MethodDelete, path, secret, nil), http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+	expectError(t, api.do(http.MethodGet, "/api/v2/posts/abc", "", nil), http.StatusNotFound, CodeNotFound)
+	expectError(t, api.do(http.MethodPost, "/api/v2/posts/42/votes", secret, CastVoteRequest{Upvote: true}), http.StatusNotFound, CodeNotFound)
+	for _, step := range []struct {
+		upvote bool
+		status int
+		votes  int
+	}{
+		{true, http.StatusCreated, 1},
+		{false, http.StatusOK, -1},
+	} {
+		w := api.do(http.MethodPost, path+"/votes", secret, CastVoteRequest{Upvote: step.upvote})
+		if w.Code != step.status {
+			t.Fatalf("vote %v: got %d, want %d: %s", step.upvote, w.Code, step.status, w.Body)
+		}
+		var vote VoteResponse
+		decode(t, w, &vote)
+		if vote.Votes != step.votes || vote.Upvoted != step.upvote || vote.Downvoted == step.upvote {
+			t.Errorf("vote %v: got %+v", step.upvote, vote)
+		}
+	}
+	expectError(t, api.do(http.MethodPost, path+"/votes", secret, CastVoteRequest{Upvote: false}), http.StatusConflict, CodeAlreadyVoted)
+	w = api.do(http.MethodGet, "/api/v2/users/"+user.Handle+"/karma", "", nil)
+	var karma UserKarmaResponse
+	decode(t, w, &karma)
+	if karma.Handle != user.Handle || karma.Karma != -1 {
+		t.Errorf("got %+v, want karma -1", karma)
+	}
+}
+
+func TestReport(t *testing.T) {
+	api := newTestAPI(t, Config{ReportThreshold: 1, Moderators: models.Moderators{"mod"}})
+	_, alice := api.user("alice", models.ScopePost)
+	_, mod := api.user("mod", models.ScopeModerate)
+	id := api.post(alice, AddRequest{Color: "blue", Text: "hello"})
+	w := api.do(http.MethodPost, "/api/report", alice, ReportRequest{Post: id, Reason: "spam"})
+	var report ReportResponse
+	decode(t, w, &report)
+	if report.Post != id || !report.Hidden {
+		t.Errorf("got %+v, want hidden post", report)
+	}
+	w = api.do(http.MethodGet, "/api/reports", mod, nil)
+	var queue []ReportedPost
+	decode(t, w, &queue)
+	if len(queue) != 1 || queue[0].Post.ID != id || len(queue[0].Reports) != 1 {
+		t.Errorf("got %+v, want the reported post", queue)
+	}
+}
+
+func TestShowThread(t *testing.T) {
+	api := newTestAPI(t, Config{})
+	_, secret := api.user("alice", models.ScopePost)
+	root := api.post(secret, AddRequest{Color: "blue", Text: "root"})
+	first := api.post(secret, AddRequest{Color: "blue", Text: "first", Parent: root})
+	second := api.post(secret, AddRequest{Color: "blue", Text: "second", Parent: first})
+	third := api.post(secret, AddRequest{Color: "blue", Text: "third", Parent: second})
+	sibling := api.post(secret, AddRequest{Color: "blue", Text: "sibling", Parent: root})
+
+	w := api.do(http.MethodPost, "/api/show", "", ShowRequest{ID: root, Depth: 2})
+	var show ShowResponse
+	decode(t, w, &show)
+	if show.ID != root || len(show.Comments) != 2 {
+		t.Fatalf("got %+v, want the root with two replies", show)
+	}
+	if show.Comments[0].ID != first || show.Comments[1].ID != sibling {
+		t.Errorf("got replies %d and %d, want %d and %d", show.Comments[0].ID, show.Comments[1].ID, first, sibling)
+	}
+	nested := show.Comments[0].Replies
+	if len(nested) != 1 || nested[0].ID != second || !nested[0].More || len(nested[0].Replies) != 0 {
+		t.Errorf("got %+v, want the second reply with omitted replies", nested)
+	}
+	if show.Comments[1].More || len(show.Comments[1].Replies) != 0 {
+		t.Errorf("got %+v, want a reply without replies", show.Comments[1])
+	}
+
+	// comments are shown with their own replies below them
+	w = api.do(http.MethodPost, "/api/show", "", ShowRequest{ID: second})
+	show = ShowResponse{}
+	decode(t, w, &show)
+	if show.ID != second || len(show.Comments) != 1 || show.Comments[0].ID != third {
+		t.Errorf("got %+v, want the second reply with the third below it", show)
+	}
+}
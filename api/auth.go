@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// callerHandleFunc handles a request on behalf of the user owning the request's API token.
+type callerHandleFunc func(http.ResponseWriter, *http.Request, string)
+
+// tokenMiddleware resolves the caller from an "Authorization: Bearer" header
+// and rejects requests whose token has not been granted the required scope.
+// Optional requests without a token are handled on behalf of an empty caller.
+type tokenMiddleware struct {
+	handler  callerHandleFunc
+	store    models.TokenStore
+	context  func(*http.Request) context.Context
+	scope    string
+	optional bool
+}
+
+func (auth tokenMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	secret := bearerToken(r)
+	if secret == "" && auth.optional {
+		auth.handler(w, r, "")
+		return
+	} else if secret == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="zwig"`)
+		writeError(w, http.StatusUnauthorized, "Missing API token")
+		return
+	}
+	token, err := auth.store.GetToken(auth.context(r), models.HashToken(secret))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="zwig", error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "Invalid API token")
+		return
+	}
+	if !token.Allows(auth.scope) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="zwig", error="insufficient_scope", scope="`+auth.scope+`"`)
+		writeError(w, http.StatusForbidden, "API token lacks scope "+auth.scope)
+		return
+	}
+	auth.handler(w, r, token.Owner)
+}
+
+// bearerToken extracts the token secret from the Authorization header.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+func (handler *Handler) auth(f callerHandleFunc, scope string, optional bool) *tokenMiddleware {
+	return &tokenMiddleware{
+		handler:  f,
+		store:    handler.store,
+		context:  handler.config.Context,
+		scope:    scope,
+		optional: optional,
+	}
+}
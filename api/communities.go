@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// communities routes the requests below /c/ by path:
+// /c/ -> [JSONCommunity...]
+// /c/{slug} -> {JSONCommunity}
+// /c/{slug}/list?sort={hot,top,best}&limit={n}&cursor={cursor}&html={bool} -> [JSONPost...]
+// The directory only contains listed communities, unlisted ones can still be looked up by slug.
+func (handler *Handler) communities() *router {
+	return &router{prefix: "/api/c/", resources: []resource{
+		{Path: "", Route: func(params []string) http.Handler {
+			return handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.directory(w, r)
+			}, models.ScopeRead, true)
+		}},
+		{Path: "{slug}", Route: func(params []string) http.Handler {
+			slug := params[0]
+			return handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.community(w, r, caller, slug, false)
+			}, models.ScopeRead, true)
+		}},
+		{Path: "{slug}/list", Route: func(params []string) http.Handler {
+			slug := params[0]
+			return handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.community(w, r, caller, slug, true)
+			}, models.ScopeRead, true)
+		}},
+	}}
+}
+
+// community serves a community or, if list is set, the listing of its top-level posts.
+func (handler *Handler) community(w http.ResponseWriter, r *http.Request, caller, slug string, list bool) {
+	c := handler.config.Context(r)
+	community, err := handler.store.GetCommunity(c, slug)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if list {
+		handler.listPosts(w, r, caller, community.Slug)
+		return
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(models.ToJSONCommunity(community)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// directory serves the directory of listed communities ordered by slug.
+func (handler *Handler) directory(w http.ResponseWriter, r *http.Request) {
+	c := handler.config.Context(r)
+	communities, err := handler.store.Communities(c)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	listed := make([]models.JSONCommunity, 0, len(communities))
+	for _, community := range communities {
+		if community.Listed() {
+			listed = append(listed, models.ToJSONCommunity(community))
+		}
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(listed); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
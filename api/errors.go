@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// Codes identifying the kind of error in error responses.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeAlreadyVoted     = "already_voted"
+	CodeLocked           = "locked"
+	CodeInvalidInput     = "invalid_input"
+	CodeInternal         = "internal_error"
+)
+
+// statusCodes maps HTTP status codes to the code of errors reported with them.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeBadRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	http.StatusConflict:            CodeAlreadyVoted,
+	http.StatusUnprocessableEntity: CodeInvalidInput,
+}
+
+// Error is the JSON envelope of all error responses.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Field names the invalid field of the request for invalid_input errors.
+	Field string `json:"field,omitempty"`
+}
+
+// writeError answers the request with the status and an error envelope.
+func writeError(w http.ResponseWriter, status int, message string) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+	}
+	encodeError(w, status, Error{Code: code, Message: message})
+}
+
+// storeError answers the request with the status matching an error returned by the store
+// or the models: 403 for forbidden changes, 404 for missing entities, 409 for repeated votes
+// and locked posts and 422 for invalid input. Other errors are internal errors, which are
+// logged instead of being sent to the client. Only the messages of invalid fields are sent.
+func storeError(w http.ResponseWriter, err error) {
+	var invalid models.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		messages := make([]string, len(invalid))
+		for i, field := range invalid {
+			messages[i] = field.Message
+		}
+		encodeError(w, http.StatusUnprocessableEntity, Error{
+			Code:    CodeInvalidInput,
+			Message: strings.Join(messages, "; "),
+			Field:   invalid[0].Field,
+		})
+	case errors.Is(err, models.ErrInvalidInput):
+		writeError(w, http.StatusUnprocessableEntity, "invalid input")
+	case errors.Is(err, models.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, models.ErrAlreadyVoted):
+		writeError(w, http.StatusConflict, "already voted")
+	case errors.Is(err, models.ErrForbidden):
+		writeError(w, http.StatusForbidden, "forbidden")
+	case errors.Is(err, models.ErrLocked):
+		encodeError(w, http.StatusConflict, Error{Code: CodeLocked, Message: "locked"})
+	default:
+		log.Printf("api: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func encodeError(w http.ResponseWriter, status int, envelope Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(envelope); err != nil {
+		log.Printf("api: could not encode error: %v\n", err)
+	}
+}
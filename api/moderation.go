@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// /moderate DATA={post, action, reason} -> {JSONPost}
+// Applies one of the actions remove, restore, lock, unlock, pin, unpin and approve to the post.
+// The owner of the API token needs the moderate scope and has to be a moderator or an
+// owner of the community of the post. Locks are applied to the whole thread.
+func (handler *Handler) moderate(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	dec := json.NewDecoder(r.Body)
+	var req ModerateRequest
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to decode JSON: "+err.Error())
+		return
+	}
+	post, err := handler.store.GetPost(c, req.Post)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if ok, err := models.CanModerate(c, handler.store, handler.config.Moderators, caller, post); err != nil {
+		storeError(w, err)
+		return
+	} else if !ok {
+		writeError(w, http.StatusForbidden, "Only moderators can moderate this post")
+		return
+	}
+	action, err := models.NewModAction(caller, req.Action, req.Post, req.Reason)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if err := handler.store.Moderate(c, action); err != nil {
+		storeError(w, err)
+		return
+	}
+	handler.encodePost(w, r, caller, req.Post, http.StatusOK)
+}
+
+// /modlog?limit={n}&cursor={cursor} -> [JSONModAction...]
+// Returns the moderation audit log newest first, the cursor of the next page is returned
+// in the X-Next-Cursor header. Only available to moderators with the moderate scope.
+func (handler *Handler) modlog(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	user, err := handler.store.GetUser(c, caller)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if !handler.config.Moderators.Includes(user) {
+		writeError(w, http.StatusForbidden, "Only moderators can view the moderation log")
+		return
+	}
+	query := r.URL.Query()
+	limit := handler.config.PageSize
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid limit: "+err.Error())
+			return
+		}
+	}
+	actions, next, err := handler.store.ModerationLog(c, models.ModLog{
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+	})
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	moderators := make([]string, len(actions))
+	for i, action := range actions {
+		moderators[i] = action.Moderator
+	}
+	users, err := handler.store.GetUsers(c, moderators)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(models.ToJSONModActions(actions, users)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// parameter is a query or path parameter of an operation.
+type parameter struct {
+	Name string
+	// In is either query or path.
+	In          string
+	Type        string
+	Description string
+}
+
+// operation describes an endpoint of the API in the OpenAPI document.
+type operation struct {
+	Method  string
+	Path    string
+	Summary string
+	// Scope is the token scope needed, the token may be omitted if Optional is set.
+	Scope    string
+	Optional bool
+	Params   []parameter
+	// Request and Response are values of the types of the bodies, nil if there is none.
+	Request  interface{}
+	Response interface{}
+	Status   int
+	// Others are further success statuses answered with the same response body.
+	Others []int
+}
+
+// query parameters shared by the listings of posts
+var listParams = []parameter{
+	{Name: "sort", In: "query", Type: "string", Description: "Ranking of the posts, one of hot, top or best"},
+	{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of posts"},
+	{Name: "cursor", In: "query", Type: "string", Description: "Cursor of the page, returned in the X-Next-Cursor header"},
+	{Name: "html", In: "query", Type: "boolean", Description: "Include the rendered text of the posts in text_html"},
+}
+
+// query parameters of the other paginated listings
+var pageParams = []parameter{listParams[1], listParams[2]}
+
+// path parameter naming a post
+var idParam = parameter{Name: "id", In: "path", Type: "integer"}
+
+// operations lists the endpoints described by the OpenAPI document. Their bodies are described
+// by the types used by the handlers, so that the document follows changes to the handlers.
+var operations = []operation{
+	{Method: http.MethodPost, Path: "/api/add", Summary: "Submit a post", Scope: models.ScopePost,
+		Request: AddRequest{}, Response: AddResponse{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/list", Summary: "List top-level posts", Scope: models.ScopeRead, Optional: true,
+		Params: listParams, Response: []models.JSONPost{}, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/api/show", Summary: "Show a post with its comments", Scope: models.ScopeRead, Optional: true,
+		Params: listParams[3:], Request: ShowRequest{}, Response: ShowResponse{}, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/api/vote", Summary: "Toggle a vote on a post", Scope: models.ScopeVote,
+		Request: VoteRequest{}, Response: VoteResponse{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/karma", Summary: "Karma of the caller", Scope: models.ScopeRead,
+		Response: KarmaResponse{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/users/{handle}", Summary: "Profile of a user with a page of their posts or comments", Scope: models.ScopeRead, Optional: true,
+		Params: append([]parameter{
+			{Name: "handle", In: "path", Type: "string"},
+			{Name: "kind", In: "query", Type: "string", Description: "Items to list, either posts or comments"},
+		}, listParams[1:]...), Response: UserResponse{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/c/", Summary: "Directory of listed communities", Scope: models.ScopeRead, Optional: true,
+		Response: []models.JSONCommunity{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/c/{slug}", Summary: "Show a community", Scope: models.ScopeRead, Optional: true,
+		Params:   []parameter{{Name: "slug", In: "path", Type: "string"}},
+		Response: models.JSONCommunity{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/c/{slug}/list", Summary: "List top-level posts of a community", Scope: models.ScopeRead, Optional: true,
+		Params:   append([]parameter{{Name: "slug", In: "path", Type: "string"}}, listParams...),
+		Response: []models.JSONPost{}, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/api/moderate", Summary: "Apply a moderation action to a post", Scope: models.ScopeModerate,
+		Request: ModerateRequest{}, Response: models.JSONPost{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/modlog", Summary: "Moderation log, newest first", Scope: models.ScopeModerate,
+		Params: pageParams, Response: []models.JSONModAction{}, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/api/report", Summary: "Report a post to the moderators", Scope: models.ScopePost,
+		Request: ReportRequest{}, Response: ReportResponse{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/reports", Summary: "Posts with pending reports", Scope: models.ScopeModerate,
+		Params: pageParams, Response: []ReportedPost{}, Status: http.StatusOK},
+	{Method: http.MethodPut, Path: "/api/posts/{id}", Summary: "Edit the text of an own post", Scope: models.ScopePost,
+		Params: []parameter{idParam}, Request: EditRequest{}, Response: models.JSONPost{}, Status: http.StatusOK},
+	{Method: http.MethodDelete, Path: "/api/posts/{id}", Summary: "Delete an own post", Scope: models.ScopePost,
+		Params: []parameter{idParam}, Response: models.JSONPost{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/posts/{id}/revisions", Summary: "Previous versions of the text of a post", Scope: models.ScopeRead, Optional: true,
+		Params: []parameter{idParam}, Response: []models.JSONRevision{}, Status: http.StatusOK},
+	{Method: http.MethodGet, Path: "/api/v2/posts", Summary: "List top-level posts", Scope: models.ScopeRead, Optional: true,
+		Params: listParams, Response: []models.JSONPost{}, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/api/v2/posts", Summary: "Submit a post", Scope: models.ScopePost,
+		Request: AddRequest{}, Response: models.JSONPost{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/v2/posts/{id}", Summary: "Show a post with its comments", Scope: models.ScopeRead, Optional: true,
+		Params: []parameter{
+			idParam,
+			{Name: "depth", In: "query", Type: "integer", Description: "Maximum nesting of the comments"},
+			listParams[3],
+		}, Response: ShowResponse{}, Status: http.StatusOK},
+	{Method: http.MethodPost, Path: "/api/v2/posts/{id}/votes", Summary: "Cast a vote on a post", Scope: models.ScopeVote,
+		Params:  []parameter{idParam},
+		Request: CastVoteRequest{}, Response: VoteResponse{}, Status: http.StatusCreated, Others: []int{http.StatusOK}},
+	{Method: http.MethodGet, Path: "/api/v2/users/{handle}/karma", Summary: "Karma of a user", Scope: models.ScopeRead, Optional: true,
+		Params:   []parameter{{Name: "handle", In: "path", Type: "string"}},
+		Response: UserKarmaResponse{}, Status: http.StatusOK},
+}
+
+// /openapi.json -> {OpenAPI document}
+// Describes the operations of the API, the schemas are generated from the request and response types.
+func (handler *Handler) openapi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(openAPIDocument(operations)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// openAPIDocument generates an OpenAPI 3 document describing the operations.
+func openAPIDocument(ops []operation) map[string]interface{} {
+	components := schemas{}
+	errorSchema := components.of(reflect.TypeOf(Error{}))
+	paths := map[string]map[string]interface{}{}
+	for _, op := range ops {
+		responses := map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     jsonContent(errorSchema),
+			},
+		}
+		for _, status := range append([]int{op.Status}, op.Others...) {
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     jsonContent(components.of(reflect.TypeOf(op.Response))),
+			}
+		}
+		item := map[string]interface{}{
+			"summary":   op.Summary,
+			"responses": responses,
+		}
+		if op.Scope != "" {
+			item["description"] = "Requires an API token with the " + op.Scope + " scope."
+			security := []interface{}{map[string][]string{"token": {}}}
+			if op.Optional {
+				item["description"] = "Accepts an API token with the " + op.Scope + " scope."
+				security = append(security, map[string][]string{})
+			}
+			item["security"] = security
+		}
+		if len(op.Params) > 0 {
+			params := make([]interface{}, len(op.Params))
+			for i, param := range op.Params {
+				spec := map[string]interface{}{
+					"name":     param.Name,
+					"in":       param.In,
+					"required": param.In == "path",
+					"schema":   map[string]interface{}{"type": param.Type},
+				}
+				if param.Description != "" {
+					spec["description"] = param.Description
+				}
+				params[i] = spec
+			}
+			item["parameters"] = params
+		}
+		if op.Request != nil {
+			item["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(components.of(reflect.TypeOf(op.Request))),
+			}
+		}
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = item
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Zwig API",
+			"version": APIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// jsonContent describes the content of a JSON body with the given schema.
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// schemas collects the JSON schemas of named struct types by name.
+type schemas map[string]interface{}
+
+// of returns the JSON schema of values of the type as encoded by encoding/json.
+// Named struct types are referenced and added to the collected schemas.
+func (components schemas) of(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return components.of(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": components.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": components.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return components.object(t)
+		}
+		if _, ok := components[t.Name()]; !ok {
+			// register the name first to terminate on recursive types
+			components[t.Name()] = nil
+			components[t.Name()] = components.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the JSON schema of a struct type. Fields without omitempty are required.
+func (components schemas) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if field.PkgPath != "" || tag[0] == "-" {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = components.of(field.Type)
+		omitempty := false
+		for _, option := range tag[1:] {
+			omitempty = omitempty || option == "omitempty"
+		}
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lnsp/zwig/models/memory"
+)
+
+// TestOpenAPIDocumentsRoutes walks the routes of the API and fails for routes and
+// methods missing from the OpenAPI document.
+func TestOpenAPIDocumentsRoutes(t *testing.T) {
+	handler := New(memory.New(), Config{})
+	paths := openAPIDocument(operations)["paths"].(map[string]map[string]interface{})
+	// the version and the document itself are not described
+	undocumented := map[string]bool{"/api/": true, "/api/v2/": true, "/api/openapi.json": true}
+	for _, pattern := range handler.patterns {
+		h, _ := handler.mux.Handler(httptest.NewRequest(http.MethodGet, pattern, nil))
+		routes, ok := h.(*router)
+		if !ok {
+			if !undocumented[pattern] && paths[pattern] == nil {
+				t.Errorf("%s is missing from the OpenAPI document", pattern)
+			}
+			continue
+		}
+		for _, res := range routes.resources {
+			path := routes.prefix + res.Path
+			if undocumented[path] {
+				continue
+			}
+			ops := paths[path]
+			if ops == nil {
+				t.Errorf("%s is missing from the OpenAPI document", path)
+				continue
+			}
+			params := make([]string, strings.Count(res.Path, "{"))
+			for i := range params {
+				params[i] = "1"
+			}
+			m, ok := res.Route(params).(methods)
+			if !ok {
+				continue
+			}
+			for method := range m {
+				if ops[strings.ToLower(method)] == nil {
+					t.Errorf("%s %s is missing from the OpenAPI document", method, path)
+				}
+			}
+		}
+	}
+}
+
+// TestOpenAPIDocumentsOperations verifies that every documented operation is routed.
+func TestOpenAPIDocumentsOperations(t *testing.T) {
+	handler := New(memory.New(), Config{})
+	for _, op := range operations {
+		path := strings.NewReplacer("{id}", "1", "{handle}", "nobody", "{slug}", "none").Replace(op.Path)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(op.Method, path, strings.NewReader("{}")))
+		if w.Code == http.StatusMethodNotAllowed {
+			t.Errorf("%s %s is not routed: %d %s", op.Method, op.Path, w.Code, w.Body)
+		}
+		if w.Code == http.StatusOK && w.Body.String() == APIVersion {
+			t.Errorf("%s %s is not routed, the version was served", op.Method, op.Path)
+		}
+	}
+}
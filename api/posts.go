@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/web"
+)
+
+// posts routes the requests below /posts/ by method:
+// PUT /posts/{id} DATA={text} -> {JSONPost}
+// DELETE /posts/{id} -> {JSONPost}
+// GET /posts/{id}/revisions -> [JSONRevision...]
+// Editing and deleting is restricted to the author of the post, whose API token needs the post scope.
+func (handler *Handler) posts() *router {
+	return &router{prefix: "/api/posts/", resources: []resource{
+		{Path: "{id}", Route: func(params []string) http.Handler {
+			return methods{
+				http.MethodPut:    handler.auth(handler.edit, models.ScopePost, false),
+				http.MethodDelete: handler.auth(handler.delete, models.ScopePost, false),
+			}
+		}},
+		{Path: "{id}/revisions", Route: func(params []string) http.Handler {
+			return methods{http.MethodGet: handler.auth(handler.revisions, models.ScopeRead, true)}
+		}},
+	}}
+}
+
+// edit replaces the text of the caller's own post within the edit window.
+func (handler *Handler) edit(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	id, err := postID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dec := json.NewDecoder(r.Body)
+	var req EditRequest
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to decode JSON: "+err.Error())
+		return
+	}
+	if err := handler.store.EditPost(c, caller, id, req.Text, handler.config.EditWindow); err != nil {
+		storeError(w, err)
+		return
+	}
+	handler.encodePost(w, r, caller, id, http.StatusOK)
+}
+
+// delete deletes the caller's own post, its replies are kept.
+func (handler *Handler) delete(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	id, err := postID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := handler.store.DeletePost(c, caller, id); err != nil {
+		storeError(w, err)
+		return
+	}
+	handler.encodePost(w, r, caller, id, http.StatusOK)
+}
+
+// revisions returns the previous versions of the text of a post, oldest first.
+// They are only available as long as the post itself is shown to the caller.
+func (handler *Handler) revisions(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	id, err := postID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	post, err := handler.store.GetPost(c, id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, caller, handler.config.Moderators, []models.Post{post})
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	revisions := make([]models.Revision, 0)
+	if !names.Concealed(post) {
+		if revisions, err = handler.store.Revisions(c, id); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(models.ToJSONRevisions(revisions)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// encodePost writes the current state of a post as seen by the caller with the given status,
+// which is only sent once the post has been loaded.
+func (handler *Handler) encodePost(w http.ResponseWriter, r *http.Request, caller string, id int64, status int) {
+	c := handler.config.Context(r)
+	post, err := handler.store.GetPost(c, id)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, caller, handler.config.Moderators, []models.Post{post})
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	jsonPost := models.ToJSONPost(id, post, names)
+	if wantsHTML(r) {
+		jsonPost.TextHTML = string(web.RenderText(jsonPost.Text))
+	}
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(jsonPost); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// postID extracts the post ID from paths like /api/posts/{id}/...
+func postID(r *http.Request) (int64, error) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/posts/"), "/")
+	return strconv.ParseInt(strings.SplitN(path, "/", 2)[0], 10, 64)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// /report DATA={post, reason} -> {post, hidden}
+// Reports a post to the moderators, reporting a post twice has no effect. Posts are hidden
+// once their pending reports reach the report threshold. The report is submitted by the
+// owner of the API token, which needs the post scope.
+func (handler *Handler) report(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	dec := json.NewDecoder(r.Body)
+	var req ReportRequest
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to decode JSON: "+err.Error())
+		return
+	}
+	report, err := models.NewReport(caller, req.Post, req.Reason)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	post, err := handler.store.SubmitReport(c, report, handler.config.ReportThreshold)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(ReportResponse{
+		Post:   req.Post,
+		Hidden: post.Hidden,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
+
+// /reports?limit={n}&cursor={cursor} -> [{post: JSONPost, reports: [JSONReport...]}...]
+// Returns the posts with pending reports ordered by ID, the cursor of the next page is
+// returned in the X-Next-Cursor header. Only available to moderators with the moderate scope.
+// Reports are resolved by approving or removing the post via /moderate.
+func (handler *Handler) reports(w http.ResponseWriter, r *http.Request, caller string) {
+	c := handler.config.Context(r)
+	user, err := handler.store.GetUser(c, caller)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	if !handler.config.Moderators.Includes(user) {
+		writeError(w, http.StatusForbidden, "Only moderators can review reports")
+		return
+	}
+	query := r.URL.Query()
+	limit := handler.config.PageSize
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid limit: "+err.Error())
+			return
+		}
+	}
+	posts, ids, next, err := handler.store.ReportedPosts(c, models.ReportQueue{
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+	})
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	reports, err := handler.store.GetReports(c, ids)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, caller, handler.config.Moderators, posts)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	var reporters []string
+	for _, id := range ids {
+		for _, report := range reports[id] {
+			reporters = append(reporters, report.Reporter)
+		}
+	}
+	users, err := handler.store.GetUsers(c, reporters)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	queue := make([]ReportedPost, len(posts))
+	for i := range posts {
+		queue[i] = ReportedPost{
+			Post:    models.ToJSONPost(ids[i], posts[i], names),
+			Reports: models.ToJSONReports(reports[ids[i]], users),
+		}
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(queue); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
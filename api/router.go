@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// methods routes a resource's requests by HTTP method and rejects other methods.
+type methods map[string]http.Handler
+
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := m[r.Method]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	allowed := make([]string, 0, len(m))
+	for method := range m {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// resource is a path template below the prefix of a router. Segments in braces
+// match any non-empty segment.
+type resource struct {
+	Path string
+	// Route returns the handler for the segments matched by the braces in order,
+	// nil if they do not name a resource.
+	Route func(params []string) http.Handler
+}
+
+// match reports if the segments of a path match the template and returns the matched parameters.
+func (res resource) match(segments []string) ([]string, bool) {
+	template := strings.Split(res.Path, "/")
+	if len(template) != len(segments) {
+		return nil, false
+	}
+	var params []string
+	for i, part := range template {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params = append(params, segments[i])
+		} else if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// router routes the requests below a prefix to the first resource matching their path.
+type router struct {
+	prefix    string
+	resources []resource
+}
+
+func (router *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, router.prefix), "/"), "/")
+	for _, res := range router.resources {
+		params, ok := res.match(segments)
+		if !ok {
+			continue
+		}
+		if route := res.Route(params); route != nil {
+			route.ServeHTTP(w, r)
+			return
+		}
+		break
+	}
+	writeError(w, http.StatusNotFound, "not found")
+}
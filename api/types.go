@@ -0,0 +1,123 @@
+package api
+
+import "github.com/lnsp/zwig/models"
+
+// AddRequest submits a post via /add and POST /v2/posts.
+type AddRequest struct {
+	Color string `json:"color"`
+	Text  string `json:"text"`
+	// Parent is the ID of the post replied to, 0 for top-level posts.
+	Parent int64 `json:"topic,omitempty"`
+	// Community is the slug of the community of a top-level post, empty for none.
+	Community string `json:"community,omitempty"`
+	Anonymous bool   `json:"anonymous,omitempty"`
+}
+
+// AddResponse returns the ID of a post submitted via /add.
+type AddResponse struct {
+	ID int64 `json:"id"`
+}
+
+// ShowRequest selects a post via /show.
+type ShowRequest struct {
+	ID int64 `json:"id"`
+	// Depth limits the nesting of the comments, defaults to models.DefaultThreadDepth.
+	Depth int `json:"depth,omitempty"`
+}
+
+// ShowResponse is a post with its comments.
+type ShowResponse struct {
+	ID         int64  `json:"id"`
+	Author     string `json:"user"`
+	Text       string `json:"text"`
+	Votes      int    `json:"votes"`
+	Date       int64  `json:"timestamp"`
+	Color      string `json:"color"`
+	Community  string `json:"community,omitempty"`
+	Anonymous  bool   `json:"anonymous,omitempty"`
+	RealAuthor string `json:"real_user,omitempty"`
+	Removed    bool   `json:"removed,omitempty"`
+	// Locked is set if the whole thread of the post is locked.
+	Locked   bool              `json:"locked,omitempty"`
+	Pinned   bool              `json:"pinned,omitempty"`
+	Hidden   bool              `json:"hidden,omitempty"`
+	Edited   bool              `json:"edited,omitempty"`
+	Deleted  bool              `json:"deleted,omitempty"`
+	TextHTML string            `json:"text_html,omitempty"`
+	Comments []models.JSONPost `json:"comments"`
+}
+
+// VoteRequest casts a vote via /vote.
+type VoteRequest struct {
+	Post   int64 `json:"post"`
+	Upvote bool  `json:"upvote"`
+}
+
+// CastVoteRequest casts a vote via POST /v2/posts/{id}/votes.
+type CastVoteRequest struct {
+	Upvote bool `json:"upvote"`
+}
+
+// VoteResponse returns the score of a post and the caller's vote on it.
+type VoteResponse struct {
+	Votes     int  `json:"votes"`
+	Upvoted   bool `json:"upvoted"`
+	Downvoted bool `json:"downvoted"`
+}
+
+// KarmaResponse returns the karma of the caller via /karma.
+type KarmaResponse struct {
+	Karma int `json:"karma"`
+}
+
+// UserKarmaResponse returns the karma of a user via GET /v2/users/{handle}/karma.
+type UserKarmaResponse struct {
+	Handle string `json:"user"`
+	Karma  int    `json:"karma"`
+}
+
+// EditRequest replaces the text of a post via PUT /posts/{id}.
+type EditRequest struct {
+	Text string `json:"text"`
+}
+
+// ModerateRequest applies a moderation action to a post via /moderate.
+type ModerateRequest struct {
+	Post int64 `json:"post"`
+	// Action is one of remove, restore, lock, unlock, pin, unpin and approve.
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// ReportRequest reports a post to the moderators via /report.
+type ReportRequest struct {
+	Post   int64  `json:"post"`
+	Reason string `json:"reason"`
+}
+
+// ReportResponse returns whether a reported post is hidden pending review.
+type ReportResponse struct {
+	Post   int64 `json:"post"`
+	Hidden bool  `json:"hidden"`
+}
+
+// ReportedPost is a post in the report queue returned by /reports with its pending reports.
+type ReportedPost struct {
+	Post    models.JSONPost     `json:"post"`
+	Reports []models.JSONReport `json:"reports"`
+}
+
+// UserResponse is the profile of a user returned by /users/{handle} with a page of their posts or comments.
+type UserResponse struct {
+	Handle string `json:"user"`
+	// Joined is the Unix time the user was created.
+	Joined       int64             `json:"joined"`
+	Karma        int               `json:"karma"`
+	PostKarma    int               `json:"post_karma"`
+	CommentKarma int               `json:"comment_karma"`
+	Posts        int               `json:"posts"`
+	Comments     int               `json:"comments"`
+	Upvotes      int               `json:"upvotes_given"`
+	Downvotes    int               `json:"downvotes_given"`
+	Items        []models.JSONPost `json:"items"`
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// users routes the requests below /users/ to the profiles of users.
+func (handler *Handler) users() *router {
+	return &router{prefix: "/api/users/", resources: []resource{
+		{Path: "{handle}", Route: func(params []string) http.Handler {
+			handle := params[0]
+			return handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.user(w, r, caller, handle)
+			}, models.ScopeRead, true)
+		}},
+	}}
+}
+
+// /users/{handle}?kind={posts,comments}&limit={n}&cursor={cursor}&html={bool} -> {user, joined, karma, ..., items: [JSONPost...]}
+// Items are the user's posts or comments, newest first. The cursor of the next page is
+// returned in the X-Next-Cursor header. Anonymous posts are only listed for the user
+// themselves and for moderators.
+func (handler *Handler) user(w http.ResponseWriter, r *http.Request, caller, handle string) {
+	c := handler.config.Context(r)
+	query := r.URL.Query()
+	user, err := handler.store.GetUserByHandle(c, handle)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	history := models.History{
+		Limit:  handler.config.PageSize,
+		Cursor: query.Get("cursor"),
+	}
+	switch query.Get("kind") {
+	case "", "posts":
+	case "comments":
+		history.Comments = true
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid kind, expected posts or comments")
+		return
+	}
+	if l := query.Get("limit"); l != "" {
+		if history.Limit, err = strconv.Atoi(l); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid limit: "+err.Error())
+			return
+		}
+	}
+	if caller != "" {
+		viewer, err := handler.store.GetUser(c, caller)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+		history.Anonymous = caller == user.ID || handler.config.Moderators.Includes(viewer)
+	}
+	stats, err := handler.store.GetStats(c, user.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	posts, ids, next, err := handler.store.PostsBy(c, user.ID, history)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, caller, handler.config.Moderators, posts)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	items, err := models.ToJSONComments(posts, ids, names)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	renderHTML(r, items)
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(UserResponse{
+		Handle:       user.Handle,
+		Joined:       user.Created.Unix(),
+		Karma:        user.Karma,
+		PostKarma:    stats.PostKarma,
+		CommentKarma: stats.CommentKarma,
+		Posts:        stats.Posts,
+		Comments:     stats.Comments,
+		Upvotes:      stats.Upvotes,
+		Downvotes:    stats.Downvotes,
+		Items:        items,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// v2 routes the REST API below /api/v2/ by path and method:
+// GET /posts?sort={hot,top,best}&limit={n}&cursor={cursor}&html={bool} -> [JSONPost...]
+// POST /posts DATA={color, text, topic, community, anonymous} -> 201 {JSONPost}
+// GET /posts/{id}?depth={n}&html={bool} -> {JSONPost, comments: [JSONPost...]}
+// POST /posts/{id}/votes DATA={upvote} -> 201 or 200 if flipped {votes, upvoted, downvoted}
+// GET /users/{handle}/karma -> {user, karma}
+// Reads need the read scope if a token is given, posts and votes need the post and vote scopes.
+func (handler *Handler) v2() *router {
+	return &router{prefix: "/api/v2/", resources: []resource{
+		{Path: "", Route: func(params []string) http.Handler {
+			return methods{http.MethodGet: http.HandlerFunc(handler.status)}
+		}},
+		{Path: "posts", Route: func(params []string) http.Handler {
+			return methods{
+				http.MethodGet:  handler.auth(handler.list, models.ScopeRead, true),
+				http.MethodPost: handler.auth(handler.createPost, models.ScopePost, false),
+			}
+		}},
+		{Path: "posts/{id}", Route: func(params []string) http.Handler {
+			id, err := strconv.ParseInt(params[0], 10, 64)
+			if err != nil {
+				return nil
+			}
+			return methods{http.MethodGet: handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.getPost(w, r, caller, id)
+			}, models.ScopeRead, true)}
+		}},
+		{Path: "posts/{id}/votes", Route: func(params []string) http.Handler {
+			id, err := strconv.ParseInt(params[0], 10, 64)
+			if err != nil {
+				return nil
+			}
+			return methods{http.MethodPost: handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.castVote(w, r, caller, id)
+			}, models.ScopeVote, false)}
+		}},
+		{Path: "users/{handle}/karma", Route: func(params []string) http.Handler {
+			handle := params[0]
+			return methods{http.MethodGet: handler.auth(func(w http.ResponseWriter, r *http.Request, caller string) {
+				handler.userKarma(w, r, handle)
+			}, models.ScopeRead, true)}
+		}},
+	}}
+}
+
+// createPost submits a post on behalf of the caller and answers with the created post.
+func (handler *Handler) createPost(w http.ResponseWriter, r *http.Request, caller string) {
+	id, ok := handler.submitPost(w, r, caller)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", "/api/v2/posts/"+strconv.FormatInt(id, 10))
+	handler.encodePost(w, r, caller, id, http.StatusCreated)
+}
+
+// getPost shows a post with its comments nested up to the depth given in the query.
+func (handler *Handler) getPost(w http.ResponseWriter, r *http.Request, caller string, id int64) {
+	depth := models.DefaultThreadDepth
+	if d := r.URL.Query().Get("depth"); d != "" {
+		var err error
+		if depth, err = strconv.Atoi(d); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid depth: "+err.Error())
+			return
+		}
+	}
+	handler.showPost(w, r, caller, id, depth)
+}
+
+// castVote casts the caller's vote on a post. Unlike /vote, repeating a vote fails with 409
+// instead of retracting it. Flipping an opposite vote answers with 200 instead of 201.
+func (handler *Handler) castVote(w http.ResponseWriter, r *http.Request, caller string, id int64) {
+	dec := json.NewDecoder(r.Body)
+	var req CastVoteRequest
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to decode JSON: "+err.Error())
+		return
+	}
+	flipped, err := handler.store.CastVote(handler.config.Context(r), caller, id, req.Upvote)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	status := http.StatusCreated
+	if flipped {
+		status = http.StatusOK
+	}
+	handler.encodeVote(w, r, id, true, req.Upvote, status)
+}
+
+// userKarma returns the karma of the user with the given handle.
+func (handler *Handler) userKarma(w http.ResponseWriter, r *http.Request, handle string) {
+	c := handler.config.Context(r)
+	user, err := handler.store.GetUserByHandle(c, handle)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	karma, err := handler.store.GetKarma(c, user.ID)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(UserKarmaResponse{
+		Handle: user.Handle,
+		Karma:  karma,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode JSON: "+err.Error())
+	}
+}
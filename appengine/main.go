@@ -1,20 +1,125 @@
 package appengine
 
 import (
+	"fmt"
 	"net/http"
 
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/user"
+
 	"github.com/lnsp/zwig/web"
 
 	"github.com/lnsp/zwig/api"
+	"github.com/lnsp/zwig/models/datastore"
 )
 
 var (
 	colors = []string{"blue", "red", "orange", "green"}
 )
 
+// usersAuth authenticates users using the App Engine Users API.
+type usersAuth struct{}
+
+func (usersAuth) Current(r *http.Request) string {
+	if u := user.Current(appengine.NewContext(r)); u != nil {
+		return u.Email
+	}
+	return ""
+}
+
+func (usersAuth) LoginURL(r *http.Request, dest string) (string, error) {
+	return user.LoginURL(appengine.NewContext(r), dest)
+}
+
+func (usersAuth) LogoutURL(r *http.Request, dest string) (string, error) {
+	return user.LogoutURL(appengine.NewContext(r), dest)
+}
+
+func newContext(r *http.Request) context.Context {
+	return appengine.NewContext(r)
+}
+
+// migrateAuthors runs the one-time migration of logins stored as authors to user IDs.
+// It is restricted to administrators by app.yaml.
+func migrateAuthors(store *datastore.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		migrated, err := store.MigrateAuthors(newContext(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "migrated %d entities\n", migrated)
+	}
+}
+
+// migrateRanks runs the one-time recomputation of the vote counters and ranks of posts
+// stored before they were introduced. It is restricted to administrators by app.yaml.
+func migrateRanks(store *datastore.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		migrated, err := store.MigrateRanks(newContext(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "migrated %d posts\n", migrated)
+	}
+}
+
+// migrateRoots runs the one-time resolution of the threads of replies stored before threads
+// were introduced. It is restricted to administrators by app.yaml.
+func migrateRoots(store *datastore.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		migrated, err := store.MigrateRoots(newContext(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "migrated %d posts\n", migrated)
+	}
+}
+
+// migrateVotes runs the one-time move of votes stored before their keys were derived from
+// post and author. It is restricted to administrators by app.yaml.
+func migrateVotes(store *datastore.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		migrated, err := store.MigrateVotes(newContext(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "migrated %d votes\n", migrated)
+	}
+}
+
+// reconcileKarma recomputes the karma of all users from their votes.
+// It is run by cron.yaml and restricted to administrators by app.yaml.
+func reconcileKarma(store *datastore.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		corrected, err := store.ReconcileKarma(newContext(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "corrected karma of %d users\n", corrected)
+	}
+}
+
 func init() {
-	apiHandler := api.New()
-	webHandler := web.New()
+	store := datastore.New()
+	apiHandler := api.New(store, api.Config{
+		Context: newContext,
+	})
+	webHandler := web.New(store, web.Config{
+		TemplateDir: web.DefaultTemplateDir,
+		Context:     newContext,
+		Auth:        usersAuth{},
+	})
+	http.Handle("/admin/migrate-authors", migrateAuthors(store))
+	http.Handle("/admin/migrate-ranks", migrateRanks(store))
+	http.Handle("/admin/migrate-roots", migrateRoots(store))
+	http.Handle("/admin/migrate-votes", migrateVotes(store))
+	http.Handle("/admin/reconcile-karma", reconcileKarma(store))
 	http.Handle("/api/", apiHandler)
 	http.Handle("/", webHandler)
 }
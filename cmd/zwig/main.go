@@ -0,0 +1,253 @@
+// Command zwig runs a standalone Zwig server outside of App Engine.
+//
+// Every flag can also be set using an environment variable, for example
+// ZWIG_ADDR=:8080 or ZWIG_DRIVER=sqlite3 ZWIG_DSN=zwig.db.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/api"
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/models/memory"
+	"github.com/lnsp/zwig/models/sqlstore"
+	"github.com/lnsp/zwig/web"
+)
+
+// the time given to in-flight requests on shutdown
+const (
+	shutdownTimeout = 10 * time.Second
+)
+
+// staticDirs are the directories of static assets served below /static/, like in app.yaml.
+// The templates next to them are not served.
+var staticDirs = []string{"css", "icons"}
+
+var (
+	addr        = flag.String("addr", env("ZWIG_ADDR", ":8080"), "address to listen on")
+	driver      = flag.String("driver", env("ZWIG_DRIVER", "memory"), "storage backend (memory, sqlite3, postgres)")
+	dsn         = flag.String("dsn", env("ZWIG_DSN", "zwig.db"), "data source name of the storage backend")
+	templateDir = flag.String("templates", env("ZWIG_TEMPLATES", "appengine/static/templates"), "directory containing the HTML templates")
+	staticDir   = flag.String("static", env("ZWIG_STATIC", "appengine/static"), "directory containing the static assets, only its css and icons are served")
+	authMode    = flag.String("auth", env("ZWIG_AUTH", "local"), "authentication provider (none, local, oidc, proxy)")
+	sessionKey  = flag.String("session-key", env("ZWIG_SESSION_KEY", ""), "secret signing session cookies, random if empty")
+	oidcIssuer  = flag.String("oidc-issuer", env("ZWIG_OIDC_ISSUER", ""), "OpenID Connect issuer URL")
+	oidcClient  = flag.String("oidc-client-id", env("ZWIG_OIDC_CLIENT_ID", ""), "OpenID Connect client ID")
+	oidcSecret  = flag.String("oidc-client-secret", env("ZWIG_OIDC_CLIENT_SECRET", ""), "OpenID Connect client secret")
+	oidcURL     = flag.String("oidc-redirect-url", env("ZWIG_OIDC_REDIRECT_URL", ""), "absolute URL of /auth/oidc/callback")
+	proxyHeader = flag.String("proxy-header", env("ZWIG_PROXY_HEADER", web.DefaultProxyHeader), "header carrying the user in proxy mode")
+	proxyTrust  = flag.String("proxy-trusted", env("ZWIG_PROXY_TRUSTED", ""), "comma-separated networks of trusted proxies, loopback only if empty")
+	proxyLogin  = flag.String("proxy-login", env("ZWIG_PROXY_LOGIN", ""), "login URL of the proxy")
+	proxyLogout = flag.String("proxy-logout", env("ZWIG_PROXY_LOGOUT", ""), "logout URL of the proxy")
+	moderators  = flag.String("moderators", env("ZWIG_MODERATORS", ""), "comma-separated logins of the moderators")
+	reconcile   = flag.String("reconcile-interval", env("ZWIG_RECONCILE_INTERVAL", "1h"), "interval between karma reconciliations, 0 to disable")
+	editWindow  = flag.String("edit-window", env("ZWIG_EDIT_WINDOW", models.DefaultEditWindow.String()), "time during which authors may edit their posts, 0 for no limit")
+	reports     = flag.String("report-threshold", env("ZWIG_REPORT_THRESHOLD", strconv.Itoa(models.DefaultReportThreshold)), "number of reports hiding a post until it is reviewed, 0 to disable")
+)
+
+// filesOnly serves the files of a file system without listing its directories.
+type filesOnly struct {
+	http.FileSystem
+}
+
+func (fs filesOnly) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
+
+// env looks up an environment variable and falls back to def if it is not set.
+func env(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// split splits a comma-separated flag value, skipping empty entries.
+func split(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// openStore initializes the configured storage backend.
+func openStore(driver, dsn string) (models.Store, error) {
+	switch driver {
+	case "memory":
+		return memory.New(), nil
+	case "sqlite3", "postgres":
+		return sqlstore.Open(driver, dsn)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", driver)
+}
+
+// openAuth initializes the configured authentication provider.
+func openAuth(mode string, store models.UserStore) (web.Authenticator, error) {
+	switch mode {
+	case "none":
+		return nil, nil
+	case "local":
+		return web.NewLocalAuth(store, web.LocalConfig{
+			TemplateDir: *templateDir,
+			SessionKey:  []byte(*sessionKey),
+		}), nil
+	case "oidc":
+		auth, err := web.NewOIDCAuth(context.Background(), web.OIDCConfig{
+			Issuer:       *oidcIssuer,
+			ClientID:     *oidcClient,
+			ClientSecret: *oidcSecret,
+			RedirectURL:  *oidcURL,
+			SessionKey:   []byte(*sessionKey),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not discover OpenID Connect provider: %v", err)
+		}
+		return auth, nil
+	case "proxy":
+		auth := web.ProxyAuth{
+			Header: *proxyHeader,
+			Login:  *proxyLogin,
+			Logout: *proxyLogout,
+		}
+		for _, cidr := range split(*proxyTrust) {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy network: %v", err)
+			}
+			auth.Trusted = append(auth.Trusted, network)
+		}
+		return auth, nil
+	}
+	return nil, fmt.Errorf("unknown authentication provider %q", mode)
+}
+
+// reconcileKarma periodically recomputes the karma of all users until the context is done.
+func reconcileKarma(c context.Context, store models.UserStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+			corrected, err := store.ReconcileKarma(c)
+			if err != nil {
+				log.Printf("zwig: could not reconcile karma: %v", err)
+			} else if corrected > 0 {
+				log.Printf("zwig: corrected karma of %d users", corrected)
+			}
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	store, err := openStore(*driver, *dsn)
+	if err != nil {
+		log.Fatalf("zwig: could not open store: %v", err)
+	}
+	auth, err := openAuth(*authMode, store)
+	if err != nil {
+		log.Fatalf("zwig: could not set up authentication: %v", err)
+	}
+	if *sessionKey == "" && (*authMode == "local" || *authMode == "oidc") {
+		log.Printf("zwig: no session key configured, sessions end on restart")
+	}
+	interval, err := time.ParseDuration(*reconcile)
+	if err != nil {
+		log.Fatalf("zwig: invalid reconcile interval: %v", err)
+	}
+	threshold, err := strconv.Atoi(*reports)
+	if err != nil {
+		log.Fatalf("zwig: invalid report threshold: %v", err)
+	}
+	if threshold <= 0 {
+		threshold = -1
+	}
+	window, err := time.ParseDuration(*editWindow)
+	if err != nil {
+		log.Fatalf("zwig: invalid edit window: %v", err)
+	}
+	if window <= 0 {
+		window = -1
+	}
+	background, stop := context.WithCancel(context.Background())
+	defer stop()
+	if interval > 0 {
+		go reconcileKarma(background, store, interval)
+	}
+
+	mux := http.NewServeMux()
+	mods := models.Moderators(split(*moderators))
+	mux.Handle("/api/", api.New(store, api.Config{
+		Moderators:      mods,
+		ReportThreshold: threshold,
+		EditWindow:      window,
+	}))
+	for _, dir := range staticDirs {
+		prefix := "/static/" + dir + "/"
+		mux.Handle(prefix, http.StripPrefix(prefix, http.FileServer(filesOnly{http.Dir(filepath.Join(*staticDir, dir))})))
+	}
+	mux.Handle("/", web.New(store, web.Config{
+		TemplateDir:     *templateDir,
+		Auth:            auth,
+		Moderators:      mods,
+		ReportThreshold: threshold,
+		EditWindow:      window,
+	}))
+
+	server := &http.Server{
+		Addr:    *addr,
+		Handler: mux,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Printf("zwig: shutting down")
+		c, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(c); err != nil {
+			log.Printf("zwig: shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("zwig: listening on %s using %s storage", *addr, *driver)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("zwig: %v", err)
+	}
+	<-done
+	stop()
+	if closer, ok := store.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("zwig: could not close store: %v", err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the minimum length of a local account password.
+const MinPasswordLength = 8
+
+// accountName restricts the names of local accounts.
+var accountName = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,32}$`)
+
+// Account is a local user account authenticated by password.
+type Account struct {
+	Name string
+	// Password is the bcrypt hash of the account's password.
+	Password []byte
+	Created  time.Time
+}
+
+// NewAccount verifies the input and initializes a new account with a hashed password.
+func NewAccount(name, password string) (Account, error) {
+	name = strings.TrimSpace(name)
+	if !accountName.MatchString(name) {
+		return Account{}, fmt.Errorf("NewAccount: name must have 3 to 32 letters, digits, dashes or underscores")
+	}
+	if len(password) < MinPasswordLength {
+		return Account{}, fmt.Errorf("NewAccount: password must have at least %d characters", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Account{}, fmt.Errorf("NewAccount: could not hash password: %v", err)
+	}
+	return Account{
+		Name:     name,
+		Password: hash,
+		Created:  time.Now(),
+	}, nil
+}
+
+// CheckPassword reports if the password matches the account's password hash.
+func (account Account) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(account.Password, []byte(password)) == nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// collection of community visibilities
+const (
+	// VisibilityPublic lists the community in the directory and lets everyone post.
+	VisibilityPublic = "public"
+	// VisibilityRestricted lists the community in the directory but only lets its owners post.
+	VisibilityRestricted = "restricted"
+	// VisibilityUnlisted hides the community from the directory, everyone knowing its slug can post.
+	VisibilityUnlisted = "unlisted"
+)
+
+// collection of community limits
+const (
+	MaxCommunityName        = 64
+	MaxCommunityDescription = 500
+)
+
+// slugPattern restricts the slugs of communities.
+var slugPattern = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+
+// Visibilities lists all available community visibilities.
+func Visibilities() []string {
+	return []string{VisibilityPublic, VisibilityRestricted, VisibilityUnlisted}
+}
+
+// Community groups posts around a topic. Posts of all communities are readable by
+// everyone and appear on the front page, the visibility only controls the directory
+// listing and who may post.
+type Community struct {
+	// Slug identifies the community in URLs like /c/{slug}.
+	Slug        string
+	Name        string
+	Description string
+	// Owners are the IDs of the users managing the community.
+	Owners     []string
+	Visibility string
+	Created    time.Time
+}
+
+// NewCommunity verifies the input and initializes a new community owned by the given user.
+func NewCommunity(slug, name, description, owner, visibility string) (Community, error) {
+	slug, err := NormalizeSlug(slug)
+	if err != nil {
+		return Community{}, err
+	}
+	name = strings.TrimSpace(name)
+	description = strings.TrimSpace(description)
+	owner = strings.TrimSpace(owner)
+	if len(owner) < 1 {
+		return Community{}, fmt.Errorf("NewCommunity: community needs an owner")
+	}
+	if len(name) < 1 || utf8.RuneCountInString(name) > MaxCommunityName {
+		return Community{}, fmt.Errorf("NewCommunity: name must have 1 to %d characters", MaxCommunityName)
+	}
+	if utf8.RuneCountInString(description) > MaxCommunityDescription {
+		return Community{}, fmt.Errorf("NewCommunity: description must not exceed %d characters", MaxCommunityDescription)
+	}
+	if visibility == "" {
+		visibility = VisibilityPublic
+	} else if !validVisibility(visibility) {
+		return Community{}, fmt.Errorf("NewCommunity: unknown visibility %q", visibility)
+	}
+	return Community{
+		Slug:        slug,
+		Name:        name,
+		Description: description,
+		Owners:      []string{owner},
+		Visibility:  visibility,
+		Created:     time.Now(),
+	}, nil
+}
+
+// NormalizeSlug verifies a community slug and returns its canonical lowercase form.
+func NormalizeSlug(slug string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !slugPattern.MatchString(slug) {
+		return "", fmt.Errorf("NormalizeSlug: slug must have 3 to 32 letters, digits, dashes or underscores")
+	}
+	return slug, nil
+}
+
+// IsOwner reports if the user manages the community.
+func (community Community) IsOwner(user string) bool {
+	for _, owner := range community.Owners {
+		if owner == user {
+			return true
+		}
+	}
+	return false
+}
+
+// Listed reports if the community is shown in the directory.
+func (community Community) Listed() bool {
+	return community.Visibility != VisibilityUnlisted
+}
+
+// Accepts reports if the user may post in the community.
+func (community Community) Accepts(user string) bool {
+	return community.Visibility != VisibilityRestricted || community.IsOwner(user)
+}
+
+// JSONCommunity is a JSON representation of a Community.
+type JSONCommunity struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+	Created     int64  `json:"created"`
+}
+
+// ToJSONCommunity converts a community into its JSON representation. Owners are not exposed.
+func ToJSONCommunity(community Community) JSONCommunity {
+	return JSONCommunity{
+		Slug:        community.Slug,
+		Name:        community.Name,
+		Description: community.Description,
+		Visibility:  community.Visibility,
+		Created:     community.Created.Unix(),
+	}
+}
+
+func validVisibility(visibility string) bool {
+	for _, v := range Visibilities() {
+		if v == visibility {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package datastore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// accountKey derives the key of a local account from its name.
+func accountKey(c context.Context, name string) *datastore.Key {
+	return datastore.NewKey(c, "Account", name, 0, nil)
+}
+
+// CreateAccount stores a new local account, failing if the name is already taken.
+func (store *Store) CreateAccount(c context.Context, account models.Account) error {
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		key := accountKey(c, account.Name)
+		var existing models.Account
+		if err := datastore.Get(c, key, &existing); err == nil {
+			return fmt.Errorf("CreateAccount: name is already taken")
+		} else if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("CreateAccount: could not look up name: %v", err)
+		}
+		if _, err := datastore.Put(c, key, &account); err != nil {
+			return fmt.Errorf("CreateAccount: could not store account: %v", err)
+		}
+		return nil
+	}, nil)
+}
+
+// GetAccount retrieves a local account by name.
+func (store *Store) GetAccount(c context.Context, name string) (models.Account, error) {
+	var account models.Account
+	if err := datastore.Get(c, accountKey(c, name), &account); err != nil {
+		return account, fmt.Errorf("GetAccount: could not find account: %w", notFound(err))
+	}
+	return account, nil
+}
@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// communityKey derives the key of a community from its slug.
+func communityKey(c context.Context, slug string) *datastore.Key {
+	return datastore.NewKey(c, "Community", slug, 0, nil)
+}
+
+// CreateCommunity stores a new community, failing if the slug is already taken.
+func (store *Store) CreateCommunity(c context.Context, community models.Community) error {
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		key := communityKey(c, community.Slug)
+		var existing models.Community
+		if err := datastore.Get(c, key, &existing); err == nil {
+			return fmt.Errorf("CreateCommunity: slug is already taken")
+		} else if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("CreateCommunity: could not look up slug: %v", err)
+		}
+		if _, err := datastore.Put(c, key, &community); err != nil {
+			return fmt.Errorf("CreateCommunity: could not store community: %v", err)
+		}
+		return nil
+	}, nil)
+}
+
+// GetCommunity retrieves a community by slug.
+func (store *Store) GetCommunity(c context.Context, slug string) (models.Community, error) {
+	var community models.Community
+	if err := datastore.Get(c, communityKey(c, slug), &community); err != nil {
+		return community, fmt.Errorf("GetCommunity: could not find community: %w", notFound(err))
+	}
+	return community, nil
+}
+
+// Communities retrieves all communities ordered by slug.
+func (store *Store) Communities(c context.Context) ([]models.Community, error) {
+	communities := make([]models.Community, 0)
+	if _, err := datastore.NewQuery("Community").Order("Slug").GetAll(c, &communities); err != nil {
+		return nil, fmt.Errorf("Communities: could not collect communities: %v", err)
+	}
+	return communities, nil
+}
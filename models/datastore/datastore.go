@@ -0,0 +1,720 @@
+// Package datastore implements models.Store on top of the App Engine datastore.
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// Store is a models.Store backed by the App Engine datastore.
+type Store struct {
+	// ranked is set to 1 once all posts are known to store their ranks, see MigrateRanks.
+	ranked int32
+	// rekeyed is set to 1 once all votes are known to be keyed by post and author, see MigrateVotes.
+	rekeyed int32
+}
+
+// New initializes a new datastore backed store.
+func New() *Store {
+	return &Store{}
+}
+
+// GetKarma retrieves the amount of karma a user has earned.
+func (store *Store) GetKarma(c context.Context, author string) (int, error) {
+	var user models.User
+	if err := datastore.Get(c, userKey(c, author), &user); err != nil {
+		return 0, fmt.Errorf("GetKarma: could not find user: %w", notFound(err))
+	}
+	return user.Karma, nil
+}
+
+// ReconcileKarma recomputes the karma of all users from the votes on their posts.
+func (store *Store) ReconcileKarma(c context.Context) (int, error) {
+	var posts []models.Post
+	postKeys, err := datastore.NewQuery("Post").Project("Author").GetAll(c, &posts)
+	if err != nil {
+		return 0, fmt.Errorf("ReconcileKarma: could not collect posts: %v", err)
+	}
+	authors := make(map[int64]string, len(posts))
+	for i, post := range posts {
+		authors[postKeys[i].IntID()] = post.Author
+	}
+	var votes []models.Vote
+	if _, err := datastore.NewQuery("Vote").GetAll(c, &votes); err != nil {
+		return 0, fmt.Errorf("ReconcileKarma: could not collect votes: %v", err)
+	}
+	karma := make(map[string]int)
+	for _, vote := range votes {
+		if vote.Upvote {
+			karma[authors[vote.Post]]++
+		} else {
+			karma[authors[vote.Post]]--
+		}
+	}
+	var users []models.User
+	userKeys, err := datastore.NewQuery("User").GetAll(c, &users)
+	if err != nil {
+		return 0, fmt.Errorf("ReconcileKarma: could not collect users: %v", err)
+	}
+	corrected := 0
+	for i, user := range users {
+		if user.Karma == karma[user.ID] {
+			continue
+		}
+		user.Karma = karma[user.ID]
+		if _, err := datastore.Put(c, userKeys[i], &user); err != nil {
+			return corrected, fmt.Errorf("ReconcileKarma: could not update user: %v", err)
+		}
+		corrected++
+	}
+	return corrected, nil
+}
+
+// addKarma adjusts the karma of a user inside a cross-group transaction. Unknown users are skipped.
+func addKarma(c context.Context, author string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	var user models.User
+	if err := datastore.Get(c, userKey(c, author), &user); err == datastore.ErrNoSuchEntity {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	user.Karma += delta
+	_, err := datastore.Put(c, userKey(c, author), &user)
+	return err
+}
+
+// threadLocked reports if the thread of the post with the given ID is locked.
+func threadLocked(c context.Context, id int64, post models.Post) (bool, error) {
+	root, err := resolveRoot(c, id, post)
+	if err != nil {
+		return false, err
+	}
+	if root != id {
+		var rootPost models.Post
+		err := datastore.Get(c, postKey(c, root), &rootPost)
+		return rootPost.Locked, err
+	}
+	return post.Locked, nil
+}
+
+// voteKey derives the key of a user's vote on a post. Votes are children of
+// their post so that both can be updated in a single transaction.
+func voteKey(c context.Context, id int64, author string) *datastore.Key {
+	return datastore.NewKey(c, "Vote", author, 0, postKey(c, id))
+}
+
+// SubmitVote atomically toggles a user's vote on a post and updates the vote counters and rank of the post
+// as well as the karma of its author.
+func (store *Store) SubmitVote(c context.Context, author string, id int64, upvote bool) (bool, error) {
+	keep, _, err := store.submitVote(c, author, id, upvote, true)
+	return keep, err
+}
+
+// CastVote casts a vote like SubmitVote, but fails if the user already voted the same way.
+// It reports whether an opposite vote was flipped instead of a new vote being cast.
+func (store *Store) CastVote(c context.Context, author string, id int64, upvote bool) (bool, error) {
+	_, flipped, err := store.submitVote(c, author, id, upvote, false)
+	return flipped, err
+}
+
+// submitVote applies a vote in a transaction, a repeated vote is retracted if retract is set.
+// It reports whether the user has a vote on the post afterwards and whether an opposite vote was flipped.
+func (store *Store) submitVote(c context.Context, author string, id int64, upvote, retract bool) (bool, bool, error) {
+	// verify input
+	vote, err := models.NewVote(author, id, upvote)
+	if err != nil {
+		return false, false, err
+	}
+	// votes stored before keys were derived from post and author can only be found by query,
+	// they are replaced by a vote with a derived key inside the transaction
+	legacy, err := datastore.NewQuery("Vote").Filter("Author =", vote.Author).Filter("Post =", id).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("SubmitVote: failed to retrieve vote status: %v", err)
+	}
+	key := voteKey(c, id, vote.Author)
+	var keep, flipped bool
+	err = datastore.RunInTransaction(c, func(c context.Context) error {
+		var post models.Post
+		if err := datastore.Get(c, postKey(c, id), &post); err != nil {
+			return fmt.Errorf("SubmitVote: could not find post: %w", notFound(err))
+		}
+		if locked, err := threadLocked(c, id, post); err != nil {
+			return fmt.Errorf("SubmitVote: could not find thread: %w", notFound(err))
+		} else if locked {
+			return fmt.Errorf("SubmitVote: thread is locked: %w", models.ErrLocked)
+		}
+		score := post.Score()
+		var prev *models.Vote
+		for _, k := range append(legacy, key) {
+			var v models.Vote
+			if err := datastore.Get(c, k, &v); err == datastore.ErrNoSuchEntity {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("SubmitVote: failed to retrieve vote status: %v", err)
+			}
+			prev = &v
+			if !k.Equal(key) {
+				if err := datastore.Delete(c, k); err != nil {
+					return fmt.Errorf("SubmitVote: could not replace vote: %v", err)
+				}
+			}
+		}
+		if !retract && vote.Repeats(prev) {
+			return fmt.Errorf("SubmitVote: %w", models.ErrAlreadyVoted)
+		}
+		keep = post.ApplyVote(prev, vote)
+		flipped = keep && prev != nil
+		if keep {
+			_, err = datastore.Put(c, key, &vote)
+		} else {
+			err = datastore.Delete(c, key)
+		}
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("SubmitVote: could not submit vote: %v", err)
+		}
+		if _, err := datastore.Put(c, postKey(c, id), &post); err != nil {
+			return fmt.Errorf("SubmitVote: could not update rank: %v", err)
+		}
+		if err := addKarma(c, post.Author, post.Score()-score); err != nil {
+			return fmt.Errorf("SubmitVote: could not update karma: %v", err)
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+	return keep, flipped, err
+}
+
+// GetVoteBy retrieves a vote on a post by a user.
+func (store *Store) GetVoteBy(c context.Context, id int64, author string) (models.Vote, error) {
+	var votes []models.Vote
+	if _, err := datastore.NewQuery("Vote").Filter("Author =", author).Filter("Post =", id).GetAll(c, &votes); err != nil {
+		return models.Vote{}, fmt.Errorf("GetVoteBy: could not collect votes: %v", err)
+	}
+	if len(votes) != 1 {
+		return models.Vote{}, fmt.Errorf("GetVoteBy: user has voted multiple times or never")
+	}
+	return votes[0], nil
+}
+
+// GetVotesBy retrieves the votes of a user on a batch of posts, keyed by post ID.
+// Until MigrateVotes has completed, votes stored before keys were derived from post and
+// author are looked up by a single query of the user's votes.
+func (store *Store) GetVotesBy(c context.Context, ids []int64, author string) (map[int64]models.Vote, error) {
+	keys := make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		keys[i] = voteKey(c, id, author)
+	}
+	found := make([]models.Vote, len(ids))
+	err := datastore.GetMulti(c, keys, found)
+	merr, _ := err.(appengine.MultiError)
+	if err != nil && merr == nil {
+		return nil, fmt.Errorf("GetVotesBy: could not collect votes: %v", err)
+	}
+	votes := make(map[int64]models.Vote)
+	missing := make(map[int64]bool)
+	for i, id := range ids {
+		if merr != nil && merr[i] != nil {
+			if merr[i] != datastore.ErrNoSuchEntity {
+				return nil, fmt.Errorf("GetVotesBy: could not collect votes: %v", merr[i])
+			}
+			missing[id] = true
+			continue
+		}
+		votes[id] = found[i]
+	}
+	if len(missing) == 0 {
+		return votes, nil
+	}
+	if rekeyed, err := migrationDone(c, &store.rekeyed, "votes", "Vote"); err != nil {
+		return nil, fmt.Errorf("GetVotesBy: could not check migration: %v", err)
+	} else if rekeyed {
+		return votes, nil
+	}
+	var legacy []models.Vote
+	if _, err := datastore.NewQuery("Vote").Filter("Author =", author).GetAll(c, &legacy); err != nil {
+		return nil, fmt.Errorf("GetVotesBy: could not collect votes: %v", err)
+	}
+	for _, vote := range legacy {
+		if missing[vote.Post] {
+			votes[vote.Post] = vote
+		}
+	}
+	return votes, nil
+}
+
+// HasVotedOn retrieves if the user has submitted a vote on the given post.
+func (store *Store) HasVotedOn(c context.Context, post int64, author string) (bool, error) {
+	count, err := datastore.NewQuery("Vote").Filter("Author =", author).Filter("Post =", post).Count(c)
+	if err != nil {
+		return false, fmt.Errorf("HasVotedOn: could not collect votes: %v", err)
+	}
+	return count > 0, nil
+}
+
+// NumberOfVotes calculates the number of votes a post has received. This is a relative number.
+func (store *Store) NumberOfVotes(c context.Context, id int64) (int, error) {
+	post, err := store.GetPost(c, id)
+	if err != nil {
+		return 0, fmt.Errorf("NumberOfVotes: %w", err)
+	}
+	return post.Score(), nil
+}
+
+func postKey(c context.Context, id int64) *datastore.Key {
+	return datastore.NewKey(c, "Post", "", id, nil)
+}
+
+// notFound translates missing entities into models.ErrNotFound.
+func notFound(err error) error {
+	if err == datastore.ErrNoSuchEntity {
+		return models.ErrNotFound
+	}
+	return err
+}
+
+// rankProperties maps rankings to the post property storing the rank.
+var rankProperties = map[models.Ranking]string{
+	models.Hot:  "Hot",
+	models.Top:  "Rank",
+	models.Best: "Confidence",
+}
+
+// TopPosts collects a page of top-level posts from the datastore. Since the datastore
+// can not combine an inequality filter on the score with an order on another rank,
+// posts below the minimum rank as well as removed and pinned posts are skipped while iterating.
+func (store *Store) TopPosts(c context.Context, listing models.Listing) ([]models.Post, []int64, string, error) {
+	query := datastore.NewQuery("Post").Filter("Parent =", 0)
+	if listing.Community != "" {
+		query = query.Filter("Community =", listing.Community)
+	}
+	var (
+		posts []models.Post
+		ids   []int64
+	)
+	if listing.Cursor == "" {
+		pinned, err := store.pinnedPosts(c, query, listing)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: could not collect pinned posts: %v", err)
+		}
+		for _, p := range pinned {
+			posts = append(posts, p.post)
+			ids = append(ids, p.id)
+		}
+	}
+	property := rankProperties[listing.Ranking]
+	if property != rankProperties[models.Top] {
+		// posts without the property would be left out, so fall back to the score until migrated
+		ranked, err := migrationDone(c, &store.ranked, "ranks", "Post")
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: could not check migration: %v", err)
+		} else if !ranked {
+			property = rankProperties[models.Top]
+		}
+	}
+	query = query.Order("-" + property)
+	if listing.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(listing.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: %w", models.ValidationError{{Field: "cursor", Message: "invalid cursor"}})
+		}
+		query = query.Start(cursor)
+	}
+	limit := len(posts) + listing.PageSize()
+	it := query.Run(c)
+	for len(posts) < limit {
+		var post models.Post
+		key, err := it.Next(&post)
+		if err == datastore.Done {
+			return posts, ids, "", nil
+		} else if err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: could not collect posts: %v", err)
+		}
+		if post.Pinned || !listing.Includes(post) {
+			continue
+		}
+		posts = append(posts, post)
+		ids = append(ids, key.IntID())
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("TopPosts: could not create cursor: %v", err)
+	}
+	return posts, ids, cursor.String(), nil
+}
+
+// pinnedPost is a pinned post together with its ID.
+type pinnedPost struct {
+	id   int64
+	post models.Post
+}
+
+// pinnedPosts collects the pinned posts matching the query of a listing ordered by ID.
+func (store *Store) pinnedPosts(c context.Context, query *datastore.Query, listing models.Listing) ([]pinnedPost, error) {
+	var posts []models.Post
+	keys, err := query.Filter("Pinned =", true).GetAll(c, &posts)
+	if err != nil {
+		return nil, err
+	}
+	pinned := make([]pinnedPost, 0, len(posts))
+	for i, post := range posts {
+		if listing.Includes(post) {
+			pinned = append(pinned, pinnedPost{keys[i].IntID(), post})
+		}
+	}
+	sort.Slice(pinned, func(i, j int) bool { return pinned[i].id < pinned[j].id })
+	return pinned, nil
+}
+
+// UpdateRank recomputes the denormalized counters and ranks of a post from its votes and replies.
+// The karma of the author is adjusted accordingly.
+func (store *Store) UpdateRank(c context.Context, id int64) error {
+	return updateRank(c, id, true)
+}
+
+// MigrateRanks recomputes the counters and ranks of all posts from their votes and replies.
+// Posts stored before the counters were introduced lack them and would lose their votes
+// with the next vote. The karma of the authors already counts these votes and is left as is.
+// It is idempotent and has to be run once after upgrading. It returns the number of updated posts.
+func (store *Store) MigrateRanks(c context.Context) (int, error) {
+	keys, err := datastore.NewQuery("Post").KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return 0, fmt.Errorf("MigrateRanks: could not collect posts: %v", err)
+	}
+	for i, key := range keys {
+		if err := updateRank(c, key.IntID(), false); err != nil {
+			return i, fmt.Errorf("MigrateRanks: %v", err)
+		}
+	}
+	if _, err := datastore.Put(c, migrationKey(c, "ranks"), &migration{Date: time.Now()}); err != nil {
+		return len(keys), fmt.Errorf("MigrateRanks: could not record migration: %v", err)
+	}
+	atomic.StoreInt32(&store.ranked, 1)
+	return len(keys), nil
+}
+
+// MigrateRoots sets the root of replies stored before threads were introduced to the top-level
+// post of their thread. Replies submitted below them before they were migrated are given the
+// root of the thread as well. It is idempotent and has to be run once after upgrading.
+// It returns the number of updated posts.
+func (store *Store) MigrateRoots(c context.Context) (int, error) {
+	var posts []models.Post
+	keys, err := datastore.NewQuery("Post").GetAll(c, &posts)
+	if err != nil {
+		return 0, fmt.Errorf("MigrateRoots: could not collect posts: %v", err)
+	}
+	parents := make(map[int64]int64, len(keys))
+	for i, key := range keys {
+		parents[key.IntID()] = posts[i].Parent
+	}
+	// root follows the parents up to the top-level post, stopping at missing posts
+	root := func(id int64) int64 {
+		for parent, ok := parents[id]; ok && parent != 0; parent, ok = parents[id] {
+			id = parent
+		}
+		return id
+	}
+	migrated := 0
+	for i, key := range keys {
+		if posts[i].Parent == 0 {
+			continue
+		}
+		if r := root(key.IntID()); r != posts[i].Root {
+			err := datastore.RunInTransaction(c, func(c context.Context) error {
+				var post models.Post
+				if err := datastore.Get(c, key, &post); err != nil {
+					return err
+				}
+				post.Root = r
+				_, err := datastore.Put(c, key, &post)
+				return err
+			}, nil)
+			if err != nil {
+				return migrated, fmt.Errorf("MigrateRoots: could not update post: %v", err)
+			}
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// MigrateVotes moves votes stored before keys were derived from post and author to their
+// derived key, so that they are found by GetVotesBy. If a user has votes under both keys,
+// the vote under the derived key is kept. It is idempotent and has to be run once after
+// MigrateAuthors. It returns the number of moved votes.
+func (store *Store) MigrateVotes(c context.Context) (int, error) {
+	var votes []models.Vote
+	keys, err := datastore.NewQuery("Vote").GetAll(c, &votes)
+	if err != nil {
+		return 0, fmt.Errorf("MigrateVotes: could not collect votes: %v", err)
+	}
+	migrated := 0
+	for i, key := range keys {
+		vote := votes[i]
+		derived := voteKey(c, vote.Post, vote.Author)
+		if key.Equal(derived) {
+			continue
+		}
+		err := datastore.RunInTransaction(c, func(c context.Context) error {
+			var existing models.Vote
+			if err := datastore.Get(c, derived, &existing); err == datastore.ErrNoSuchEntity {
+				if _, err := datastore.Put(c, derived, &vote); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			}
+			return datastore.Delete(c, key)
+		}, &datastore.TransactionOptions{XG: true})
+		if err != nil {
+			return migrated, fmt.Errorf("MigrateVotes: could not move vote: %v", err)
+		}
+		migrated++
+	}
+	if _, err := datastore.Put(c, migrationKey(c, "votes"), &migration{Date: time.Now()}); err != nil {
+		return migrated, fmt.Errorf("MigrateVotes: could not record migration: %v", err)
+	}
+	atomic.StoreInt32(&store.rekeyed, 1)
+	return migrated, nil
+}
+
+// migration records when a one-time migration has been completed.
+type migration struct {
+	Date time.Time
+}
+
+func migrationKey(c context.Context, name string) *datastore.Key {
+	return datastore.NewKey(c, "Migration", name, 0, nil)
+}
+
+// migrationDone reports if the entities of a kind have been migrated by the named migration,
+// either because it has completed or because there were no entities to migrate.
+// Positive results are cached in the flag.
+func migrationDone(c context.Context, flag *int32, name, kind string) (bool, error) {
+	if atomic.LoadInt32(flag) == 1 {
+		return true, nil
+	}
+	var done migration
+	if err := datastore.Get(c, migrationKey(c, name), &done); err == nil {
+		atomic.StoreInt32(flag, 1)
+		return true, nil
+	} else if err != datastore.ErrNoSuchEntity {
+		return false, err
+	}
+	keys, err := datastore.NewQuery(kind).KeysOnly().Limit(1).GetAll(c, nil)
+	if err != nil {
+		return false, err
+	} else if len(keys) > 0 {
+		return false, nil
+	}
+	// entities stored from now on do not need the migration
+	if _, err := datastore.Put(c, migrationKey(c, name), &migration{Date: time.Now()}); err != nil {
+		return false, err
+	}
+	atomic.StoreInt32(flag, 1)
+	return true, nil
+}
+
+// updateRank recomputes the counters and ranks of a post and adjusts the karma of its author if requested.
+func updateRank(c context.Context, id int64, karma bool) error {
+	var votes []models.Vote
+	if _, err := datastore.NewQuery("Vote").Filter("Post =", id).GetAll(c, &votes); err != nil {
+		return fmt.Errorf("UpdateRank: could not count votes: %v", err)
+	}
+	comments, err := datastore.NewQuery("Post").Filter("Parent =", id).Count(c)
+	if err != nil {
+		return fmt.Errorf("UpdateRank: could not count comments: %v", err)
+	}
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		var post models.Post
+		if err := datastore.Get(c, postKey(c, id), &post); err != nil {
+			return fmt.Errorf("UpdateRank: could not find post: %w", notFound(err))
+		}
+		score := post.Score()
+		post.Upvotes, post.Downvotes = 0, 0
+		for _, vote := range votes {
+			if vote.Upvote {
+				post.Upvotes++
+			} else {
+				post.Downvotes++
+			}
+		}
+		post.Comments = comments
+		post.Rerank()
+		if _, err := datastore.Put(c, postKey(c, id), &post); err != nil {
+			return fmt.Errorf("UpdateRank: could not save changes: %v", err)
+		}
+		if !karma {
+			return nil
+		}
+		if err := addKarma(c, post.Author, post.Score()-score); err != nil {
+			return fmt.Errorf("UpdateRank: could not update karma: %v", err)
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+}
+
+// SubmitPost stores a post in the datastore and updates the comment counter of its parent.
+func (store *Store) SubmitPost(c context.Context, author, text, color, community string, parent int64, anonymous bool) (int64, error) {
+	// verify input
+	post, err := models.NewPost(author, text, color, parent, anonymous)
+	if err != nil {
+		return 0, err
+	}
+	var key *datastore.Key
+	err = datastore.RunInTransaction(c, func(c context.Context) error {
+		post.Community = community
+		if parent != 0 {
+			var parentPost models.Post
+			if err := datastore.Get(c, postKey(c, parent), &parentPost); err != nil {
+				return fmt.Errorf("SubmitPost: could not find parent: %w", notFound(err))
+			}
+			root, err := resolveRoot(c, parent, parentPost)
+			if err != nil {
+				return fmt.Errorf("SubmitPost: could not find thread: %w", notFound(err))
+			}
+			post.Root = root
+			post.Community = parentPost.Community
+			if locked, err := threadLocked(c, parent, parentPost); err != nil {
+				return fmt.Errorf("SubmitPost: could not find thread: %w", notFound(err))
+			} else if locked {
+				return fmt.Errorf("SubmitPost: thread is locked: %w", models.ErrLocked)
+			}
+			parentPost.Comments++
+			if _, err := datastore.Put(c, postKey(c, parent), &parentPost); err != nil {
+				return fmt.Errorf("SubmitPost: could not update parent: %v", err)
+			}
+		}
+		if post.Community != "" {
+			var community models.Community
+			if err := datastore.Get(c, communityKey(c, post.Community), &community); err != nil {
+				return fmt.Errorf("SubmitPost: could not find community: %w", notFound(err))
+			} else if !community.Accepts(post.Author) {
+				return fmt.Errorf("SubmitPost: community does not accept posts: %w", models.ErrForbidden)
+			}
+		}
+		var err error
+		key, err = datastore.Put(c, datastore.NewIncompleteKey(c, "Post", nil), &post)
+		if err != nil {
+			return fmt.Errorf("SubmitPost: could not submit post: %v", err)
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return 0, err
+	}
+	return key.IntID(), nil
+}
+
+// NumberOfComments retrieves the number of direct replies a post has received.
+func (store *Store) NumberOfComments(c context.Context, id int64) (int, error) {
+	post, err := store.GetPost(c, id)
+	if err != nil {
+		return 0, fmt.Errorf("NumberOfComments: %w", err)
+	}
+	return post.Comments, nil
+}
+
+// GetPost retrieves a post from the datastore.
+func (store *Store) GetPost(c context.Context, id int64) (models.Post, error) {
+	var post models.Post
+	if err := datastore.Get(c, postKey(c, id), &post); err != nil {
+		return post, fmt.Errorf("GetPost: could not find post: %w", notFound(err))
+	}
+	root, err := resolveRoot(c, id, post)
+	if err != nil {
+		return post, fmt.Errorf("GetPost: could not find thread: %w", notFound(err))
+	}
+	if root != id {
+		post.Root = root
+	}
+	return post, nil
+}
+
+// resolveRoot returns the ID of the top-level post of the thread of a post. Replies stored
+// before threads were introduced have no root, it is found by following their parents.
+func resolveRoot(c context.Context, id int64, post models.Post) (int64, error) {
+	for post.Root == 0 && post.Parent != 0 {
+		id = post.Parent
+		if err := datastore.Get(c, postKey(c, id), &post); err != nil {
+			return 0, err
+		}
+	}
+	return post.ThreadRoot(id), nil
+}
+
+// GetComments retrieves all comments on the specified post ordered by rank.
+func (store *Store) GetComments(c context.Context, id int64) ([]models.Post, []int64, error) {
+	var comments []models.Post
+	keys, err := datastore.NewQuery("Post").Filter("Parent =", id).Order("Date").GetAll(c, &comments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetComments: could not collect posts: %v", err)
+	}
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.IntID()
+	}
+	return comments, ids, nil
+}
+
+// GetThread retrieves all replies in the thread of a top-level post ordered by date.
+func (store *Store) GetThread(c context.Context, id int64) ([]models.Post, []int64, error) {
+	var posts []models.Post
+	keys, err := datastore.NewQuery("Post").Filter("Root =", id).Order("Date").GetAll(c, &posts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetThread: could not collect posts: %v", err)
+	}
+	// replies stored before threads were introduced have no root property until MigrateRoots
+	// has run, they and the replies given the wrong root below them are collected by following
+	// the replies of the top-level post
+	legacy := false
+	for parents := []int64{id}; len(parents) > 0; {
+		var children []models.Post
+		childKeys, err := datastore.NewQuery("Post").Filter("Parent =", parents[0]).GetAll(c, &children)
+		if err != nil {
+			return nil, nil, fmt.Errorf("GetThread: could not collect posts: %v", err)
+		}
+		parents = parents[1:]
+		for i, child := range children {
+			if child.Root != id {
+				posts = append(posts, child)
+				keys = append(keys, childKeys[i])
+				parents = append(parents, childKeys[i].IntID())
+				legacy = true
+			}
+		}
+	}
+	if legacy {
+		sort.Stable(byDate{posts, keys})
+	}
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.IntID()
+	}
+	return posts, ids, nil
+}
+
+// byDate sorts posts and their keys by date.
+type byDate struct {
+	posts []models.Post
+	keys  []*datastore.Key
+}
+
+func (s byDate) Len() int           { return len(s.posts) }
+func (s byDate) Less(i, j int) bool { return s.posts[i].Date.Before(s.posts[j].Date) }
+func (s byDate) Swap(i, j int) {
+	s.posts[i], s.posts[j] = s.posts[j], s.posts[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+// compile-time check that Store implements models.Store
+var _ models.Store = (*Store)(nil)
@@ -0,0 +1,79 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// EditPost replaces the text of a post on behalf of its author and stores the previous text as a revision.
+// Revisions are children of their post so that both can be updated in a single transaction.
+func (store *Store) EditPost(c context.Context, author string, id int64, text string, window time.Duration) error {
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		key := postKey(c, id)
+		var post models.Post
+		if err := datastore.Get(c, key, &post); err != nil {
+			return fmt.Errorf("EditPost: could not find post: %w", notFound(err))
+		}
+		if locked, err := threadLocked(c, id, post); err != nil {
+			return fmt.Errorf("EditPost: could not find thread: %w", notFound(err))
+		} else if locked {
+			return fmt.Errorf("EditPost: thread is locked: %w", models.ErrLocked)
+		}
+		revision, err := post.Edit(author, text, window, time.Now())
+		if err != nil {
+			return err
+		}
+		revision.Post = id
+		if _, err := datastore.Put(c, datastore.NewIncompleteKey(c, "Revision", key), &revision); err != nil {
+			return fmt.Errorf("EditPost: could not store revision: %v", err)
+		}
+		if _, err := datastore.Put(c, key, &post); err != nil {
+			return fmt.Errorf("EditPost: could not update post: %v", err)
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+}
+
+// DeletePost clears the text and revisions of a post on behalf of its author.
+func (store *Store) DeletePost(c context.Context, author string, id int64) error {
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		key := postKey(c, id)
+		var post models.Post
+		if err := datastore.Get(c, key, &post); err != nil {
+			return fmt.Errorf("DeletePost: could not find post: %w", notFound(err))
+		}
+		if err := post.Delete(author); err != nil {
+			return err
+		}
+		keys, err := datastore.NewQuery("Revision").Ancestor(key).KeysOnly().GetAll(c, nil)
+		if err != nil {
+			return fmt.Errorf("DeletePost: could not collect revisions: %v", err)
+		}
+		if err := datastore.DeleteMulti(c, keys); err != nil {
+			return fmt.Errorf("DeletePost: could not delete revisions: %v", err)
+		}
+		if _, err := datastore.Put(c, key, &post); err != nil {
+			return fmt.Errorf("DeletePost: could not update post: %v", err)
+		}
+		return nil
+	}, nil)
+}
+
+// Revisions retrieves the previous versions of the text of a post ordered by date.
+func (store *Store) Revisions(c context.Context, id int64) ([]models.Revision, error) {
+	if _, err := store.GetPost(c, id); err != nil {
+		return nil, fmt.Errorf("Revisions: %w", err)
+	}
+	revisions := make([]models.Revision, 0)
+	if _, err := datastore.NewQuery("Revision").Ancestor(postKey(c, id)).GetAll(c, &revisions); err != nil {
+		return nil, fmt.Errorf("Revisions: could not collect revisions: %v", err)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Date.Before(revisions[j].Date) })
+	return revisions, nil
+}
@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// Moderate applies a moderation action to a post and records it in the audit log.
+// Locks are applied to the top-level post of the thread. Approving or removing a post
+// deletes its pending reports. Audit log entries are children of their post so that
+// both can be updated in a single transaction.
+func (store *Store) Moderate(c context.Context, action models.ModAction) error {
+	if action.Thread() {
+		post, err := store.GetPost(c, action.Post)
+		if err != nil {
+			return fmt.Errorf("Moderate: %w", err)
+		}
+		action.Post = post.ThreadRoot(action.Post)
+	}
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		key := postKey(c, action.Post)
+		var post models.Post
+		if err := datastore.Get(c, key, &post); err != nil {
+			return fmt.Errorf("Moderate: could not find post: %w", notFound(err))
+		}
+		if err := action.Apply(&post); err != nil {
+			return err
+		}
+		if _, err := datastore.Put(c, key, &post); err != nil {
+			return fmt.Errorf("Moderate: could not update post: %v", err)
+		}
+		if _, err := datastore.Put(c, datastore.NewIncompleteKey(c, "ModAction", key), &action); err != nil {
+			return fmt.Errorf("Moderate: could not record action: %v", err)
+		}
+		if action.Resolves() {
+			keys, err := datastore.NewQuery("Report").Ancestor(key).KeysOnly().GetAll(c, nil)
+			if err != nil {
+				return fmt.Errorf("Moderate: could not collect reports: %v", err)
+			}
+			if err := datastore.DeleteMulti(c, keys); err != nil {
+				return fmt.Errorf("Moderate: could not resolve reports: %v", err)
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// ModerationLog collects a page of the moderation audit log, newest first.
+func (store *Store) ModerationLog(c context.Context, log models.ModLog) ([]models.ModAction, string, error) {
+	query := datastore.NewQuery("ModAction").Order("-Date")
+	if log.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(log.Cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("ModerationLog: %w", models.ValidationError{{Field: "cursor", Message: "invalid cursor"}})
+		}
+		query = query.Start(cursor)
+	}
+	actions := make([]models.ModAction, 0)
+	it := query.Limit(log.PageSize()).Run(c)
+	for {
+		var action models.ModAction
+		if _, err := it.Next(&action); err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, "", fmt.Errorf("ModerationLog: could not collect entries: %v", err)
+		}
+		actions = append(actions, action)
+	}
+	if len(actions) < log.PageSize() {
+		return actions, "", nil
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return nil, "", fmt.Errorf("ModerationLog: could not create cursor: %v", err)
+	}
+	return actions, cursor.String(), nil
+}
@@ -0,0 +1,68 @@
+package datastore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// PostsBy collects a page of a user's posts or comments, newest first. Since the datastore
+// can not filter on the parent while ordering by date, other posts are skipped while iterating.
+func (store *Store) PostsBy(c context.Context, author string, history models.History) ([]models.Post, []int64, string, error) {
+	query := datastore.NewQuery("Post").Filter("Author =", author).Order("-Date")
+	if history.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(history.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("PostsBy: %w", models.ValidationError{{Field: "cursor", Message: "invalid cursor"}})
+		}
+		query = query.Start(cursor)
+	}
+	var (
+		posts []models.Post
+		ids   []int64
+	)
+	limit := history.PageSize()
+	it := query.Run(c)
+	for len(posts) < limit {
+		var post models.Post
+		key, err := it.Next(&post)
+		if err == datastore.Done {
+			return posts, ids, "", nil
+		} else if err != nil {
+			return nil, nil, "", fmt.Errorf("PostsBy: could not collect posts: %v", err)
+		}
+		if !history.Includes(post) {
+			continue
+		}
+		posts = append(posts, post)
+		ids = append(ids, key.IntID())
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("PostsBy: could not create cursor: %v", err)
+	}
+	return posts, ids, cursor.String(), nil
+}
+
+// GetStats summarizes the posts, karma and votes of a user.
+func (store *Store) GetStats(c context.Context, author string) (models.UserStats, error) {
+	var stats models.UserStats
+	var posts []models.Post
+	if _, err := datastore.NewQuery("Post").Filter("Author =", author).GetAll(c, &posts); err != nil {
+		return stats, fmt.Errorf("GetStats: could not collect posts: %v", err)
+	}
+	for _, post := range posts {
+		stats.Tally(post)
+	}
+	var err error
+	if stats.Upvotes, err = datastore.NewQuery("Vote").Filter("Author =", author).Filter("Upvote =", true).Count(c); err != nil {
+		return stats, fmt.Errorf("GetStats: could not count votes: %v", err)
+	}
+	if stats.Downvotes, err = datastore.NewQuery("Vote").Filter("Author =", author).Filter("Upvote =", false).Count(c); err != nil {
+		return stats, fmt.Errorf("GetStats: could not count votes: %v", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// reportKey derives the key of a user's report of a post. Reports are children of
+// their post so that both can be updated in a single transaction.
+func reportKey(c context.Context, id int64, reporter string) *datastore.Key {
+	return datastore.NewKey(c, "Report", reporter, 0, postKey(c, id))
+}
+
+// SubmitReport records a user's report of a post and hides the post once its pending reports reach the threshold.
+func (store *Store) SubmitReport(c context.Context, report models.Report, threshold int) (models.Post, error) {
+	var post models.Post
+	err := datastore.RunInTransaction(c, func(c context.Context) error {
+		key := postKey(c, report.Post)
+		if err := datastore.Get(c, key, &post); err != nil {
+			return fmt.Errorf("SubmitReport: could not find post: %w", notFound(err))
+		}
+		rkey := reportKey(c, report.Post, report.Reporter)
+		var prev models.Report
+		if err := datastore.Get(c, rkey, &prev); err == nil {
+			return nil
+		} else if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("SubmitReport: failed to retrieve report status: %v", err)
+		}
+		if _, err := datastore.Put(c, rkey, &report); err != nil {
+			return fmt.Errorf("SubmitReport: could not store report: %v", err)
+		}
+		post.AddReport(threshold)
+		if _, err := datastore.Put(c, key, &post); err != nil {
+			return fmt.Errorf("SubmitReport: could not update post: %v", err)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return models.Post{}, err
+	}
+	return post, nil
+}
+
+// ReportedPosts collects a page of the posts with pending reports ordered by ID.
+// The inequality filter prevents ordering by key, so the queue is sorted in memory
+// and cursors point behind the ID of the last post.
+func (store *Store) ReportedPosts(c context.Context, queue models.ReportQueue) ([]models.Post, []int64, string, error) {
+	var after int64
+	if queue.Cursor != "" {
+		_, id, err := models.DecodeCursor(queue.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("ReportedPosts: %w", err)
+		}
+		after = id
+	}
+	keys, err := datastore.NewQuery("Post").Filter("Reports >", 0).KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("ReportedPosts: could not collect posts: %v", err)
+	}
+	ids := make([]int64, 0, len(keys))
+	for _, key := range keys {
+		if key.IntID() > after {
+			ids = append(ids, key.IntID())
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var next string
+	if len(ids) > queue.PageSize() {
+		ids = ids[:queue.PageSize()]
+		next = models.EncodeCursor(0, ids[len(ids)-1])
+	}
+	posts := make([]models.Post, len(ids))
+	keys = make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		keys[i] = postKey(c, id)
+	}
+	if err := datastore.GetMulti(c, keys, posts); err != nil {
+		return nil, nil, "", fmt.Errorf("ReportedPosts: could not collect posts: %v", err)
+	}
+	return posts, ids, next, nil
+}
+
+// GetReports retrieves the pending reports on a batch of posts ordered by date, keyed by post ID.
+func (store *Store) GetReports(c context.Context, ids []int64) (map[int64][]models.Report, error) {
+	reports := make(map[int64][]models.Report)
+	for _, id := range ids {
+		var found []models.Report
+		if _, err := datastore.NewQuery("Report").Ancestor(postKey(c, id)).GetAll(c, &found); err != nil {
+			return nil, fmt.Errorf("GetReports: could not collect reports: %v", err)
+		}
+		if len(found) == 0 {
+			continue
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i].Date.Before(found[j].Date) })
+		reports[id] = found
+	}
+	return reports, nil
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// tokenKey derives the key of an API token from the hash of its secret.
+func tokenKey(c context.Context, hash string) *datastore.Key {
+	return datastore.NewKey(c, "Token", hash, 0, nil)
+}
+
+// CreateToken stores a new API token.
+func (store *Store) CreateToken(c context.Context, token models.Token) error {
+	if _, err := datastore.Put(c, tokenKey(c, token.Hash), &token); err != nil {
+		return fmt.Errorf("CreateToken: could not store token: %v", err)
+	}
+	return nil
+}
+
+// GetToken retrieves an API token by the hash of its secret.
+func (store *Store) GetToken(c context.Context, hash string) (models.Token, error) {
+	var token models.Token
+	if err := datastore.Get(c, tokenKey(c, hash), &token); err != nil {
+		return token, fmt.Errorf("GetToken: could not find token: %w", notFound(err))
+	}
+	return token, nil
+}
+
+// TokensBy retrieves all API tokens of a user ordered by creation date.
+func (store *Store) TokensBy(c context.Context, owner string) ([]models.Token, error) {
+	tokens := make([]models.Token, 0)
+	if _, err := datastore.NewQuery("Token").Filter("Owner =", owner).GetAll(c, &tokens); err != nil {
+		return nil, fmt.Errorf("TokensBy: could not collect tokens: %v", err)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+	return tokens, nil
+}
+
+// RevokeToken deletes an API token of a user.
+func (store *Store) RevokeToken(c context.Context, owner, hash string) error {
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		key := tokenKey(c, hash)
+		var token models.Token
+		if err := datastore.Get(c, key, &token); err != nil {
+			return fmt.Errorf("RevokeToken: could not find token: %w", notFound(err))
+		}
+		if token.Owner != owner {
+			return fmt.Errorf("RevokeToken: could not find token: %w", models.ErrNotFound)
+		}
+		if err := datastore.Delete(c, key); err != nil {
+			return fmt.Errorf("RevokeToken: could not delete token: %v", err)
+		}
+		return nil
+	}, nil)
+}
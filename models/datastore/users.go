@@ -0,0 +1,235 @@
+package datastore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// userRef points from a unique login or handle to a user. Refs are keyed by the
+// login or handle to enforce uniqueness inside transactions.
+type userRef struct {
+	User string
+}
+
+func userKey(c context.Context, id string) *datastore.Key {
+	return datastore.NewKey(c, "User", id, 0, nil)
+}
+
+func loginKey(c context.Context, login string) *datastore.Key {
+	return datastore.NewKey(c, "Login", login, 0, nil)
+}
+
+func handleKey(c context.Context, handle string) *datastore.Key {
+	return datastore.NewKey(c, "Handle", handle, 0, nil)
+}
+
+// EnsureUser retrieves the user with the given login, creating a user with
+// a generated handle on their first login.
+func (store *Store) EnsureUser(c context.Context, login string) (models.User, error) {
+	var ref userRef
+	if err := datastore.Get(c, loginKey(c, login), &ref); err == nil {
+		return store.GetUser(c, ref.User)
+	} else if err != datastore.ErrNoSuchEntity {
+		return models.User{}, fmt.Errorf("EnsureUser: could not look up login: %v", err)
+	}
+	user, err := models.NewUser(login)
+	if err != nil {
+		return user, err
+	}
+	err = datastore.RunInTransaction(c, func(c context.Context) error {
+		var ref userRef
+		if err := datastore.Get(c, loginKey(c, login), &ref); err == nil {
+			// created by a concurrent request
+			return datastore.Get(c, userKey(c, ref.User), &user)
+		} else if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("EnsureUser: could not look up login: %v", err)
+		}
+		for attempt := 0; ; attempt++ {
+			if err := datastore.Get(c, handleKey(c, user.Handle), &ref); err == datastore.ErrNoSuchEntity {
+				break
+			} else if err != nil {
+				return fmt.Errorf("EnsureUser: could not look up handle: %v", err)
+			}
+			if err := user.RegenerateHandle(attempt); err != nil {
+				return err
+			}
+		}
+		keys := []*datastore.Key{userKey(c, user.ID), loginKey(c, login), handleKey(c, user.Handle)}
+		if _, err := datastore.PutMulti(c, keys, []interface{}{&user, &userRef{user.ID}, &userRef{user.ID}}); err != nil {
+			return fmt.Errorf("EnsureUser: could not store user: %v", err)
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+	return user, err
+}
+
+// GetUser retrieves a user by ID.
+func (store *Store) GetUser(c context.Context, id string) (models.User, error) {
+	var user models.User
+	if err := datastore.Get(c, userKey(c, id), &user); err != nil {
+		return user, fmt.Errorf("GetUser: could not find user: %w", notFound(err))
+	}
+	return user, nil
+}
+
+// GetUserByHandle retrieves a user by handle.
+func (store *Store) GetUserByHandle(c context.Context, handle string) (models.User, error) {
+	var ref userRef
+	if err := datastore.Get(c, handleKey(c, handle), &ref); err != nil {
+		return models.User{}, fmt.Errorf("GetUserByHandle: could not find user: %w", notFound(err))
+	}
+	return store.GetUser(c, ref.User)
+}
+
+// GetUsers retrieves a batch of users, keyed by ID. Unknown IDs are skipped.
+func (store *Store) GetUsers(c context.Context, ids []string) (models.Users, error) {
+	keys := make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		keys[i] = userKey(c, id)
+	}
+	found := make([]models.User, len(ids))
+	err := datastore.GetMulti(c, keys, found)
+	merr, _ := err.(appengine.MultiError)
+	if err != nil && merr == nil {
+		return nil, fmt.Errorf("GetUsers: could not collect users: %v", err)
+	}
+	users := make(models.Users, len(ids))
+	for i, id := range ids {
+		if merr != nil && merr[i] != nil {
+			if merr[i] != datastore.ErrNoSuchEntity {
+				return nil, fmt.Errorf("GetUsers: could not collect users: %v", merr[i])
+			}
+			continue
+		}
+		users[id] = found[i]
+	}
+	return users, nil
+}
+
+// SetHandle changes the handle of a user, failing if it is already taken.
+func (store *Store) SetHandle(c context.Context, id, handle string) error {
+	handle, err := models.NormalizeHandle(handle)
+	if err != nil {
+		return err
+	}
+	return datastore.RunInTransaction(c, func(c context.Context) error {
+		var user models.User
+		if err := datastore.Get(c, userKey(c, id), &user); err != nil {
+			return fmt.Errorf("SetHandle: could not find user: %w", notFound(err))
+		}
+		if user.Handle == handle {
+			return nil
+		}
+		var ref userRef
+		if err := datastore.Get(c, handleKey(c, handle), &ref); err == nil {
+			return fmt.Errorf("SetHandle: handle is already taken")
+		} else if err != datastore.ErrNoSuchEntity {
+			return fmt.Errorf("SetHandle: could not look up handle: %v", err)
+		}
+		if err := datastore.Delete(c, handleKey(c, user.Handle)); err != nil {
+			return fmt.Errorf("SetHandle: could not release handle: %v", err)
+		}
+		user.Handle = handle
+		keys := []*datastore.Key{userKey(c, id), handleKey(c, handle)}
+		if _, err := datastore.PutMulti(c, keys, []interface{}{&user, &userRef{id}}); err != nil {
+			return fmt.Errorf("SetHandle: could not update handle: %v", err)
+		}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+}
+
+// MigrateAuthors replaces the logins stored as author of posts and votes and as owner
+// of tokens before users were introduced by the IDs of users created for them.
+// It is idempotent and has to be run once after upgrading. It returns the number
+// of migrated entities.
+func (store *Store) MigrateAuthors(c context.Context) (int, error) {
+	ids := make(map[string]string)
+	// resolve returns the user ID for a stored author and whether it has to be replaced.
+	resolve := func(author string) (string, bool, error) {
+		if id, ok := ids[author]; ok {
+			return id, id != author, nil
+		}
+		if _, err := store.GetUser(c, author); err == nil {
+			ids[author] = author
+			return author, false, nil
+		}
+		user, err := store.EnsureUser(c, author)
+		if err != nil {
+			return "", false, err
+		}
+		ids[author] = user.ID
+		return user.ID, true, nil
+	}
+	migrated := 0
+	var posts []models.Post
+	postKeys, err := datastore.NewQuery("Post").GetAll(c, &posts)
+	if err != nil {
+		return migrated, fmt.Errorf("MigrateAuthors: could not collect posts: %v", err)
+	}
+	for i, post := range posts {
+		id, replace, err := resolve(post.Author)
+		if err != nil {
+			return migrated, fmt.Errorf("MigrateAuthors: %v", err)
+		} else if !replace {
+			continue
+		}
+		post.Author = id
+		if _, err := datastore.Put(c, postKeys[i], &post); err != nil {
+			return migrated, fmt.Errorf("MigrateAuthors: could not update post: %v", err)
+		}
+		migrated++
+	}
+	var votes []models.Vote
+	voteKeys, err := datastore.NewQuery("Vote").GetAll(c, &votes)
+	if err != nil {
+		return migrated, fmt.Errorf("MigrateAuthors: could not collect votes: %v", err)
+	}
+	for i, vote := range votes {
+		id, replace, err := resolve(vote.Author)
+		if err != nil {
+			return migrated, fmt.Errorf("MigrateAuthors: %v", err)
+		} else if !replace {
+			continue
+		}
+		key := voteKeys[i]
+		derived := key.StringID() == vote.Author
+		vote.Author = id
+		if derived {
+			// votes keyed by author have to be moved to a key derived from the user ID
+			key = voteKey(c, vote.Post, id)
+		}
+		if _, err := datastore.Put(c, key, &vote); err != nil {
+			return migrated, fmt.Errorf("MigrateAuthors: could not update vote: %v", err)
+		}
+		if derived {
+			if err := datastore.Delete(c, voteKeys[i]); err != nil {
+				return migrated, fmt.Errorf("MigrateAuthors: could not replace vote: %v", err)
+			}
+		}
+		migrated++
+	}
+	var tokens []models.Token
+	tokenKeys, err := datastore.NewQuery("Token").GetAll(c, &tokens)
+	if err != nil {
+		return migrated, fmt.Errorf("MigrateAuthors: could not collect tokens: %v", err)
+	}
+	for i, token := range tokens {
+		id, replace, err := resolve(token.Owner)
+		if err != nil {
+			return migrated, fmt.Errorf("MigrateAuthors: %v", err)
+		} else if !replace {
+			continue
+		}
+		token.Owner = id
+		if _, err := datastore.Put(c, tokenKeys[i], &token); err != nil {
+			return migrated, fmt.Errorf("MigrateAuthors: could not update token: %v", err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
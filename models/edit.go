@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeletedText replaces the text and author of posts deleted by their author.
+const DeletedText = "[deleted]"
+
+// DefaultEditWindow is the time after submitting a post during which its author may edit it.
+const DefaultEditWindow = time.Hour
+
+// Revision is a previous version of the text of an edited post.
+type Revision struct {
+	Post int64
+	Text string
+	// Date is the time the text was replaced.
+	Date time.Time
+}
+
+// Edit replaces the text of the post on behalf of the user and returns the revision
+// preserving the previous text. It fails if the user is not the author, if the edit
+// window has passed, if the post has been removed or deleted or if it is hidden pending
+// review. Edits never expire if the window is negative.
+func (post *Post) Edit(user, text string, window time.Duration, now time.Time) (Revision, error) {
+	text, err := ValidateText(text)
+	if err != nil {
+		return Revision{}, err
+	}
+	if err := post.checkAuthor(user); err != nil {
+		return Revision{}, fmt.Errorf("EditPost: %w", err)
+	}
+	if post.Hidden {
+		return Revision{}, fmt.Errorf("EditPost: post is hidden pending review: %w", ErrLocked)
+	}
+	if window >= 0 && now.Sub(post.Date) > window {
+		return Revision{}, fmt.Errorf("EditPost: post can only be edited within %v: %w", window, ErrLocked)
+	}
+	revision := Revision{Text: post.Text, Date: now}
+	post.Text = text
+	post.Revisions++
+	return revision, nil
+}
+
+// Delete clears the text of the post on behalf of the user. Its replies are kept.
+// It fails if the user is not the author or if the post has been removed or deleted.
+func (post *Post) Delete(user string) error {
+	if err := post.checkAuthor(user); err != nil {
+		return fmt.Errorf("DeletePost: %w", err)
+	}
+	post.Text = ""
+	post.Revisions = 0
+	post.Deleted = true
+	return nil
+}
+
+// Editable reports if the user may still edit the post at the given time.
+func (post Post) Editable(user string, window time.Duration, now time.Time) bool {
+	return post.checkAuthor(user) == nil && !post.Hidden && (window < 0 || now.Sub(post.Date) <= window)
+}
+
+// checkAuthor verifies that the user may change the post. It fails with ErrForbidden
+// for other users and with ErrLocked for deleted or removed posts.
+func (post Post) checkAuthor(user string) error {
+	switch {
+	case user == "" || post.Author != user:
+		return fmt.Errorf("only the author can change a post: %w", ErrForbidden)
+	case post.Deleted:
+		return fmt.Errorf("post has been deleted: %w", ErrLocked)
+	case post.Removed:
+		return fmt.Errorf("post has been removed: %w", ErrLocked)
+	}
+	return nil
+}
+
+// JSONRevision is a JSON representation of a Revision.
+type JSONRevision struct {
+	Text string `json:"text"`
+	Date int64  `json:"time"`
+}
+
+// ToJSONRevisions converts revisions into their JSON representation.
+func ToJSONRevisions(revisions []Revision) []JSONRevision {
+	entries := make([]JSONRevision, len(revisions))
+	for i, revision := range revisions {
+		entries[i] = JSONRevision{
+			Text: revision.Text,
+			Date: revision.Date.Unix(),
+		}
+	}
+	return entries
+}
@@ -0,0 +1,19 @@
+package models
+
+import "errors"
+
+// Errors returned by stores and model functions. They are wrapped with the context of
+// the failed operation and can be detected using errors.Is.
+var (
+	// ErrNotFound is returned if a requested post, user or other entity does not exist.
+	ErrNotFound = errors.New("no such entity")
+	// ErrAlreadyVoted is returned by CastVote if the user already voted the same way on the post.
+	ErrAlreadyVoted = errors.New("already voted")
+	// ErrInvalidInput is returned if user input is rejected, see ValidationError for details on the fields.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrForbidden is returned if the user is not allowed to change a post or to post in a community.
+	ErrForbidden = errors.New("forbidden")
+	// ErrLocked is returned if a post can no longer be changed, because its thread is locked,
+	// because it has been removed or deleted or because its edit window has passed.
+	ErrLocked = errors.New("locked")
+)
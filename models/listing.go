@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// collection of listing page sizes
+const (
+	DefaultPageSize = 30
+	MaxPageSize     = 100
+)
+
+// Listing selects a page of top-level posts.
+type Listing struct {
+	// Ranking orders the posts.
+	Ranking Ranking
+	// Limit is the maximum number of posts on the page.
+	Limit int
+	// MinRank excludes posts with a raw score below it.
+	MinRank float64
+	// Cursor continues a previous listing, empty to start from the top.
+	Cursor string
+	// Community restricts the listing to the posts of a community, empty to list all posts.
+	Community string
+}
+
+// Includes reports if the top-level post belongs on the pages of the listing, either
+// ranked or pinned. Pinned posts are not subject to MinRank.
+func (listing Listing) Includes(post Post) bool {
+	if post.Removed || post.Hidden || post.Deleted || listing.Community != "" && post.Community != listing.Community {
+		return false
+	}
+	return post.Pinned || post.Rank >= listing.MinRank
+}
+
+// PageSize returns the limit of the listing bounded by MaxPageSize.
+func (listing Listing) PageSize() int {
+	if listing.Limit <= 0 {
+		return DefaultPageSize
+	} else if listing.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return listing.Limit
+}
+
+// EncodeCursor creates an opaque cursor pointing behind the post with the given rank and ID.
+func EncodeCursor(rank float64, id int64) string {
+	raw := strconv.FormatFloat(rank, 'g', -1, 64) + ":" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor extracts the rank and ID from a cursor created by EncodeCursor.
+func DecodeCursor(cursor string) (float64, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, invalidField("cursor", "invalid cursor: %v", err)
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, invalidField("cursor", "invalid cursor")
+	}
+	rank, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, invalidField("cursor", "invalid cursor: %v", err)
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, invalidField("cursor", "invalid cursor: %v", err)
+	}
+	return rank, id, nil
+}
@@ -0,0 +1,31 @@
+package memory
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// CreateAccount stores a new local account, failing if the name is already taken.
+func (store *Store) CreateAccount(c context.Context, account models.Account) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.accounts[account.Name]; ok {
+		return fmt.Errorf("CreateAccount: name is already taken")
+	}
+	store.accounts[account.Name] = account
+	return nil
+}
+
+// GetAccount retrieves a local account by name.
+func (store *Store) GetAccount(c context.Context, name string) (models.Account, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	account, ok := store.accounts[name]
+	if !ok {
+		return account, fmt.Errorf("GetAccount: could not find account: %w", models.ErrNotFound)
+	}
+	return account, nil
+}
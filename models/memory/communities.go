@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// CreateCommunity stores a new community, failing if the slug is already taken.
+func (store *Store) CreateCommunity(c context.Context, community models.Community) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.communities[community.Slug]; ok {
+		return fmt.Errorf("CreateCommunity: slug is already taken")
+	}
+	store.communities[community.Slug] = community
+	return nil
+}
+
+// GetCommunity retrieves a community by slug.
+func (store *Store) GetCommunity(c context.Context, slug string) (models.Community, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	community, ok := store.communities[slug]
+	if !ok {
+		return community, fmt.Errorf("GetCommunity: could not find community: %w", models.ErrNotFound)
+	}
+	return community, nil
+}
+
+// Communities retrieves all communities ordered by slug.
+func (store *Store) Communities(c context.Context) ([]models.Community, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	communities := make([]models.Community, 0, len(store.communities))
+	for _, community := range store.communities {
+		communities = append(communities, community)
+	}
+	sort.Slice(communities, func(i, j int) bool {
+		return communities[i].Slug < communities[j].Slug
+	})
+	return communities, nil
+}
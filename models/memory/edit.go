@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// EditPost replaces the text of a post on behalf of its author and stores the previous text as a revision.
+func (store *Store) EditPost(c context.Context, author string, id int64, text string, window time.Duration) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return fmt.Errorf("EditPost: could not find post: %w", models.ErrNotFound)
+	}
+	if store.posts[post.ThreadRoot(id)].Locked {
+		return fmt.Errorf("EditPost: thread is locked: %w", models.ErrLocked)
+	}
+	revision, err := post.Edit(author, text, window, time.Now())
+	if err != nil {
+		return err
+	}
+	revision.Post = id
+	store.revisions[id] = append(store.revisions[id], revision)
+	store.posts[id] = post
+	return nil
+}
+
+// DeletePost clears the text and revisions of a post on behalf of its author.
+func (store *Store) DeletePost(c context.Context, author string, id int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return fmt.Errorf("DeletePost: could not find post: %w", models.ErrNotFound)
+	}
+	if err := post.Delete(author); err != nil {
+		return err
+	}
+	delete(store.revisions, id)
+	store.posts[id] = post
+	return nil
+}
+
+// Revisions retrieves the previous versions of the text of a post ordered by date.
+func (store *Store) Revisions(c context.Context, id int64) ([]models.Revision, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if _, ok := store.posts[id]; !ok {
+		return nil, fmt.Errorf("Revisions: could not find post: %w", models.ErrNotFound)
+	}
+	return append([]models.Revision{}, store.revisions[id]...), nil
+}
@@ -0,0 +1,374 @@
+// Package memory implements models.Store in memory for tests and local development.
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// voteKey identifies a user's vote on a post.
+type voteKey struct {
+	post   int64
+	author string
+}
+
+// Store is a concurrency-safe in-memory models.Store.
+type Store struct {
+	mu       sync.RWMutex
+	posts    map[int64]models.Post
+	votes    map[voteKey]models.Vote
+	tokens   map[string]models.Token
+	accounts map[string]models.Account
+	users    map[string]models.User
+	// communities are keyed by slug
+	communities map[string]models.Community
+	// modlog is the moderation audit log, oldest first
+	modlog []models.ModAction
+	// reports are pending reports keyed by post and reporter
+	reports map[voteKey]models.Report
+	// revisions are the previous texts of edited posts, oldest first
+	revisions map[int64][]models.Revision
+	// logins and handles map to user IDs
+	logins   map[string]string
+	handles  map[string]string
+	nextPost int64
+}
+
+// New initializes a new empty in-memory store.
+func New() *Store {
+	return &Store{
+		posts:       make(map[int64]models.Post),
+		votes:       make(map[voteKey]models.Vote),
+		tokens:      make(map[string]models.Token),
+		accounts:    make(map[string]models.Account),
+		users:       make(map[string]models.User),
+		communities: make(map[string]models.Community),
+		reports:     make(map[voteKey]models.Report),
+		revisions:   make(map[int64][]models.Revision),
+		logins:      make(map[string]string),
+		handles:     make(map[string]string),
+	}
+}
+
+// GetKarma retrieves the amount of karma a user has earned.
+func (store *Store) GetKarma(c context.Context, author string) (int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user, ok := store.users[author]
+	if !ok {
+		return 0, fmt.Errorf("GetKarma: could not find user: %w", models.ErrNotFound)
+	}
+	return user.Karma, nil
+}
+
+// ReconcileKarma recomputes the karma of all users from the votes on their posts.
+func (store *Store) ReconcileKarma(c context.Context) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	karma := make(map[string]int)
+	for key, vote := range store.votes {
+		author := store.posts[key.post].Author
+		if vote.Upvote {
+			karma[author]++
+		} else {
+			karma[author]--
+		}
+	}
+	corrected := 0
+	for id, user := range store.users {
+		if user.Karma != karma[id] {
+			user.Karma = karma[id]
+			store.users[id] = user
+			corrected++
+		}
+	}
+	return corrected, nil
+}
+
+// addKarma adjusts the karma of a user. The caller must hold the write lock.
+func (store *Store) addKarma(author string, delta int) {
+	user, ok := store.users[author]
+	if !ok || delta == 0 {
+		return
+	}
+	user.Karma += delta
+	store.users[author] = user
+}
+
+// SubmitVote atomically toggles a user's vote on a post and updates the vote counters and rank of the post
+// as well as the karma of its author.
+func (store *Store) SubmitVote(c context.Context, author string, id int64, upvote bool) (bool, error) {
+	keep, _, err := store.submitVote(author, id, upvote, true)
+	return keep, err
+}
+
+// CastVote casts a vote like SubmitVote, but fails if the user already voted the same way.
+// It reports whether an opposite vote was flipped instead of a new vote being cast.
+func (store *Store) CastVote(c context.Context, author string, id int64, upvote bool) (bool, error) {
+	_, flipped, err := store.submitVote(author, id, upvote, false)
+	return flipped, err
+}
+
+// submitVote applies a vote, a repeated vote is retracted if retract is set.
+// It reports whether the user has a vote on the post afterwards and whether an opposite vote was flipped.
+func (store *Store) submitVote(author string, id int64, upvote, retract bool) (bool, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return false, false, fmt.Errorf("SubmitVote: could not find post: %w", models.ErrNotFound)
+	}
+	if store.posts[post.ThreadRoot(id)].Locked {
+		return false, false, fmt.Errorf("SubmitVote: thread is locked: %w", models.ErrLocked)
+	}
+	// verify input
+	vote, err := models.NewVote(author, id, upvote)
+	if err != nil {
+		return false, false, err
+	}
+	key := voteKey{id, vote.Author}
+	var prev *models.Vote
+	if v, ok := store.votes[key]; ok {
+		prev = &v
+	}
+	if !retract && vote.Repeats(prev) {
+		return false, false, fmt.Errorf("SubmitVote: %w", models.ErrAlreadyVoted)
+	}
+	score := post.Score()
+	keep := post.ApplyVote(prev, vote)
+	if keep {
+		store.votes[key] = vote
+	} else {
+		delete(store.votes, key)
+	}
+	store.posts[id] = post
+	store.addKarma(post.Author, post.Score()-score)
+	return keep, keep && prev != nil, nil
+}
+
+// GetVoteBy retrieves a vote on a post by a user.
+func (store *Store) GetVoteBy(c context.Context, id int64, author string) (models.Vote, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	vote, ok := store.votes[voteKey{id, author}]
+	if !ok {
+		return models.Vote{}, fmt.Errorf("GetVoteBy: user has voted multiple times or never")
+	}
+	return vote, nil
+}
+
+// GetVotesBy retrieves the votes of a user on a batch of posts, keyed by post ID.
+func (store *Store) GetVotesBy(c context.Context, ids []int64, author string) (map[int64]models.Vote, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	votes := make(map[int64]models.Vote)
+	for _, id := range ids {
+		if vote, ok := store.votes[voteKey{id, author}]; ok {
+			votes[id] = vote
+		}
+	}
+	return votes, nil
+}
+
+// HasVotedOn retrieves if the user has submitted a vote on the given post.
+func (store *Store) HasVotedOn(c context.Context, post int64, author string) (bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	_, ok := store.votes[voteKey{post, author}]
+	return ok, nil
+}
+
+// NumberOfVotes calculates the number of votes a post has received. This is a relative number.
+func (store *Store) NumberOfVotes(c context.Context, id int64) (int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return 0, fmt.Errorf("NumberOfVotes: could not find post: %w", models.ErrNotFound)
+	}
+	return post.Score(), nil
+}
+
+// TopPosts collects a page of top-level posts.
+func (store *Store) TopPosts(c context.Context, listing models.Listing) ([]models.Post, []int64, string, error) {
+	ranking := listing.Ranking
+	afterRank, afterID := 0.0, int64(0)
+	if listing.Cursor != "" {
+		var err error
+		if afterRank, afterID, err = models.DecodeCursor(listing.Cursor); err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: %w", err)
+		}
+	}
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	ids := store.filter(func(p models.Post) bool {
+		return p.Parent == 0 && !p.Pinned && listing.Includes(p)
+	})
+	sort.SliceStable(ids, func(i, j int) bool {
+		return ranking.Of(store.posts[ids[i]]) > ranking.Of(store.posts[ids[j]])
+	})
+	if listing.Cursor != "" {
+		ids = ids[sort.Search(len(ids), func(i int) bool {
+			rank := ranking.Of(store.posts[ids[i]])
+			return rank < afterRank || rank == afterRank && ids[i] > afterID
+		}):]
+	}
+	var next string
+	if limit := listing.PageSize(); len(ids) > limit {
+		ids = ids[:limit]
+		last := ids[limit-1]
+		next = models.EncodeCursor(ranking.Of(store.posts[last]), last)
+	}
+	if listing.Cursor == "" {
+		pinned := store.filter(func(p models.Post) bool {
+			return p.Parent == 0 && p.Pinned && listing.Includes(p)
+		})
+		ids = append(pinned, ids...)
+	}
+	return store.collect(ids), ids, next, nil
+}
+
+// UpdateRank recomputes the denormalized counters and ranks of a post from its votes and replies.
+// The karma of the author is adjusted accordingly.
+func (store *Store) UpdateRank(c context.Context, id int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return fmt.Errorf("UpdateRank: could not find post: %w", models.ErrNotFound)
+	}
+	score := post.Score()
+	post.Upvotes, post.Downvotes = 0, 0
+	for key, vote := range store.votes {
+		if key.post != id {
+			continue
+		}
+		if vote.Upvote {
+			post.Upvotes++
+		} else {
+			post.Downvotes++
+		}
+	}
+	post.Comments = len(store.filter(func(p models.Post) bool {
+		return p.Parent == id
+	}))
+	post.Rerank()
+	store.posts[id] = post
+	store.addKarma(post.Author, post.Score()-score)
+	return nil
+}
+
+// SubmitPost stores a post.
+func (store *Store) SubmitPost(c context.Context, author, text, color, community string, parent int64, anonymous bool) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	parentPost, ok := store.posts[parent]
+	if parent != 0 && !ok {
+		return 0, fmt.Errorf("SubmitPost: could not find parent: %w", models.ErrNotFound)
+	}
+	// verify input
+	post, err := models.NewPost(author, text, color, parent, anonymous)
+	if err != nil {
+		return 0, err
+	}
+	post.Community = community
+	if parent != 0 {
+		post.Community = parentPost.Community
+		if store.posts[parentPost.ThreadRoot(parent)].Locked {
+			return 0, fmt.Errorf("SubmitPost: thread is locked: %w", models.ErrLocked)
+		}
+	}
+	if post.Community != "" {
+		community, ok := store.communities[post.Community]
+		if !ok {
+			return 0, fmt.Errorf("SubmitPost: could not find community: %w", models.ErrNotFound)
+		} else if !community.Accepts(post.Author) {
+			return 0, fmt.Errorf("SubmitPost: community does not accept posts: %w", models.ErrForbidden)
+		}
+	}
+	if parent != 0 {
+		post.Root = parentPost.ThreadRoot(parent)
+		parentPost.Comments++
+		store.posts[parent] = parentPost
+	}
+	store.nextPost++
+	store.posts[store.nextPost] = post
+	return store.nextPost, nil
+}
+
+// NumberOfComments retrieves the number of direct replies a post has received.
+func (store *Store) NumberOfComments(c context.Context, id int64) (int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return 0, fmt.Errorf("NumberOfComments: could not find post: %w", models.ErrNotFound)
+	}
+	return post.Comments, nil
+}
+
+// GetPost retrieves a post.
+func (store *Store) GetPost(c context.Context, id int64) (models.Post, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	post, ok := store.posts[id]
+	if !ok {
+		return post, fmt.Errorf("GetPost: could not find post: %w", models.ErrNotFound)
+	}
+	return post, nil
+}
+
+// GetComments retrieves all comments on the specified post ordered by date.
+func (store *Store) GetComments(c context.Context, id int64) ([]models.Post, []int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	ids := store.filter(func(p models.Post) bool {
+		return p.Parent == id
+	})
+	sort.SliceStable(ids, func(i, j int) bool {
+		return store.posts[ids[i]].Date.Before(store.posts[ids[j]].Date)
+	})
+	return store.collect(ids), ids, nil
+}
+
+// GetThread retrieves all replies in the thread of a top-level post ordered by date.
+func (store *Store) GetThread(c context.Context, id int64) ([]models.Post, []int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	ids := store.filter(func(p models.Post) bool {
+		return p.Root == id
+	})
+	sort.SliceStable(ids, func(i, j int) bool {
+		return store.posts[ids[i]].Date.Before(store.posts[ids[j]].Date)
+	})
+	return store.collect(ids), ids, nil
+}
+
+// filter returns the IDs of all posts matching the predicate in insertion order.
+func (store *Store) filter(match func(models.Post) bool) []int64 {
+	ids := make([]int64, 0)
+	for id, post := range store.posts {
+		if match(post) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// collect looks up the posts for the given IDs.
+func (store *Store) collect(ids []int64) []models.Post {
+	posts := make([]models.Post, len(ids))
+	for i, id := range ids {
+		posts[i] = store.posts[id]
+	}
+	return posts
+}
+
+// compile-time check that Store implements models.Store
+var _ models.Store = (*Store)(nil)
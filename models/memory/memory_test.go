@@ -0,0 +1,22 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/models/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, storetest.Backend{
+		New: func(t *testing.T) models.Store { return New() },
+		SetKarma: func(t *testing.T, store models.Store, user string, karma int) {
+			s := store.(*Store)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			u := s.users[user]
+			u.Karma = karma
+			s.users[user] = u
+		},
+	})
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// Moderate applies a moderation action to a post and records it in the audit log.
+// Locks are applied to the top-level post of the thread. Approving or removing a post
+// deletes its pending reports.
+func (store *Store) Moderate(c context.Context, action models.ModAction) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	post, ok := store.posts[action.Post]
+	if !ok {
+		return fmt.Errorf("Moderate: could not find post: %w", models.ErrNotFound)
+	}
+	if action.Thread() {
+		action.Post = post.ThreadRoot(action.Post)
+		post = store.posts[action.Post]
+	}
+	if err := action.Apply(&post); err != nil {
+		return err
+	}
+	store.posts[action.Post] = post
+	if action.Resolves() {
+		for key := range store.reports {
+			if key.post == action.Post {
+				delete(store.reports, key)
+			}
+		}
+	}
+	store.modlog = append(store.modlog, action)
+	return nil
+}
+
+// ModerationLog collects a page of the moderation audit log, newest first.
+// Cursors point behind the sequence number of the last entry.
+func (store *Store) ModerationLog(c context.Context, log models.ModLog) ([]models.ModAction, string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	end := int64(len(store.modlog))
+	if log.Cursor != "" {
+		_, seq, err := models.DecodeCursor(log.Cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("ModerationLog: %w", err)
+		}
+		if seq < end {
+			end = seq
+		}
+	}
+	actions := make([]models.ModAction, 0)
+	for i := end - 1; i >= 0 && len(actions) < log.PageSize(); i-- {
+		actions = append(actions, store.modlog[i])
+	}
+	var next string
+	if last := end - int64(len(actions)); last > 0 {
+		next = models.EncodeCursor(0, last)
+	}
+	return actions, next, nil
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// PostsBy collects a page of a user's posts or comments, newest first.
+// Cursors point behind the ID of the last post, since IDs increase over time.
+func (store *Store) PostsBy(c context.Context, author string, history models.History) ([]models.Post, []int64, string, error) {
+	var before int64
+	if history.Cursor != "" {
+		var err error
+		if _, before, err = models.DecodeCursor(history.Cursor); err != nil {
+			return nil, nil, "", fmt.Errorf("PostsBy: %w", err)
+		}
+	}
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	ids := store.filter(func(p models.Post) bool {
+		return p.Author == author && history.Includes(p)
+	})
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	if before != 0 {
+		ids = ids[sort.Search(len(ids), func(i int) bool { return ids[i] < before }):]
+	}
+	var next string
+	if limit := history.PageSize(); len(ids) > limit {
+		ids = ids[:limit]
+		next = models.EncodeCursor(0, ids[limit-1])
+	}
+	return store.collect(ids), ids, next, nil
+}
+
+// GetStats summarizes the posts, karma and votes of a user.
+func (store *Store) GetStats(c context.Context, author string) (models.UserStats, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var stats models.UserStats
+	for _, post := range store.posts {
+		if post.Author == author {
+			stats.Tally(post)
+		}
+	}
+	for key, vote := range store.votes {
+		if key.author != author {
+			continue
+		}
+		if vote.Upvote {
+			stats.Upvotes++
+		} else {
+			stats.Downvotes++
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// SubmitReport records a user's report of a post and hides the post once its pending reports reach the threshold.
+func (store *Store) SubmitReport(c context.Context, report models.Report, threshold int) (models.Post, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	post, ok := store.posts[report.Post]
+	if !ok {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not find post: %w", models.ErrNotFound)
+	}
+	key := voteKey{report.Post, report.Reporter}
+	if _, ok := store.reports[key]; ok {
+		return post, nil
+	}
+	store.reports[key] = report
+	post.AddReport(threshold)
+	store.posts[report.Post] = post
+	return post, nil
+}
+
+// ReportedPosts collects a page of the posts with pending reports ordered by ID.
+// Cursors point behind the ID of the last post.
+func (store *Store) ReportedPosts(c context.Context, queue models.ReportQueue) ([]models.Post, []int64, string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var after int64
+	if queue.Cursor != "" {
+		_, id, err := models.DecodeCursor(queue.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("ReportedPosts: %w", err)
+		}
+		after = id
+	}
+	ids := make([]int64, 0)
+	for id, post := range store.posts {
+		if post.Reports > 0 && id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var next string
+	if len(ids) > queue.PageSize() {
+		ids = ids[:queue.PageSize()]
+		next = models.EncodeCursor(0, ids[len(ids)-1])
+	}
+	posts := make([]models.Post, len(ids))
+	for i, id := range ids {
+		posts[i] = store.posts[id]
+	}
+	return posts, ids, next, nil
+}
+
+// GetReports retrieves the pending reports on a batch of posts ordered by date, keyed by post ID.
+func (store *Store) GetReports(c context.Context, ids []int64) (map[int64][]models.Report, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	reports := make(map[int64][]models.Report)
+	for key, report := range store.reports {
+		if wanted[key.post] {
+			reports[key.post] = append(reports[key.post], report)
+		}
+	}
+	for _, r := range reports {
+		sort.Slice(r, func(i, j int) bool { return r[i].Date.Before(r[j].Date) })
+	}
+	return reports, nil
+}
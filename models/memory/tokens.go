@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// CreateToken stores a new API token.
+func (store *Store) CreateToken(c context.Context, token models.Token) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.tokens[token.Hash]; ok {
+		return fmt.Errorf("CreateToken: token already exists")
+	}
+	store.tokens[token.Hash] = token
+	return nil
+}
+
+// GetToken retrieves an API token by the hash of its secret.
+func (store *Store) GetToken(c context.Context, hash string) (models.Token, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	token, ok := store.tokens[hash]
+	if !ok {
+		return token, fmt.Errorf("GetToken: could not find token: %w", models.ErrNotFound)
+	}
+	return token, nil
+}
+
+// TokensBy retrieves all API tokens of a user ordered by creation date.
+func (store *Store) TokensBy(c context.Context, owner string) ([]models.Token, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	tokens := make([]models.Token, 0)
+	for _, token := range store.tokens {
+		if token.Owner == owner {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Created.Before(tokens[j].Created)
+	})
+	return tokens, nil
+}
+
+// RevokeToken deletes an API token of a user.
+func (store *Store) RevokeToken(c context.Context, owner, hash string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	token, ok := store.tokens[hash]
+	if !ok || token.Owner != owner {
+		return fmt.Errorf("RevokeToken: could not find token: %w", models.ErrNotFound)
+	}
+	delete(store.tokens, hash)
+	return nil
+}
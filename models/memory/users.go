@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// EnsureUser retrieves the user with the given login, creating a user with
+// a generated handle on their first login.
+func (store *Store) EnsureUser(c context.Context, login string) (models.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if id, ok := store.logins[login]; ok {
+		return store.users[id], nil
+	}
+	user, err := models.NewUser(login)
+	if err != nil {
+		return user, err
+	}
+	for attempt := 0; store.handles[user.Handle] != ""; attempt++ {
+		if err := user.RegenerateHandle(attempt); err != nil {
+			return user, err
+		}
+	}
+	store.users[user.ID] = user
+	store.logins[user.Login] = user.ID
+	store.handles[user.Handle] = user.ID
+	return user, nil
+}
+
+// GetUser retrieves a user by ID.
+func (store *Store) GetUser(c context.Context, id string) (models.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user, ok := store.users[id]
+	if !ok {
+		return user, fmt.Errorf("GetUser: could not find user: %w", models.ErrNotFound)
+	}
+	return user, nil
+}
+
+// GetUserByHandle retrieves a user by handle.
+func (store *Store) GetUserByHandle(c context.Context, handle string) (models.User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	id, ok := store.handles[handle]
+	if !ok {
+		return models.User{}, fmt.Errorf("GetUserByHandle: could not find user: %w", models.ErrNotFound)
+	}
+	return store.users[id], nil
+}
+
+// GetUsers retrieves a batch of users, keyed by ID. Unknown IDs are skipped.
+func (store *Store) GetUsers(c context.Context, ids []string) (models.Users, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	users := make(models.Users, len(ids))
+	for _, id := range ids {
+		if user, ok := store.users[id]; ok {
+			users[id] = user
+		}
+	}
+	return users, nil
+}
+
+// SetHandle changes the handle of a user, failing if it is already taken.
+func (store *Store) SetHandle(c context.Context, id, handle string) error {
+	handle, err := models.NormalizeHandle(handle)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[id]
+	if !ok {
+		return fmt.Errorf("SetHandle: could not find user: %w", models.ErrNotFound)
+	}
+	if owner, ok := store.handles[handle]; ok && owner != id {
+		return fmt.Errorf("SetHandle: handle is already taken")
+	}
+	delete(store.handles, user.Handle)
+	user.Handle = handle
+	store.users[id] = user
+	store.handles[handle] = id
+	return nil
+}
@@ -6,278 +6,349 @@ import (
 	"time"
 
 	"golang.org/x/net/context"
-	"google.golang.org/appengine/datastore"
 )
 
-// GetKarma computes the amount of karma a author has earned.
-func GetKarma(c context.Context, author string) int {
-	var posts []Post
-	_, err := datastore.NewQuery("Post").Filter("Author =", author).GetAll(c, &posts)
-	if err != nil {
-		return 0
-	}
-	sum := 0.0
-	for _, p := range posts {
-		sum += p.Rank
-	}
-	return int(sum)
+// Store persists posts, votes, users, communities, API tokens and local accounts and computes karma from them.
+// Code needing only a part of it depends on the smaller interfaces it embeds.
+type Store interface {
+	PostStore
+	UserStore
+	ModerationStore
+	CommunityStore
+	TokenStore
 }
 
-func voteKey(c context.Context, id int64) *datastore.Key {
-	return datastore.NewKey(c, "Vote", "", id, nil)
+// PostStore persists posts with their votes and revisions.
+type PostStore interface {
+	// SubmitPost stores a post and returns its ID. The author of anonymous posts is hidden from readers.
+	// Top-level posts are submitted to the given community, or to none if it is empty, replies
+	// always belong to the community of their parent. It fails if the community does not exist
+	// or does not accept posts from the author, or if the thread is locked.
+	SubmitPost(c context.Context, author, text, color, community string, parent int64, anonymous bool) (int64, error)
+	// GetPost retrieves a post.
+	GetPost(c context.Context, id int64) (Post, error)
+	// TopPosts collects a page of top-level posts. Pinned posts precede the ranked posts on
+	// the first page, removed, hidden and deleted posts are omitted. It returns the cursor of the next page,
+	// or an empty string if there are no more posts.
+	TopPosts(c context.Context, listing Listing) ([]Post, []int64, string, error)
+	// GetComments retrieves all comments on the specified post ordered by date.
+	GetComments(c context.Context, id int64) ([]Post, []int64, error)
+	// GetThread retrieves all replies in the thread of a top-level post ordered by date.
+	GetThread(c context.Context, id int64) ([]Post, []int64, error)
+	// NumberOfComments retrieves the number of direct replies a post has received.
+	NumberOfComments(c context.Context, id int64) (int, error)
+	// SubmitVote atomically toggles a user's vote on a post and updates the vote counters and rank of the post
+	// as well as the karma of its author. It fails if the thread is locked.
+	// Casting the same vote twice retracts it, casting the opposite vote flips it.
+	// It reports whether the user has a vote on the post afterwards.
+	SubmitVote(c context.Context, author string, id int64, upvote bool) (bool, error)
+	// CastVote atomically casts a user's vote on a post like SubmitVote, flipping an opposite vote.
+	// Instead of retracting a repeated vote it fails with ErrAlreadyVoted.
+	// It reports whether an opposite vote was flipped instead of a new vote being cast.
+	CastVote(c context.Context, author string, id int64, upvote bool) (bool, error)
+	// GetVoteBy retrieves a vote on a post by a user.
+	GetVoteBy(c context.Context, id int64, author string) (Vote, error)
+	// GetVotesBy retrieves the votes of a user on a batch of posts, keyed by post ID.
+	GetVotesBy(c context.Context, ids []int64, author string) (map[int64]Vote, error)
+	// HasVotedOn retrieves if the user has submitted a vote on the given post.
+	HasVotedOn(c context.Context, post int64, author string) (bool, error)
+	// NumberOfVotes calculates the number of votes a post has received. This is a relative number.
+	NumberOfVotes(c context.Context, id int64) (int, error)
+	// UpdateRank recomputes the denormalized counters and ranks of a post from its votes and replies.
+	// The karma of the author is adjusted accordingly.
+	UpdateRank(c context.Context, id int64) error
+	// PostsBy collects a page of a user's posts or comments, newest first. It returns the
+	// cursor of the next page, or an empty string if there are no more posts.
+	PostsBy(c context.Context, author string, history History) ([]Post, []int64, string, error)
+	// EditPost replaces the text of a post on behalf of its author and stores the previous
+	// text as a revision. It fails if the user is not the author, if the edit window has
+	// passed, if the post has been removed, deleted or hidden, or if the thread is locked.
+	EditPost(c context.Context, author string, id int64, text string, window time.Duration) error
+	// DeletePost clears the text and revisions of a post on behalf of its author, its replies are kept.
+	// It fails if the user is not the author or if the post has been removed or deleted.
+	DeletePost(c context.Context, author string, id int64) error
+	// Revisions retrieves the previous versions of the text of a post ordered by date.
+	Revisions(c context.Context, id int64) ([]Revision, error)
 }
 
-// Vote stores information about a user's vote on a post.
-type Vote struct {
-	Post   int64
-	Author string
-	Upvote bool
-	Date   time.Time
+// UserStore persists users and local accounts and computes the karma and statistics of users.
+type UserStore interface {
+	// EnsureUser retrieves the user with the given login, creating a user with
+	// a generated handle on their first login.
+	EnsureUser(c context.Context, login string) (User, error)
+	// GetUser retrieves a user by ID.
+	GetUser(c context.Context, id string) (User, error)
+	// GetUserByHandle retrieves a user by handle.
+	GetUserByHandle(c context.Context, handle string) (User, error)
+	// GetUsers retrieves a batch of users, keyed by ID. Unknown IDs are skipped.
+	GetUsers(c context.Context, ids []string) (Users, error)
+	// SetHandle changes the handle of a user, failing if it is already taken.
+	SetHandle(c context.Context, id, handle string) error
+	// GetKarma retrieves the amount of karma a user has earned. Karma is stored on the user and
+	// updated together with the score of their posts.
+	GetKarma(c context.Context, author string) (int, error)
+	// ReconcileKarma recomputes the karma of all users from the votes on their posts.
+	// It returns the number of users whose karma has been corrected.
+	ReconcileKarma(c context.Context) (int, error)
+	// GetStats summarizes the posts, karma and votes of a user.
+	GetStats(c context.Context, author string) (UserStats, error)
+	// CreateAccount stores a new local account, failing if the name is already taken.
+	CreateAccount(c context.Context, account Account) error
+	// GetAccount retrieves a local account by name.
+	GetAccount(c context.Context, name string) (Account, error)
 }
 
-// SubmitVote puts out a vote and updates the votes rank.
-func SubmitVote(c context.Context, author string, id int64, upvote bool) (int64, error) {
-	if _, err := GetPost(c, id); err != nil {
-		return 0, fmt.Errorf("SubmitVote: could not find post: %v", err)
-	}
-	// verify input
-	author = strings.TrimSpace(author)
-	if len(author) < 1 {
-		return 0, fmt.Errorf("SubmitVote: vote need author")
-	}
-	if voted, err := HasVotedOn(c, id, author); err != nil {
-		return 0, fmt.Errorf("SubmitVote: failed to retrieve vote status: %v", err)
-	} else if voted {
-		return 0, fmt.Errorf("SubmitVote: user already voted on post")
-	}
-	vote := Vote{
-		Post:   id,
-		Author: author,
-		Upvote: upvote,
-		Date:   time.Now(),
-	}
-	baseKey := datastore.NewIncompleteKey(c, "Vote", nil)
-	key, err := datastore.Put(c, baseKey, &vote)
-	if err != nil {
-		return 0, fmt.Errorf("SubmitVote: could not submit vote: %v", err)
-	}
-	if err := UpdateRank(c, id); err != nil {
-		return 0, fmt.Errorf("SubmitVote: could not update rank: %v", err)
-	}
-	return key.IntID(), nil
+// ModerationStore applies moderation actions and collects reports of posts.
+type ModerationStore interface {
+	// Moderate applies a moderation action to a post and records it in the audit log.
+	// Locks are applied to the top-level post of the thread. Approving or removing a post
+	// deletes its pending reports.
+	Moderate(c context.Context, action ModAction) error
+	// ModerationLog collects a page of the moderation audit log, newest first. It returns the
+	// cursor of the next page, or an empty string if there are no more entries.
+	ModerationLog(c context.Context, log ModLog) ([]ModAction, string, error)
+	// SubmitReport records a user's report of a post and hides the post once its pending reports
+	// reach the threshold, a threshold below 1 never hides posts. Reporting a post twice has no effect.
+	// It returns the updated post.
+	SubmitReport(c context.Context, report Report, threshold int) (Post, error)
+	// ReportedPosts collects a page of the posts with pending reports ordered by ID. It returns
+	// the cursor of the next page, or an empty string if there are no more posts.
+	ReportedPosts(c context.Context, queue ReportQueue) ([]Post, []int64, string, error)
+	// GetReports retrieves the pending reports on a batch of posts ordered by date, keyed by post ID.
+	GetReports(c context.Context, ids []int64) (map[int64][]Report, error)
 }
 
-// GetVote retrieves a vote from the database.
-func GetVote(c context.Context, id int64) (Vote, error) {
-	var vote Vote
-	key := voteKey(c, id)
-	if err := datastore.Get(c, key, &vote); err != nil {
-		return vote, fmt.Errorf("GetVote: could not find vote: %v", err)
-	}
-	return vote, nil
+// CommunityStore persists communities.
+type CommunityStore interface {
+	// CreateCommunity stores a new community, failing if the slug is already taken.
+	CreateCommunity(c context.Context, community Community) error
+	// GetCommunity retrieves a community by slug.
+	GetCommunity(c context.Context, slug string) (Community, error)
+	// Communities retrieves all communities ordered by slug.
+	Communities(c context.Context) ([]Community, error)
 }
 
-// GetVoteBy retrieves a vote on a post by a user.
-func GetVoteBy(c context.Context, id int64, author string) (Vote, error) {
-	var votes []Vote
-	if _, err := datastore.NewQuery("Vote").Filter("Author =", author).Filter("Post =", id).GetAll(c, &votes); err != nil {
-		return Vote{}, fmt.Errorf("GetVoteBy: could not collect votes: %v", err)
-	}
-	if len(votes) != 1 {
-		return Vote{}, fmt.Errorf("GetVoteBy: user has voted multiple times or never")
-	}
-	return votes[0], nil
+// TokenStore persists API tokens.
+type TokenStore interface {
+	// CreateToken stores a new API token.
+	CreateToken(c context.Context, token Token) error
+	// GetToken retrieves an API token by the hash of its secret.
+	GetToken(c context.Context, hash string) (Token, error)
+	// TokensBy retrieves all API tokens of a user ordered by creation date.
+	TokensBy(c context.Context, owner string) ([]Token, error)
+	// RevokeToken deletes an API token of a user.
+	RevokeToken(c context.Context, owner, hash string) error
 }
 
-// HasVotedOn retrieves if the user has submitted a vote on the given post.
-func HasVotedOn(c context.Context, post int64, author string) (bool, error) {
-	count, err := datastore.NewQuery("Vote").Filter("Author =", author).Filter("Post =", post).Count(c)
-	if err != nil {
-		return false, fmt.Errorf("HasVotedOn: could not collect votes: %v", err)
-	}
-	return count > 0, nil
+// Post stores information about a user's post like ID, userID and topicID.
+type Post struct {
+	// Author is the ID of the user who submitted the post.
+	Author string
+	Parent int64
+	// Root is the top-level post of the thread a comment belongs to.
+	Root  int64
+	Text  string
+	Color string
+	Date  time.Time
+	// Rank is the raw score used by the Top ranking.
+	Rank float64
+	// Hot and Confidence are the ranks used by the Hot and Best ranking.
+	Hot        float64
+	Confidence float64
+	// Upvotes and Downvotes are the denormalized vote counters of the post.
+	Upvotes   int
+	Downvotes int
+	// Comments is the denormalized number of direct replies to the post.
+	Comments int
+	// Anonymous hides the author from readers except moderators.
+	Anonymous bool
+	// Community is the slug of the community the post belongs to, empty for none.
+	Community string
+	// Removed, Locked and Pinned are set by moderators. Locks are only set on top-level posts
+	// and apply to their whole thread.
+	Removed bool
+	Locked  bool
+	Pinned  bool
+	// Reports is the number of pending reports, Hidden is set once they reach the report
+	// threshold. Both are reset when a moderator approves or removes the post.
+	Reports int
+	Hidden  bool
+	// Revisions is the denormalized number of previous versions of the text, Deleted is set
+	// once the author deleted the post.
+	Revisions int
+	Deleted   bool
 }
 
-// NumberOfVotes calculates the number of votes a post has received. This is a relative number.
-func NumberOfVotes(c context.Context, id int64) (int, error) {
-	var votes []Vote
-	_, err := datastore.NewQuery("Vote").Filter("Post =", id).GetAll(c, &votes)
-	if err != nil {
-		return 0, fmt.Errorf("NumberOfVotes: could not collect votes: %v", err)
-	}
-	var sum int
-	for _, vote := range votes {
-		if vote.Upvote {
-			sum++
-		} else {
-			sum--
-		}
-	}
-	return sum, nil
+// Score is the relative number of votes a post has received.
+func (post Post) Score() int {
+	return post.Upvotes - post.Downvotes
 }
 
-// JSONVote is a JSON representation of a Vote.
-type JSONVote struct {
-	Author string `json:"user"`
-	Post   int64  `json:"post"`
-	Upvote bool   `json:"upvote"`
-	Date   int64  `json:"time"`
+// Tally adds n votes to the counters of the post and updates its rank.
+func (post *Post) Tally(upvote bool, n int) {
+	if upvote {
+		post.Upvotes += n
+	} else {
+		post.Downvotes += n
+	}
+	post.Rerank()
 }
 
-func postKey(c context.Context, id int64) *datastore.Key {
-	return datastore.NewKey(c, "Post", "", id, nil)
+// ApplyVote updates the counters of the post for a vote replacing the user's previous vote, if any.
+// Casting the same vote twice retracts it, casting the opposite vote flips it.
+// It reports whether the vote has to be kept.
+func (post *Post) ApplyVote(prev *Vote, vote Vote) bool {
+	if prev != nil {
+		post.Tally(prev.Upvote, -1)
+		if vote.Repeats(prev) {
+			return false
+		}
+	}
+	post.Tally(vote.Upvote, 1)
+	return true
 }
 
-// TopPosts collects the top n posts with a minimum rank of x from the datastore.
-func TopPosts(c context.Context, limit int, rank float64) ([]Post, []int64, error) {
-	var posts []Post
-	keys, err := datastore.NewQuery("Post").Filter("Parent =", 0).Order("-Rank").Limit(limit).GetAll(c, &posts)
-	if err != nil {
-		return nil, nil, fmt.Errorf("TopPosts: could not collect posts: %v", err)
-	}
-	ids := make([]int64, len(keys))
-	for i := range keys {
-		ids[i] = keys[i].IntID()
-	}
-	return posts, ids, nil
+// Rerank recomputes the ranks of the post from its vote counters.
+func (post *Post) Rerank() {
+	post.Rank = float64(post.Score())
+	post.Hot = hotRank(*post)
+	post.Confidence = confidence(post.Upvotes, post.Downvotes)
 }
 
-// UpdateRank recomputes the rank of a post.
-func UpdateRank(c context.Context, id int64) error {
-	var post Post
-	if err := datastore.Get(c, postKey(c, id), &post); err != nil {
-		return fmt.Errorf("UpdateRank: could not find post: %v", err)
+// NewPost verifies the input and initializes a new post. Replies have to be
+// attached to their thread by setting Root using the parent's ThreadRoot.
+func NewPost(author, text, color string, parent int64, anonymous bool) (Post, error) {
+	author = strings.TrimSpace(author)
+	if len(author) < 1 {
+		return Post{}, fmt.Errorf("SubmitPost: Can not submit post without author")
 	}
-	num, err := NumberOfVotes(c, id)
+	text, err := ValidatePost(text, color)
 	if err != nil {
-		return fmt.Errorf("UpdateRank: could not count votes: %v", err)
+		return Post{}, err
 	}
-	post.Rank = float64(num)
-	if _, err := datastore.Put(c, postKey(c, id), &post); err != nil {
-		return fmt.Errorf("UpdateRank: could not save changes: %v", err)
+	post := Post{
+		Author:    author,
+		Parent:    parent,
+		Text:      text,
+		Color:     color,
+		Date:      time.Now(),
+		Anonymous: anonymous,
 	}
-	return nil
+	post.Rerank()
+	return post, nil
 }
 
-// SubmitPost stores a post in the datastore.
-func SubmitPost(c context.Context, author, text, color string, parent int64) (int64, error) {
-	if parent != 0 {
-		if _, err := GetPost(c, parent); err != nil {
-			return 0, fmt.Errorf("SubmitPost: could not find parent: %v", err)
-		}
-	}
-	// verify input
+// JSONPost is a JSON represenation of a Post.
+type JSONPost struct {
+	ID       int64  `json:"id"`
+	Parent   int64  `json:"topic"`
+	Date     int64  `json:"timestamp"`
+	Author   string `json:"user"`
+	Text     string `json:"text"`
+	Votes    int    `json:"votes"`
+	Color    string `json:"color"`
+	Comments int    `json:"comments"`
+	// Community is the slug of the community the post belongs to.
+	Community string `json:"community,omitempty"`
+	// Anonymous posts are shown under a pseudonym, RealAuthor is only revealed to moderators.
+	Anonymous  bool   `json:"anonymous,omitempty"`
+	RealAuthor string `json:"real_user,omitempty"`
+	// Removed and hidden posts are shown as placeholders except to moderators.
+	Removed bool `json:"removed,omitempty"`
+	Locked  bool `json:"locked,omitempty"`
+	Pinned  bool `json:"pinned,omitempty"`
+	Hidden  bool `json:"hidden,omitempty"`
+	// Edited posts have previous revisions, deleted posts are shown as placeholders.
+	Edited  bool `json:"edited,omitempty"`
+	Deleted bool `json:"deleted,omitempty"`
+	// TextHTML is the text rendered as HTML, only set if requested by API clients.
+	TextHTML string `json:"text_html,omitempty"`
+	// Replies and More are only set when serializing a thread.
+	Replies []JSONPost `json:"replies,omitempty"`
+	More    bool       `json:"more,omitempty"`
+}
+
+// Vote stores information about a user's vote on a post.
+type Vote struct {
+	Post int64
+	// Author is the ID of the user who cast the vote.
+	Author string
+	Upvote bool
+	Date   time.Time
+}
+
+// NewVote verifies the input and initializes a new vote.
+func NewVote(author string, id int64, upvote bool) (Vote, error) {
 	author = strings.TrimSpace(author)
-	text = strings.TrimSpace(text)
-	if len(author) < 1 || len(text) < 1 {
-		return 0, fmt.Errorf("SubmitPost: Can not submit empty post")
+	if len(author) < 1 {
+		return Vote{}, fmt.Errorf("SubmitVote: vote need author")
 	}
-	post := Post{
+	return Vote{
+		Post:   id,
 		Author: author,
-		Parent: parent,
-		Text:   text,
-		Color:  color,
+		Upvote: upvote,
 		Date:   time.Now(),
-		Rank:   0,
-	}
-	baseKey := datastore.NewIncompleteKey(c, "Post", nil)
-	key, err := datastore.Put(c, baseKey, &post)
-	if err != nil {
-		return 0, fmt.Errorf("SubmitPost: could not submit post: %v", err)
-	}
-	return key.IntID(), nil
+	}, nil
 }
 
-// NumberOfComments retrieves the number of comments a post has received.
-func NumberOfComments(c context.Context, id int64) (int, error) {
-	count, err := datastore.NewQuery("Post").Filter("Parent =", id).Count(c)
-	if err != nil {
-		return 0, fmt.Errorf("NumberOfComments: could not collect posts: %v", err)
-	}
-	return count, nil
+// Repeats reports if the vote is cast the same way as the previous vote, if any.
+func (vote Vote) Repeats(prev *Vote) bool {
+	return prev != nil && prev.Upvote == vote.Upvote
 }
 
-// GetPost retrieves a post from the datastore.
-func GetPost(c context.Context, id int64) (Post, error) {
-	var post Post
-	if err := datastore.Get(c, postKey(c, id), &post); err != nil {
-		return post, fmt.Errorf("GetPost: could not find post: %v", err)
-	}
-	return post, nil
-}
-
-// GetComments retrieves all comments on the specified post ordered by rank.
-func GetComments(c context.Context, id int64) ([]Post, []int64, error) {
-	var comments []Post
-	keys, err := datastore.NewQuery("Post").Filter("Parent =", id).Order("Date").GetAll(c, &comments)
-	if err != nil {
-		return nil, nil, fmt.Errorf("GetComments: could not collect posts: %v", err)
-	}
-	ids := make([]int64, len(keys))
-	for i, k := range keys {
-		ids[i] = k.IntID()
-	}
-	return comments, ids, nil
+// JSONVote is a JSON representation of a Vote.
+type JSONVote struct {
+	Author string `json:"user"`
+	Post   int64  `json:"post"`
+	Upvote bool   `json:"upvote"`
+	Date   int64  `json:"time"`
 }
 
 // ToJSONComments converts a slice of comments to a JSON serializable slice.
-func ToJSONComments(c context.Context, comments []Post, ids []int64) ([]JSONPost, error) {
+// Authors are represented by their displayed names.
+func ToJSONComments(comments []Post, ids []int64, names Names) ([]JSONPost, error) {
 	if len(comments) != len(ids) {
 		return nil, fmt.Errorf("ToJSONComments: array size does not match")
 	}
 
-	var err error
 	jsonComments := make([]JSONPost, len(comments))
 	for i := range comments {
-		jsonComments[i], err = ToJSONPost(c, ids[i], comments[i])
-		if err != nil {
-			return nil, fmt.Errorf("ToJSONComments: %v", err)
-		}
+		jsonComments[i] = ToJSONPost(ids[i], comments[i], names)
 	}
 	return jsonComments, nil
 }
 
 // ToJSONPost converts the post to a JSON serializable representation.
-func ToJSONPost(c context.Context, id int64, post Post) (JSONPost, error) {
-	numVotes, err := NumberOfVotes(c, id)
-	if err != nil {
-		return JSONPost{}, fmt.Errorf("GetJSONPost: %v", err)
-	}
-	numComments, err := NumberOfComments(c, id)
-	if err != nil {
-		return JSONPost{}, fmt.Errorf("GetJSONPost: %v", err)
-	}
-
+// The author is represented by their displayed name.
+func ToJSONPost(id int64, post Post, names Names) JSONPost {
 	return JSONPost{
-		ID:       id,
-		Parent:   post.Parent,
-		Date:     post.Date.Unix(),
-		Author:   post.Author,
-		Text:     post.Text,
-		Color:    post.Color,
-		Votes:    numVotes,
-		Comments: numComments,
-	}, nil
-}
-
-// Post stores information about a user's post like ID, userID and topicID.
-type Post struct {
-	Author string
-	Parent int64
-	Text   string
-	Color  string
-	Date   time.Time
-	Rank   float64
+		ID:         id,
+		Parent:     post.Parent,
+		Date:       post.Date.Unix(),
+		Author:     names.Author(id, post),
+		Text:       names.Text(post),
+		Color:      post.Color,
+		Votes:      post.Score(),
+		Comments:   post.Comments,
+		Community:  post.Community,
+		Anonymous:  post.Anonymous,
+		RealAuthor: names.RealAuthor(post),
+		Removed:    post.Removed,
+		Locked:     post.Locked,
+		Pinned:     post.Pinned,
+		Hidden:     post.Hidden,
+		Edited:     post.Revisions > 0,
+		Deleted:    post.Deleted,
+	}
 }
 
-// JSONPost is a JSON represenation of a Post.
-type JSONPost struct {
-	ID       int64  `json:"id"`
-	Parent   int64  `json:"topic"`
-	Date     int64  `json:"timestamp"`
-	Author   string `json:"user"`
-	Text     string `json:"text"`
-	Votes    int    `json:"votes"`
-	Color    string `json:"color"`
-	Comments int    `json:"comments"`
+// ToJSONThread converts the replies of a thread to a nested JSON serializable slice.
+func ToJSONThread(thread *Thread, names Names) []JSONPost {
+	replies := make([]JSONPost, len(thread.Replies))
+	for i, reply := range thread.Replies {
+		replies[i] = ToJSONPost(reply.ID, reply.Post, names)
+		replies[i].Replies = ToJSONThread(reply, names)
+		replies[i].More = reply.More
+	}
+	return replies
 }
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// collection of moderation actions
+const (
+	// ActionRemove hides the text and author of a post, its replies are kept. Pending reports are resolved.
+	ActionRemove = "remove"
+	// ActionRestore reverts ActionRemove.
+	ActionRestore = "restore"
+	// ActionLock prevents new comments and votes in the thread of a post.
+	ActionLock = "lock"
+	// ActionUnlock reverts ActionLock.
+	ActionUnlock = "unlock"
+	// ActionPin shows a top-level post above all other posts of a listing.
+	ActionPin = "pin"
+	// ActionUnpin reverts ActionPin.
+	ActionUnpin = "unpin"
+	// ActionApprove dismisses the pending reports of a post and shows it again if it has been hidden.
+	ActionApprove = "approve"
+)
+
+// RemovedText replaces the text and author of removed posts.
+const RemovedText = "[removed]"
+
+// MaxReasonLength bounds the reason given for a moderation action.
+const MaxReasonLength = 200
+
+// Actions lists all available moderation actions.
+func Actions() []string {
+	return []string{ActionRemove, ActionRestore, ActionLock, ActionUnlock, ActionPin, ActionUnpin, ActionApprove}
+}
+
+// ModAction is an entry of the moderation audit log.
+type ModAction struct {
+	// Moderator is the ID of the user who took the action.
+	Moderator string
+	Action    string
+	// Post is the post the action was applied to. Locks are applied to the top-level post of the thread.
+	Post   int64
+	Reason string
+	Date   time.Time
+}
+
+// NewModAction verifies the input and initializes a new moderation action.
+func NewModAction(moderator, action string, post int64, reason string) (ModAction, error) {
+	moderator = strings.TrimSpace(moderator)
+	reason = strings.TrimSpace(reason)
+	if len(moderator) < 1 {
+		return ModAction{}, fmt.Errorf("NewModAction: action needs a moderator")
+	}
+	if !validAction(action) {
+		return ModAction{}, invalidField("action", "unknown action %q", action)
+	}
+	if len(reason) > MaxReasonLength {
+		return ModAction{}, invalidField("reason", "reason must not exceed %d characters", MaxReasonLength)
+	}
+	return ModAction{
+		Moderator: moderator,
+		Action:    action,
+		Post:      post,
+		Reason:    reason,
+		Date:      time.Now(),
+	}, nil
+}
+
+// Apply changes the moderation flags of the post according to the action. The caller has
+// to resolve the top-level post of the thread for locks, which only apply to top-level posts.
+func (action ModAction) Apply(post *Post) error {
+	if action.Resolves() {
+		post.Reports = 0
+		post.Hidden = false
+	}
+	switch action.Action {
+	case ActionRemove, ActionRestore:
+		post.Removed = action.Action == ActionRemove
+	case ActionApprove:
+		// only resolves the pending reports
+	case ActionLock, ActionUnlock:
+		if post.Parent != 0 {
+			return invalidField("action", "only threads can be locked")
+		}
+		post.Locked = action.Action == ActionLock
+	case ActionPin, ActionUnpin:
+		if post.Parent != 0 {
+			return invalidField("action", "only top-level posts can be pinned")
+		}
+		post.Pinned = action.Action == ActionPin
+	default:
+		return fmt.Errorf("Moderate: unknown action %q", action.Action)
+	}
+	return nil
+}
+
+// Thread reports if the action applies to the whole thread of the post.
+func (action ModAction) Thread() bool {
+	return action.Action == ActionLock || action.Action == ActionUnlock
+}
+
+// Resolves reports if the action resolves the pending reports of the post.
+func (action ModAction) Resolves() bool {
+	return action.Action == ActionRemove || action.Action == ActionApprove
+}
+
+// ModLog selects a page of the moderation audit log, newest first.
+type ModLog struct {
+	// Limit is the maximum number of entries on the page.
+	Limit int
+	// Cursor continues a previous page, empty to start with the newest entry.
+	Cursor string
+}
+
+// PageSize returns the limit of the log bounded by MaxPageSize.
+func (log ModLog) PageSize() int {
+	return Listing{Limit: log.Limit}.PageSize()
+}
+
+// CanModerate reports if the user may moderate the post: moderators may moderate
+// all posts, the owners of a community the posts of their community.
+func CanModerate(c context.Context, store Store, moderators Moderators, user string, post Post) (bool, error) {
+	if user == "" {
+		return false, nil
+	}
+	viewer, err := store.GetUser(c, user)
+	if err != nil {
+		return false, err
+	}
+	if moderators.Includes(viewer) {
+		return true, nil
+	}
+	if post.Community == "" {
+		return false, nil
+	}
+	community, err := store.GetCommunity(c, post.Community)
+	if err != nil {
+		return false, err
+	}
+	return community.IsOwner(user), nil
+}
+
+// JSONModAction is a JSON representation of a ModAction.
+type JSONModAction struct {
+	Moderator string `json:"moderator"`
+	Action    string `json:"action"`
+	Post      int64  `json:"post"`
+	Reason    string `json:"reason,omitempty"`
+	Date      int64  `json:"time"`
+}
+
+// ToJSONModActions converts audit log entries into their JSON representation.
+// Moderators are represented by their handles.
+func ToJSONModActions(actions []ModAction, users Users) []JSONModAction {
+	entries := make([]JSONModAction, len(actions))
+	for i, action := range actions {
+		entries[i] = JSONModAction{
+			Moderator: users.Handle(action.Moderator),
+			Action:    action.Action,
+			Post:      action.Post,
+			Reason:    action.Reason,
+			Date:      action.Date.Unix(),
+		}
+	}
+	return entries
+}
+
+func validAction(action string) bool {
+	for _, a := range Actions() {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
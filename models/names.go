@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// Moderators lists the logins of the users allowed to moderate.
+type Moderators []string
+
+// Includes reports if the user is a moderator.
+func (moderators Moderators) Includes(user User) bool {
+	for _, login := range moderators {
+		if login != "" && login == user.Login {
+			return true
+		}
+	}
+	return false
+}
+
+// Names resolves the names posts are displayed with.
+type Names struct {
+	// Users contains the authors of the posts.
+	Users Users
+	// Pseudonyms maps the IDs of anonymous posts to their pseudonyms in the thread.
+	Pseudonyms map[int64]string
+	// Reveal exposes the real authors of anonymous posts and the content of removed and
+	// hidden posts, only set for moderators.
+	Reveal bool
+}
+
+// Author returns the displayed name of the post's author: their handle, or a
+// pseudonym if the post is anonymous.
+func (names Names) Author(id int64, post Post) string {
+	if placeholder, ok := names.placeholder(post); ok {
+		return placeholder
+	}
+	if !post.Anonymous {
+		return names.Users.Handle(post.Author)
+	}
+	if pseudonym, ok := names.Pseudonyms[id]; ok {
+		return pseudonym
+	}
+	return "Anonymous"
+}
+
+// Text returns the displayed text of the post, which is replaced if the post has been
+// deleted, removed or hidden pending review.
+func (names Names) Text(post Post) string {
+	if placeholder, ok := names.placeholder(post); ok {
+		return placeholder
+	}
+	return post.Text
+}
+
+// Concealed reports if the text and author of the post are replaced for the viewer.
+func (names Names) Concealed(post Post) bool {
+	_, ok := names.placeholder(post)
+	return ok
+}
+
+// placeholder returns the text replacing the content of deleted, removed and hidden posts.
+// Deleted posts have no content left to reveal.
+func (names Names) placeholder(post Post) (string, bool) {
+	switch {
+	case post.Deleted:
+		return DeletedText, true
+	case names.Reveal:
+		return "", false
+	case post.Removed:
+		return RemovedText, true
+	case post.Hidden:
+		return HiddenText, true
+	}
+	return "", false
+}
+
+// RealAuthor returns the handle of the author of an anonymous post if it may be revealed.
+func (names Names) RealAuthor(post Post) string {
+	if !post.Anonymous || !names.Reveal {
+		return ""
+	}
+	return names.Users.Handle(post.Author)
+}
+
+// Pseudonyms assigns stable names to the anonymous posts in the thread of a top-level post.
+// If the top-level post is anonymous, its author is called "OP" throughout the thread.
+// Other anonymous authors are numbered "Anon #1", "Anon #2" in the order of their first
+// anonymous post, so posts are expected ordered by date.
+func Pseudonyms(rootID int64, root Post, posts []Post, ids []int64) map[int64]string {
+	pseudonyms := make(map[int64]string)
+	byAuthor := make(map[string]string)
+	anons := 0
+	if root.Anonymous {
+		pseudonyms[rootID] = "OP"
+		byAuthor[root.Author] = "OP"
+	}
+	for i, post := range posts {
+		if !post.Anonymous {
+			continue
+		}
+		name, ok := byAuthor[post.Author]
+		if !ok {
+			anons++
+			name = fmt.Sprintf("Anon #%d", anons)
+			byAuthor[post.Author] = name
+		}
+		pseudonyms[ids[i]] = name
+	}
+	return pseudonyms
+}
+
+// LoadNames retrieves the authors of the posts in a single batch. The real authors of
+// anonymous posts are revealed if the viewing user is a moderator.
+func LoadNames(c context.Context, store UserStore, viewer string, moderators Moderators, posts []Post) (Names, error) {
+	ids := Authors(posts)
+	if viewer != "" {
+		ids = append(ids, viewer)
+	}
+	users, err := store.GetUsers(c, ids)
+	if err != nil {
+		return Names{}, err
+	}
+	return Names{
+		Users:  users,
+		Reveal: viewer != "" && moderators.Includes(users[viewer]),
+	}, nil
+}
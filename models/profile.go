@@ -0,0 +1,52 @@
+package models
+
+// History selects a page of a user's posts, newest first.
+type History struct {
+	// Comments selects comments instead of top-level posts.
+	Comments bool
+	// Anonymous includes the user's anonymous posts.
+	Anonymous bool
+	// Limit is the maximum number of posts on the page.
+	Limit int
+	// Cursor continues a previous page, empty to start with the newest post.
+	Cursor string
+}
+
+// PageSize returns the limit of the history bounded by MaxPageSize.
+func (history History) PageSize() int {
+	return Listing{Limit: history.Limit}.PageSize()
+}
+
+// Includes reports if the post belongs on the pages of the history. Deleted posts are omitted.
+func (history History) Includes(post Post) bool {
+	return (post.Parent != 0) == history.Comments && (history.Anonymous || !post.Anonymous) && !post.Deleted
+}
+
+// UserStats summarizes the activity of a user.
+type UserStats struct {
+	// PostKarma and CommentKarma are the karma earned by top-level posts and by comments.
+	PostKarma    int
+	CommentKarma int
+	// Posts and Comments count the submitted top-level posts and comments.
+	// Anonymous posts are left out of the statistics, so that they can not be
+	// traced back to their author. They still earn the user karma.
+	Posts    int
+	Comments int
+	// Upvotes and Downvotes count the votes the user has cast.
+	Upvotes   int
+	Downvotes int
+}
+
+// Tally adds a post of the user to the statistics. Anonymous posts are skipped.
+func (stats *UserStats) Tally(post Post) {
+	if post.Anonymous {
+		return
+	}
+	if post.Parent == 0 {
+		stats.Posts++
+		stats.PostKarma += int(post.Rank)
+	} else {
+		stats.Comments++
+		stats.CommentKarma += int(post.Rank)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Ranking is a strategy to order posts in listings.
+type Ranking int
+
+// collection of available rankings
+const (
+	// Hot ranks posts by their score with a bonus for newer posts, so listings change over time.
+	Hot Ranking = iota
+	// Top ranks posts by their raw score.
+	Top
+	// Best ranks posts by the lower bound of the Wilson score confidence interval of their upvote ratio.
+	Best
+)
+
+// DefaultRanking is used if a listing does not specify a ranking.
+const DefaultRanking = Hot
+
+var rankingNames = [...]string{"hot", "top", "best"}
+
+// hot ranking parameters, a post has to collect 10 times the votes to stay on par with a post submitted 12.5 hours later
+const (
+	hotEpoch    = 1134028003
+	hotDuration = 45000
+)
+
+// z-score of the 95% confidence level used by the Best ranking
+const confidenceZ = 1.96
+
+// Rankings lists all available rankings.
+func Rankings() []Ranking {
+	return []Ranking{Hot, Top, Best}
+}
+
+// ParseRanking looks up a ranking by name. An empty name selects the default ranking.
+func ParseRanking(name string) (Ranking, error) {
+	if name == "" {
+		return DefaultRanking, nil
+	}
+	for i, n := range rankingNames {
+		if n == name {
+			return Ranking(i), nil
+		}
+	}
+	return DefaultRanking, invalidField("sort", "unknown ranking %q", name)
+}
+
+// String returns the name of the ranking.
+func (ranking Ranking) String() string {
+	if ranking < 0 || int(ranking) >= len(rankingNames) {
+		return fmt.Sprintf("Ranking(%d)", int(ranking))
+	}
+	return rankingNames[ranking]
+}
+
+// Of returns the stored rank of the post according to the ranking.
+func (ranking Ranking) Of(post Post) float64 {
+	switch ranking {
+	case Top:
+		return post.Rank
+	case Best:
+		return post.Confidence
+	}
+	return post.Hot
+}
+
+// hotRank computes the time-decayed rank of a post. Since the bonus for newer posts
+// grows with the submission date, the rank never has to be recomputed as time passes.
+func hotRank(post Post) float64 {
+	score := float64(post.Score())
+	order := math.Log10(math.Max(math.Abs(score), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := float64(post.Date.Unix() - hotEpoch)
+	return sign*order + seconds/hotDuration
+}
+
+// confidence computes the lower bound of the Wilson score interval of the upvote ratio.
+func confidence(upvotes, downvotes int) float64 {
+	n := float64(upvotes + downvotes)
+	if n == 0 {
+		return 0
+	}
+	p := float64(upvotes) / n
+	z2 := confidenceZ * confidenceZ
+	return (p + z2/(2*n) - confidenceZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHotRank(t *testing.T) {
+	epoch := time.Unix(hotEpoch, 0)
+	tests := []struct {
+		upvotes, downvotes int
+		date               time.Time
+		want               float64
+	}{
+		{0, 0, epoch, 0},
+		{1, 0, epoch, 0},
+		{10, 0, epoch, 1},
+		{0, 10, epoch, -1},
+		{110, 10, epoch, 2},
+		{5, 5, epoch.Add(hotDuration * time.Second), 1},
+		// 10 times the votes are on par with 12.5 hours
+		{100, 0, epoch, 2},
+		{10, 0, epoch.Add(12*time.Hour + 30*time.Minute), 2},
+		{1000, 0, epoch.Add(10 * hotDuration * time.Second), 13},
+		{0, 1000, epoch.Add(10 * hotDuration * time.Second), 7},
+	}
+	for _, test := range tests {
+		post := Post{Upvotes: test.upvotes, Downvotes: test.downvotes, Date: test.date}
+		if got := hotRank(post); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("hotRank(%d:%d at %v) = %v, want %v", test.upvotes, test.downvotes, test.date.Sub(epoch), got, test.want)
+		}
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		upvotes, downvotes int
+		want               float64
+	}{
+		{0, 0, 0},
+		{0, 1, 0},
+		{1, 0, 0.206543},
+		{1, 1, 0.094529},
+		{3, 1, 0.300636},
+		{10, 0, 0.722460},
+		{60, 40, 0.502001},
+		// more votes narrow the interval
+		{600, 400, 0.569309},
+	}
+	for _, test := range tests {
+		if got := confidence(test.upvotes, test.downvotes); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("confidence(%d, %d) = %.6f, want %.6f", test.upvotes, test.downvotes, got, test.want)
+		}
+	}
+}
+
+func TestRerank(t *testing.T) {
+	post := Post{Upvotes: 10, Downvotes: 0, Date: time.Unix(hotEpoch, 0)}
+	post.Rerank()
+	for _, test := range []struct {
+		ranking Ranking
+		want    float64
+	}{
+		{Top, 10},
+		{Hot, 1},
+		{Best, 0.722460},
+	} {
+		if got := test.ranking.Of(post); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%v rank = %v, want %v", test.ranking, got, test.want)
+		}
+	}
+}
+
+func TestParseRanking(t *testing.T) {
+	tests := []struct {
+		name string
+		want Ranking
+		ok   bool
+	}{
+		{"", DefaultRanking, true},
+		{"hot", Hot, true},
+		{"top", Top, true},
+		{"best", Best, true},
+		{"new", DefaultRanking, false},
+		{"Hot", DefaultRanking, false},
+		{" top", DefaultRanking, false},
+		{"Ranking(1)", DefaultRanking, false},
+	}
+	for _, test := range tests {
+		got, err := ParseRanking(test.name)
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("ParseRanking(%q) = %v, %v, want %v", test.name, got, err, test.want)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ParseRanking(%q) = %v, want %v", test.name, err, ErrInvalidInput)
+		}
+	}
+	for _, ranking := range Rankings() {
+		if got, err := ParseRanking(ranking.String()); err != nil || got != ranking {
+			t.Errorf("ParseRanking(%q) = %v, %v, want %v", ranking.String(), got, err, ranking)
+		}
+	}
+	if name := Ranking(len(rankingNames)).String(); name != "Ranking(3)" {
+		t.Errorf("String of an unknown ranking = %q, want %q", name, "Ranking(3)")
+	}
+}
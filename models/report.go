@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HiddenText replaces the text and author of posts hidden pending review.
+const HiddenText = "[hidden pending review]"
+
+// DefaultReportThreshold is the number of pending reports hiding a post until a moderator reviews it.
+const DefaultReportThreshold = 3
+
+// Report is a user's complaint about a post, pending until a moderator approves or removes the post.
+type Report struct {
+	// Reporter is the ID of the user who reported the post.
+	Reporter string
+	Post     int64
+	Reason   string
+	Date     time.Time
+}
+
+// NewReport verifies the input and initializes a new report.
+func NewReport(reporter string, post int64, reason string) (Report, error) {
+	reporter = strings.TrimSpace(reporter)
+	reason = strings.TrimSpace(reason)
+	if len(reporter) < 1 {
+		return Report{}, fmt.Errorf("NewReport: report needs a reporter")
+	}
+	if len(reason) < 1 || utf8.RuneCountInString(reason) > MaxReasonLength {
+		return Report{}, invalidField("reason", "reason must have 1 to %d characters", MaxReasonLength)
+	}
+	return Report{
+		Reporter: reporter,
+		Post:     post,
+		Reason:   reason,
+		Date:     time.Now(),
+	}, nil
+}
+
+// AddReport counts a new pending report and hides the post once the number of pending
+// reports reaches the threshold. A threshold below 1 never hides posts.
+func (post *Post) AddReport(threshold int) {
+	post.Reports++
+	if threshold > 0 && post.Reports >= threshold {
+		post.Hidden = true
+	}
+}
+
+// ReportQueue selects a page of the posts with pending reports, oldest first.
+type ReportQueue struct {
+	// Limit is the maximum number of posts on the page.
+	Limit int
+	// Cursor continues a previous page, empty to start with the oldest post.
+	Cursor string
+}
+
+// PageSize returns the limit of the queue bounded by MaxPageSize.
+func (queue ReportQueue) PageSize() int {
+	return Listing{Limit: queue.Limit}.PageSize()
+}
+
+// JSONReport is a JSON representation of a Report.
+type JSONReport struct {
+	Reporter string `json:"reporter"`
+	Reason   string `json:"reason"`
+	Date     int64  `json:"time"`
+}
+
+// ToJSONReports converts reports into their JSON representation. Reporters are
+// represented by their handles.
+func ToJSONReports(reports []Report, users Users) []JSONReport {
+	entries := make([]JSONReport, len(reports))
+	for i, report := range reports {
+		entries[i] = JSONReport{
+			Reporter: users.Handle(report.Reporter),
+			Reason:   report.Reason,
+			Date:     report.Date.Unix(),
+		}
+	}
+	return entries
+}
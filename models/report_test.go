@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAddReport(t *testing.T) {
+	tests := []struct {
+		reports, threshold int
+		hidden             bool
+	}{
+		{1, 3, false},
+		{2, 3, false},
+		{3, 3, true},
+		{4, 3, true},
+		{1, 1, true},
+		{5, 0, false},
+		{5, -1, false},
+	}
+	for _, test := range tests {
+		var post Post
+		for i := 0; i < test.reports; i++ {
+			post.AddReport(test.threshold)
+		}
+		if post.Reports != test.reports || post.Hidden != test.hidden {
+			t.Errorf("%d reports with threshold %d: %d reports, hidden %t, want hidden %t",
+				test.reports, test.threshold, post.Reports, post.Hidden, test.hidden)
+		}
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		reporter, reason string
+		want             string
+		invalid          bool
+	}{
+		{"user", " spam ", "spam", false},
+		{"user", strings.Repeat("ü", MaxReasonLength), strings.Repeat("ü", MaxReasonLength), false},
+		{"user", strings.Repeat("x", MaxReasonLength+1), "", true},
+		{"user", "  ", "", true},
+		{"", "spam", "", false},
+	}
+	for _, test := range tests {
+		report, err := NewReport(test.reporter, 1, test.reason)
+		if test.want != "" {
+			if err != nil || report.Reason != test.want || report.Reporter != test.reporter {
+				t.Errorf("NewReport(%q, %q) = %+v, %v, want reason %q", test.reporter, test.reason, report, err, test.want)
+			}
+		} else if err == nil || errors.Is(err, ErrInvalidInput) != test.invalid {
+			t.Errorf("NewReport(%q, %q) = %v, want invalid input %t", test.reporter, test.reason, err, test.invalid)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package sqlstore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// CreateAccount stores a new local account, failing if the name is already taken.
+func (store *Store) CreateAccount(c context.Context, account models.Account) error {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("CreateAccount: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	var taken int
+	if err := tx.QueryRowContext(c, store.q(`SELECT COUNT(*) FROM accounts WHERE name = ?`), account.Name).Scan(&taken); err != nil {
+		return fmt.Errorf("CreateAccount: could not look up name: %v", err)
+	} else if taken > 0 {
+		return fmt.Errorf("CreateAccount: name is already taken")
+	}
+	if _, err := tx.ExecContext(c, store.q(`INSERT INTO accounts (name, password, created) VALUES (?, ?, ?)`),
+		account.Name, string(account.Password), account.Created); err != nil {
+		return fmt.Errorf("CreateAccount: could not store account: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("CreateAccount: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// GetAccount retrieves a local account by name.
+func (store *Store) GetAccount(c context.Context, name string) (models.Account, error) {
+	var (
+		account  models.Account
+		password string
+	)
+	err := store.db.QueryRowContext(c, store.q(`SELECT name, password, created FROM accounts WHERE name = ?`), name).
+		Scan(&account.Name, &password, &account.Created)
+	if err != nil {
+		return account, fmt.Errorf("GetAccount: could not find account: %w", notFound(err))
+	}
+	account.Password = []byte(password)
+	return account, nil
+}
@@ -0,0 +1,77 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// communityColumns lists the columns scanned by scanCommunity.
+const communityColumns = `slug, name, description, owners, visibility, created`
+
+// scanCommunity reads a community selected using communityColumns. Owners are stored space-separated.
+func scanCommunity(row scanner) (models.Community, error) {
+	var (
+		community models.Community
+		owners    string
+	)
+	err := row.Scan(&community.Slug, &community.Name, &community.Description, &owners, &community.Visibility, &community.Created)
+	community.Owners = strings.Fields(owners)
+	return community, err
+}
+
+// CreateCommunity stores a new community, failing if the slug is already taken.
+func (store *Store) CreateCommunity(c context.Context, community models.Community) error {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("CreateCommunity: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	var taken int
+	if err := tx.QueryRowContext(c, store.q(`SELECT COUNT(*) FROM communities WHERE slug = ?`), community.Slug).Scan(&taken); err != nil {
+		return fmt.Errorf("CreateCommunity: could not look up slug: %v", err)
+	} else if taken > 0 {
+		return fmt.Errorf("CreateCommunity: slug is already taken")
+	}
+	if _, err := tx.ExecContext(c, store.q(`INSERT INTO communities (`+communityColumns+`) VALUES (?, ?, ?, ?, ?, ?)`),
+		community.Slug, community.Name, community.Description, strings.Join(community.Owners, " "), community.Visibility, community.Created); err != nil {
+		return fmt.Errorf("CreateCommunity: could not store community: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("CreateCommunity: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// GetCommunity retrieves a community by slug.
+func (store *Store) GetCommunity(c context.Context, slug string) (models.Community, error) {
+	community, err := scanCommunity(store.db.QueryRowContext(c, store.q(`SELECT `+communityColumns+` FROM communities WHERE slug = ?`), slug))
+	if err != nil {
+		return community, fmt.Errorf("GetCommunity: could not find community: %w", notFound(err))
+	}
+	return community, nil
+}
+
+// Communities retrieves all communities ordered by slug.
+func (store *Store) Communities(c context.Context) ([]models.Community, error) {
+	rows, err := store.db.QueryContext(c, `SELECT `+communityColumns+` FROM communities ORDER BY slug`)
+	if err != nil {
+		return nil, fmt.Errorf("Communities: could not collect communities: %v", err)
+	}
+	defer rows.Close()
+	communities := make([]models.Community, 0)
+	for rows.Next() {
+		community, err := scanCommunity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("Communities: could not collect communities: %v", err)
+		}
+		communities = append(communities, community)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Communities: could not collect communities: %v", err)
+	}
+	return communities, nil
+}
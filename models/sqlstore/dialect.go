@@ -0,0 +1,78 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the differences between the supported SQL databases.
+type Dialect struct {
+	// Name of the dialect.
+	Name string
+	// Serial is the column definition of an auto-incrementing primary key.
+	Serial string
+	// Float is the type of a double precision floating point column.
+	Float string
+	// Timestamp is the type of a point in time column.
+	Timestamp string
+	// ForUpdate is appended to a SELECT to lock the selected rows until the transaction ends.
+	ForUpdate string
+	// Numbered reports if placeholders are numbered ($1, $2, ...) instead of ?.
+	Numbered bool
+	// MaxConns limits the number of open connections, if positive.
+	MaxConns int
+}
+
+// collection of supported dialects
+var (
+	SQLite = Dialect{
+		Name:      "sqlite",
+		Serial:    "INTEGER PRIMARY KEY AUTOINCREMENT",
+		Float:     "REAL",
+		Timestamp: "TIMESTAMP",
+		MaxConns:  1,
+	}
+	Postgres = Dialect{
+		Name:      "postgres",
+		Serial:    "BIGSERIAL PRIMARY KEY",
+		Float:     "DOUBLE PRECISION",
+		Timestamp: "TIMESTAMPTZ",
+		ForUpdate: " FOR UPDATE",
+		Numbered:  true,
+	}
+)
+
+// DialectFor looks up the dialect matching the name of a driver registered by drivers.go.
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "sqlite3":
+		return SQLite, nil
+	case "postgres":
+		return Postgres, nil
+	}
+	return Dialect{}, fmt.Errorf("DialectFor: unsupported driver %q", driver)
+}
+
+// rebind rewrites ? placeholders into the dialect's placeholder style.
+func (dialect Dialect) rebind(query string) string {
+	if !dialect.Numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// placeholders returns a comma separated list of n ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
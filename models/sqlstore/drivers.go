@@ -0,0 +1,7 @@
+package sqlstore
+
+import (
+	// register the supported database drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,92 @@
+package sqlstore
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// EditPost replaces the text of a post on behalf of its author and stores the previous text as a revision.
+func (store *Store) EditPost(c context.Context, author string, id int64, text string, window time.Duration) error {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("EditPost: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post, err := store.lockPost(c, tx, id)
+	if err != nil {
+		return fmt.Errorf("EditPost: could not find post: %w", notFound(err))
+	}
+	if locked, err := store.threadLocked(c, tx, id, post); err != nil {
+		return fmt.Errorf("EditPost: could not find thread: %w", notFound(err))
+	} else if locked {
+		return fmt.Errorf("EditPost: thread is locked: %w", models.ErrLocked)
+	}
+	revision, err := post.Edit(author, text, window, time.Now())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(c, store.q(`INSERT INTO revisions (post, text, date) VALUES (?, ?, ?)`),
+		id, revision.Text, revision.Date); err != nil {
+		return fmt.Errorf("EditPost: could not store revision: %v", err)
+	}
+	if _, err := tx.ExecContext(c, store.q(`UPDATE posts SET text = ?, revisions = ? WHERE id = ?`),
+		post.Text, post.Revisions, id); err != nil {
+		return fmt.Errorf("EditPost: could not update post: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("EditPost: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// DeletePost clears the text and revisions of a post on behalf of its author.
+func (store *Store) DeletePost(c context.Context, author string, id int64) error {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("DeletePost: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post, err := store.lockPost(c, tx, id)
+	if err != nil {
+		return fmt.Errorf("DeletePost: could not find post: %w", notFound(err))
+	}
+	if err := post.Delete(author); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(c, store.q(`DELETE FROM revisions WHERE post = ?`), id); err != nil {
+		return fmt.Errorf("DeletePost: could not delete revisions: %v", err)
+	}
+	if _, err := tx.ExecContext(c, store.q(`UPDATE posts SET text = ?, revisions = ?, deleted = ? WHERE id = ?`),
+		post.Text, post.Revisions, post.Deleted, id); err != nil {
+		return fmt.Errorf("DeletePost: could not update post: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("DeletePost: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// Revisions retrieves the previous versions of the text of a post ordered by date.
+func (store *Store) Revisions(c context.Context, id int64) ([]models.Revision, error) {
+	if _, err := store.GetPost(c, id); err != nil {
+		return nil, fmt.Errorf("Revisions: %w", err)
+	}
+	rows, err := store.db.QueryContext(c, store.q(`SELECT post, text, date FROM revisions WHERE post = ? ORDER BY id`), id)
+	if err != nil {
+		return nil, fmt.Errorf("Revisions: could not collect revisions: %v", err)
+	}
+	defer rows.Close()
+	revisions := make([]models.Revision, 0)
+	for rows.Next() {
+		var revision models.Revision
+		if err := rows.Scan(&revision.Post, &revision.Text, &revision.Date); err != nil {
+			return nil, fmt.Errorf("Revisions: could not collect revisions: %v", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
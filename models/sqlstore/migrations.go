@@ -0,0 +1,332 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// migration is a single versioned schema change.
+type migration struct {
+	version     int
+	description string
+	statements  func(d Dialect) []string
+	// backfill optionally migrates existing rows after the statements have been executed.
+	backfill func(tx *sql.Tx, d Dialect) error
+}
+
+// migrations lists all schema changes in the order they have to be applied.
+// Existing entries must never be modified, only new ones appended.
+var migrations = []migration{
+	{1, "create posts and votes", func(d Dialect) []string {
+		return []string{
+			`CREATE TABLE posts (
+				id ` + d.Serial + `,
+				author TEXT NOT NULL,
+				parent BIGINT NOT NULL DEFAULT 0,
+				text TEXT NOT NULL,
+				color TEXT NOT NULL,
+				date ` + d.Timestamp + ` NOT NULL,
+				rank ` + d.Float + ` NOT NULL DEFAULT 0
+			)`,
+			`CREATE INDEX posts_parent_rank ON posts (parent, rank DESC)`,
+			`CREATE INDEX posts_parent_date ON posts (parent, date)`,
+			`CREATE INDEX posts_author ON posts (author)`,
+			`CREATE TABLE votes (
+				id ` + d.Serial + `,
+				post BIGINT NOT NULL REFERENCES posts (id),
+				author TEXT NOT NULL,
+				upvote BOOLEAN NOT NULL,
+				date ` + d.Timestamp + ` NOT NULL,
+				UNIQUE (post, author)
+			)`,
+			`CREATE INDEX votes_author_post ON votes (author, post)`,
+		}
+	}, nil},
+	{2, "add denormalized vote counters to posts", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN upvotes INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE posts ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE posts SET
+				upvotes = (SELECT COUNT(*) FROM votes WHERE votes.post = posts.id AND votes.upvote),
+				downvotes = (SELECT COUNT(*) FROM votes WHERE votes.post = posts.id AND NOT votes.upvote)`,
+		}
+	}, nil},
+	{3, "add hot and best ranks to posts", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN hot ` + d.Float + ` NOT NULL DEFAULT 0`,
+			`ALTER TABLE posts ADD COLUMN confidence ` + d.Float + ` NOT NULL DEFAULT 0`,
+			`CREATE INDEX posts_parent_hot ON posts (parent, hot DESC)`,
+			`CREATE INDEX posts_parent_confidence ON posts (parent, confidence DESC)`,
+		}
+	}, rerankPosts},
+	{4, "add thread roots to posts", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN root BIGINT NOT NULL DEFAULT 0`,
+			`CREATE INDEX posts_root_date ON posts (root, date)`,
+		}
+	}, resolveRoots},
+	{5, "add comment counters to posts", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN comments INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE posts SET comments = (SELECT COUNT(*) FROM posts p WHERE p.parent = posts.id)`,
+		}
+	}, nil},
+	{6, "create api tokens", func(d Dialect) []string {
+		return []string{
+			`CREATE TABLE tokens (
+				hash TEXT PRIMARY KEY,
+				owner TEXT NOT NULL,
+				name TEXT NOT NULL,
+				scopes TEXT NOT NULL,
+				created ` + d.Timestamp + ` NOT NULL
+			)`,
+			`CREATE INDEX tokens_owner ON tokens (owner, created)`,
+		}
+	}, nil},
+	{7, "create local accounts", func(d Dialect) []string {
+		return []string{
+			`CREATE TABLE accounts (
+				name TEXT PRIMARY KEY,
+				password TEXT NOT NULL,
+				created ` + d.Timestamp + ` NOT NULL
+			)`,
+		}
+	}, nil},
+	{8, "create users and key posts, votes and tokens by user ID", func(d Dialect) []string {
+		return []string{
+			`CREATE TABLE users (
+				id TEXT PRIMARY KEY,
+				handle TEXT NOT NULL UNIQUE,
+				login TEXT NOT NULL UNIQUE,
+				created ` + d.Timestamp + ` NOT NULL
+			)`,
+		}
+	}, migrateAuthors},
+	{9, "add anonymous flag to posts", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN anonymous BOOLEAN NOT NULL DEFAULT FALSE`,
+		}
+	}, nil},
+	{10, "add persisted karma to users", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE users ADD COLUMN karma INTEGER NOT NULL DEFAULT 0`,
+			`UPDATE users SET karma = (
+				SELECT COALESCE(SUM(CASE WHEN votes.upvote THEN 1 ELSE -1 END), 0)
+				FROM votes JOIN posts ON posts.id = votes.post WHERE posts.author = users.id
+			)`,
+		}
+	}, nil},
+	{11, "create communities", func(d Dialect) []string {
+		return []string{
+			`CREATE TABLE communities (
+				slug TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				description TEXT NOT NULL,
+				owners TEXT NOT NULL,
+				visibility TEXT NOT NULL,
+				created ` + d.Timestamp + ` NOT NULL
+			)`,
+			`ALTER TABLE posts ADD COLUMN community TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX posts_community_rank ON posts (community, parent, rank DESC)`,
+			`CREATE INDEX posts_community_hot ON posts (community, parent, hot DESC)`,
+			`CREATE INDEX posts_community_confidence ON posts (community, parent, confidence DESC)`,
+		}
+	}, nil},
+	{12, "add moderation flags to posts and create the moderation log", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN removed BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE posts ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE posts ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE INDEX posts_parent_pinned ON posts (parent, pinned)`,
+			`CREATE TABLE modlog (
+				id ` + d.Serial + `,
+				moderator TEXT NOT NULL,
+				action TEXT NOT NULL,
+				post BIGINT NOT NULL REFERENCES posts (id),
+				reason TEXT NOT NULL,
+				date ` + d.Timestamp + ` NOT NULL
+			)`,
+		}
+	}, nil},
+	{13, "add report counters to posts and create reports", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN reports INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE posts ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE INDEX posts_reports ON posts (reports, id)`,
+			`CREATE TABLE reports (
+				post BIGINT NOT NULL REFERENCES posts (id),
+				reporter TEXT NOT NULL,
+				reason TEXT NOT NULL,
+				date ` + d.Timestamp + ` NOT NULL,
+				PRIMARY KEY (post, reporter)
+			)`,
+		}
+	}, nil},
+	{14, "add revisions and deletion to posts", func(d Dialect) []string {
+		return []string{
+			`ALTER TABLE posts ADD COLUMN revisions INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE posts ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE`,
+			`CREATE TABLE revisions (
+				id ` + d.Serial + `,
+				post BIGINT NOT NULL REFERENCES posts (id),
+				text TEXT NOT NULL,
+				date ` + d.Timestamp + ` NOT NULL
+			)`,
+			`CREATE INDEX revisions_post ON revisions (post, id)`,
+		}
+	}, nil},
+}
+
+// Migrate brings the database schema up to the latest version.
+func (store *Store) Migrate() error {
+	if _, err := store.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied ` + store.dialect.Timestamp + ` NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("Migrate: could not create migration table: %v", err)
+	}
+	var current int
+	if err := store.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("Migrate: could not determine schema version: %v", err)
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := store.apply(m); err != nil {
+			return fmt.Errorf("Migrate: version %d (%s): %v", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// apply runs a single migration inside a transaction.
+func (store *Store) apply(m migration) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range m.statements(store.dialect) {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if m.backfill != nil {
+		if err := m.backfill(tx, store.dialect); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(store.dialect.rebind(`INSERT INTO schema_migrations (version, applied) VALUES (?, ?)`), m.version, time.Now()); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rerankPosts recomputes the hot and best ranks of all posts.
+func rerankPosts(tx *sql.Tx, d Dialect) error {
+	rows, err := tx.Query(`SELECT id, date, upvotes, downvotes FROM posts`)
+	if err != nil {
+		return err
+	}
+	var (
+		ids   []int64
+		posts []models.Post
+	)
+	for rows.Next() {
+		var (
+			id   int64
+			post models.Post
+		)
+		if err := rows.Scan(&id, &post.Date, &post.Upvotes, &post.Downvotes); err != nil {
+			rows.Close()
+			return err
+		}
+		post.Rerank()
+		ids = append(ids, id)
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, post := range posts {
+		if _, err := tx.Exec(d.rebind(`UPDATE posts SET hot = ?, confidence = ? WHERE id = ?`), post.Hot, post.Confidence, ids[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAuthors creates a user for every login stored as author of a post or vote
+// or as owner of a token and replaces the login by the new user's ID.
+func migrateAuthors(tx *sql.Tx, d Dialect) error {
+	rows, err := tx.Query(`SELECT author FROM posts UNION SELECT author FROM votes UNION SELECT owner FROM tokens`)
+	if err != nil {
+		return err
+	}
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			rows.Close()
+			return err
+		}
+		logins = append(logins, login)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	handles := make(map[string]bool, len(logins))
+	for _, login := range logins {
+		user, err := models.NewUser(login)
+		if err != nil {
+			return err
+		}
+		for attempt := 0; handles[user.Handle]; attempt++ {
+			if err := user.RegenerateHandle(attempt); err != nil {
+				return err
+			}
+		}
+		handles[user.Handle] = true
+		if _, err := tx.Exec(d.rebind(`INSERT INTO users (id, handle, login, created) VALUES (?, ?, ?, ?)`),
+			user.ID, user.Handle, login, user.Created); err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			`UPDATE posts SET author = ? WHERE author = ?`,
+			`UPDATE votes SET author = ? WHERE author = ?`,
+			`UPDATE tokens SET owner = ? WHERE owner = ?`,
+		} {
+			if _, err := tx.Exec(d.rebind(stmt), user.ID, login); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRoots sets the thread root of all comments, resolving one level of nesting per pass.
+func resolveRoots(tx *sql.Tx, d Dialect) error {
+	for {
+		res, err := tx.Exec(`UPDATE posts SET root = (
+			SELECT CASE WHEN p.parent = 0 THEN p.id ELSE p.root END FROM posts p WHERE p.id = posts.parent
+		) WHERE parent <> 0 AND root = 0 AND EXISTS (
+			SELECT 1 FROM posts p WHERE p.id = posts.parent AND (p.parent = 0 OR p.root <> 0)
+		)`)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// openAt opens an in-memory SQLite store migrated up to the given version.
+func openAt(t *testing.T, version int) *Store {
+	all := migrations
+	defer func() { migrations = all }()
+	migrations = all[:version]
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := New(db, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// schemaVersions returns the versions recorded as applied.
+func schemaVersions(t *testing.T, store *Store) []int {
+	rows, err := store.db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// TestMigrationVersions verifies that the versions are numbered consecutively from 1.
+func TestMigrationVersions(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %q has version %d, want %d", m.description, m.version, i+1)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	store := openAt(t, len(migrations))
+	versions := schemaVersions(t, store)
+	if len(versions) != len(migrations) || versions[len(versions)-1] != len(migrations) {
+		t.Fatalf("applied versions %v, want 1 to %d", versions, len(migrations))
+	}
+	// migrating an up to date database has no effect
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(); err != nil {
+			t.Fatalf("Migrate of an up to date database: %v", err)
+		}
+	}
+	if again := schemaVersions(t, store); len(again) != len(versions) {
+		t.Errorf("Migrate recorded versions %v, want %v", again, versions)
+	}
+	if _, err := New(store.db, SQLite); err != nil {
+		t.Errorf("New on a migrated database: %v", err)
+	}
+
+	// a failing migration is rolled back and not recorded
+	migrations = append(migrations, migration{len(migrations) + 1, "broken", func(d Dialect) []string {
+		return []string{`CREATE TABLE broken (id INTEGER)`, `NOT SQL`}
+	}, nil})
+	defer func() { migrations = migrations[:len(migrations)-1] }()
+	if err := store.Migrate(); err == nil {
+		t.Fatal("Migrate succeeded with a broken migration")
+	}
+	if again := schemaVersions(t, store); len(again) != len(versions) {
+		t.Errorf("Migrate recorded versions %v of a broken migration, want %v", again, versions)
+	}
+	if _, err := store.db.Exec(`SELECT * FROM broken`); err == nil {
+		t.Error("broken migration has not been rolled back")
+	}
+}
+
+// TestMigrateUpgrade creates a database at the schema of the first vote counters and
+// verifies that upgrading it backfills ranks, thread roots, comment counters, users and karma.
+func TestMigrateUpgrade(t *testing.T) {
+	store := openAt(t, 2)
+	date := time.Now().Add(-time.Hour)
+	// a thread of nested replies with votes, authors are still logins
+	for _, stmt := range []string{
+		`INSERT INTO posts (id, author, parent, text, color, date, upvotes, downvotes) VALUES
+			(1, 'alice@example.com', 0, 'thread', 'red', ?, 2, 1),
+			(2, 'bob@example.com', 1, 'reply', 'red', ?, 0, 0),
+			(3, 'alice@example.com', 2, 'nested', 'red', ?, 0, 1),
+			(4, 'bob@example.com', 3, 'deeper', 'red', ?, 0, 0),
+			(5, 'bob@example.com', 0, 'other', 'red', ?, 0, 0)`,
+		`INSERT INTO votes (post, author, upvote, date) VALUES
+			(1, 'bob@example.com', TRUE, ?),
+			(1, 'carol@example.com', TRUE, ?),
+			(1, 'dave@example.com', FALSE, ?),
+			(3, 'bob@example.com', FALSE, ?)`,
+	} {
+		args := make([]interface{}, strings.Count(stmt, "?"))
+		for i := range args {
+			args[i] = date
+		}
+		if _, err := store.db.Exec(stmt, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if versions := schemaVersions(t, store); len(versions) != len(migrations) {
+		t.Fatalf("applied versions %v, want 1 to %d", versions, len(migrations))
+	}
+
+	c := context.Background()
+	users := make(map[string]models.User)
+	for _, login := range []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"} {
+		user, err := store.EnsureUser(c, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[login] = user
+	}
+	alice, bob := users["alice@example.com"], users["bob@example.com"]
+	if alice.Karma != 0 || bob.Karma != 0 {
+		t.Errorf("migrated karma %d and %d, want 0 and 0", alice.Karma, bob.Karma)
+	}
+	if karma, err := store.GetKarma(c, alice.ID); err != nil || karma != 0 {
+		t.Errorf("GetKarma = %d, %v, want 0", karma, err)
+	}
+
+	for _, test := range []struct {
+		id       int64
+		author   string
+		root     int64
+		comments int
+	}{
+		{1, alice.ID, 0, 1},
+		{2, bob.ID, 1, 1},
+		{3, alice.ID, 1, 1},
+		{4, bob.ID, 1, 0},
+		{5, bob.ID, 0, 0},
+	} {
+		post, err := store.GetPost(c, test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := models.Post{Date: post.Date, Upvotes: post.Upvotes, Downvotes: post.Downvotes}
+		want.Rerank()
+		if post.Author != test.author || post.Root != test.root || post.Comments != test.comments ||
+			post.Hot != want.Hot || post.Confidence != want.Confidence {
+			t.Errorf("migrated post %d = %+v, want author %s, root %d, %d comments and ranks %v and %v",
+				test.id, post, test.author, test.root, test.comments, want.Hot, want.Confidence)
+		}
+	}
+	if voted, err := store.HasVotedOn(c, 3, bob.ID); err != nil || !voted {
+		t.Errorf("HasVotedOn = %t, %v, the vote has not been migrated", voted, err)
+	}
+	if _, ids, err := store.GetThread(c, 1); err != nil || len(ids) != 3 {
+		t.Errorf("GetThread of the migrated thread = %v, %v, want 3 replies", ids, err)
+	}
+	// the migrated thread accepts new replies and votes
+	id, err := store.SubmitPost(c, alice.ID, "new", "red", "", 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post, err := store.GetPost(c, id); err != nil || post.Root != 1 {
+		t.Errorf("reply to a migrated thread has root %d, %v, want 1", post.Root, err)
+	}
+	if _, err := store.SubmitVote(c, bob.ID, 1, true); err != nil {
+		t.Errorf("SubmitVote on a migrated post: %v", err)
+	}
+	if karma, err := store.GetKarma(c, alice.ID); err != nil || karma != -1 {
+		t.Errorf("GetKarma after retracting a migrated vote = %d, %v, want -1", karma, err)
+	}
+}
+
+func TestDialectFor(t *testing.T) {
+	for _, test := range []struct {
+		driver string
+		want   string
+	}{
+		{"sqlite3", SQLite.Name},
+		{"postgres", Postgres.Name},
+		{"sqlite", ""},
+		{"mysql", ""},
+		{"", ""},
+	} {
+		dialect, err := DialectFor(test.driver)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("DialectFor(%q) = %s, want error", test.driver, dialect.Name)
+			}
+		} else if err != nil || dialect.Name != test.want {
+			t.Errorf("DialectFor(%q) = %s, %v, want %s", test.driver, dialect.Name, err, test.want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{SQLite, `SELECT * FROM posts WHERE id = ? AND parent = ?`, `SELECT * FROM posts WHERE id = ? AND parent = ?`},
+		{Postgres, `SELECT * FROM posts WHERE id = ? AND parent = ?`, `SELECT * FROM posts WHERE id = $1 AND parent = $2`},
+		{Postgres, `SELECT * FROM posts WHERE id IN (` + placeholders(3) + `)`, `SELECT * FROM posts WHERE id IN ($1, $2, $3)`},
+		{Postgres, `SELECT COUNT(*) FROM posts`, `SELECT COUNT(*) FROM posts`},
+	} {
+		if got := test.dialect.rebind(test.query); got != test.want {
+			t.Errorf("%s rebind(%q) = %q, want %q", test.dialect.Name, test.query, got, test.want)
+		}
+	}
+}
+
+// TestMigrationDialects verifies that the migrations only use the types of the dialect they are rendered for.
+func TestMigrationDialects(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		foreign []string
+	}{
+		{SQLite, []string{"BIGSERIAL", "DOUBLE PRECISION", "TIMESTAMPTZ"}},
+		{Postgres, []string{"AUTOINCREMENT", "REAL", "TIMESTAMP "}},
+	} {
+		for _, m := range migrations {
+			for _, stmt := range m.statements(test.dialect) {
+				for _, word := range test.foreign {
+					if strings.Contains(stmt, word) {
+						t.Errorf("%s migration %d uses %s: %s", test.dialect.Name, m.version, word, stmt)
+					}
+				}
+			}
+		}
+	}
+}
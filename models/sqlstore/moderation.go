@@ -0,0 +1,106 @@
+package sqlstore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// modActionColumns lists the columns scanned by scanModAction.
+const modActionColumns = `moderator, action, post, reason, date`
+
+// scanModAction reads an audit log entry selected using modActionColumns, optionally preceded by extra columns.
+func scanModAction(row scanner, extra ...interface{}) (models.ModAction, error) {
+	var action models.ModAction
+	dest := append(extra, &action.Moderator, &action.Action, &action.Post, &action.Reason, &action.Date)
+	err := row.Scan(dest...)
+	return action, err
+}
+
+// Moderate applies a moderation action to a post and records it in the audit log.
+// Locks are applied to the top-level post of the thread. Approving or removing a post
+// deletes its pending reports.
+func (store *Store) Moderate(c context.Context, action models.ModAction) error {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("Moderate: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post, err := store.lockPost(c, tx, action.Post)
+	if err != nil {
+		return fmt.Errorf("Moderate: could not find post: %w", notFound(err))
+	}
+	if root := post.ThreadRoot(action.Post); action.Thread() && root != action.Post {
+		action.Post = root
+		if post, err = store.lockPost(c, tx, root); err != nil {
+			return fmt.Errorf("Moderate: could not find thread: %w", notFound(err))
+		}
+	}
+	if err := action.Apply(&post); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(c, store.q(`UPDATE posts SET removed = ?, locked = ?, pinned = ?, reports = ?, hidden = ? WHERE id = ?`),
+		post.Removed, post.Locked, post.Pinned, post.Reports, post.Hidden, action.Post); err != nil {
+		return fmt.Errorf("Moderate: could not update post: %v", err)
+	}
+	if action.Resolves() {
+		if _, err := tx.ExecContext(c, store.q(`DELETE FROM reports WHERE post = ?`), action.Post); err != nil {
+			return fmt.Errorf("Moderate: could not resolve reports: %v", err)
+		}
+	}
+	if _, err := tx.ExecContext(c, store.q(`INSERT INTO modlog (`+modActionColumns+`) VALUES (?, ?, ?, ?, ?)`),
+		action.Moderator, action.Action, action.Post, action.Reason, action.Date); err != nil {
+		return fmt.Errorf("Moderate: could not record action: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Moderate: could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+// ModerationLog collects a page of the moderation audit log, newest first.
+// Cursors point behind the ID of the last entry.
+func (store *Store) ModerationLog(c context.Context, log models.ModLog) ([]models.ModAction, string, error) {
+	limit := log.PageSize()
+	query := `SELECT id, ` + modActionColumns + ` FROM modlog`
+	var args []interface{}
+	if log.Cursor != "" {
+		_, afterID, err := models.DecodeCursor(log.Cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("ModerationLog: %w", err)
+		}
+		query += ` WHERE id < ?`
+		args = append(args, afterID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit+1)
+	rows, err := store.db.QueryContext(c, store.q(query), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("ModerationLog: could not collect entries: %v", err)
+	}
+	defer rows.Close()
+	var (
+		actions = make([]models.ModAction, 0)
+		ids     []int64
+	)
+	for rows.Next() {
+		var id int64
+		action, err := scanModAction(rows, &id)
+		if err != nil {
+			return nil, "", fmt.Errorf("ModerationLog: could not collect entries: %v", err)
+		}
+		actions = append(actions, action)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("ModerationLog: could not collect entries: %v", err)
+	}
+	var next string
+	if len(actions) > limit {
+		actions = actions[:limit]
+		next = models.EncodeCursor(0, ids[limit-1])
+	}
+	return actions, next, nil
+}
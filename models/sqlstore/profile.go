@@ -0,0 +1,67 @@
+package sqlstore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// PostsBy collects a page of a user's posts or comments, newest first.
+// Cursors point behind the ID of the last post, since IDs increase over time.
+func (store *Store) PostsBy(c context.Context, author string, history models.History) ([]models.Post, []int64, string, error) {
+	query := `SELECT id, ` + postColumns + ` FROM posts WHERE author = ? AND NOT deleted`
+	args := []interface{}{author}
+	if history.Comments {
+		query += ` AND parent <> 0`
+	} else {
+		query += ` AND parent = 0`
+	}
+	if !history.Anonymous {
+		query += ` AND NOT anonymous`
+	}
+	if history.Cursor != "" {
+		_, before, err := models.DecodeCursor(history.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("PostsBy: %w", err)
+		}
+		query += ` AND id < ?`
+		args = append(args, before)
+	}
+	limit := history.PageSize()
+	posts, ids, err := store.queryPosts(c, query+` ORDER BY id DESC LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("PostsBy: could not collect posts: %v", err)
+	}
+	var next string
+	if len(posts) > limit {
+		posts, ids = posts[:limit], ids[:limit]
+		next = models.EncodeCursor(0, ids[limit-1])
+	}
+	return posts, ids, next, nil
+}
+
+// GetStats summarizes the posts, karma and votes of a user.
+func (store *Store) GetStats(c context.Context, author string) (models.UserStats, error) {
+	var (
+		stats               models.UserStats
+		postKarma, comKarma float64
+	)
+	if err := store.db.QueryRowContext(c, store.q(`SELECT
+			COALESCE(SUM(CASE WHEN parent = 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN parent <> 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN parent = 0 THEN rank ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN parent <> 0 THEN rank ELSE 0 END), 0)
+		FROM posts WHERE author = ? AND NOT anonymous`), author).Scan(&stats.Posts, &stats.Comments, &postKarma, &comKarma); err != nil {
+		return stats, fmt.Errorf("GetStats: could not count posts: %v", err)
+	}
+	stats.PostKarma, stats.CommentKarma = int(postKarma), int(comKarma)
+	if err := store.db.QueryRowContext(c, store.q(`SELECT
+			COALESCE(SUM(CASE WHEN upvote THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN upvote THEN 0 ELSE 1 END), 0)
+		FROM votes WHERE author = ?`), author).Scan(&stats.Upvotes, &stats.Downvotes); err != nil {
+		return stats, fmt.Errorf("GetStats: could not count votes: %v", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,104 @@
+package sqlstore
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// reportColumns lists the columns scanned by scanReport.
+const reportColumns = `post, reporter, reason, date`
+
+// scanReport reads a report selected using reportColumns.
+func scanReport(row scanner) (models.Report, error) {
+	var report models.Report
+	err := row.Scan(&report.Post, &report.Reporter, &report.Reason, &report.Date)
+	return report, err
+}
+
+// SubmitReport records a user's report of a post and hides the post once its pending reports reach the threshold.
+func (store *Store) SubmitReport(c context.Context, report models.Report, threshold int) (models.Post, error) {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post, err := store.lockPost(c, tx, report.Post)
+	if err != nil {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not find post: %w", notFound(err))
+	}
+	res, err := tx.ExecContext(c, store.q(`INSERT INTO reports (`+reportColumns+`) VALUES (?, ?, ?, ?)
+		ON CONFLICT (post, reporter) DO NOTHING`), report.Post, report.Reporter, report.Reason, report.Date)
+	if err != nil {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not store report: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not store report: %v", err)
+	} else if n == 0 {
+		return post, nil
+	}
+	post.AddReport(threshold)
+	if _, err := tx.ExecContext(c, store.q(`UPDATE posts SET reports = ?, hidden = ? WHERE id = ?`),
+		post.Reports, post.Hidden, report.Post); err != nil {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not update post: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Post{}, fmt.Errorf("SubmitReport: could not commit transaction: %v", err)
+	}
+	return post, nil
+}
+
+// ReportedPosts collects a page of the posts with pending reports ordered by ID.
+// Cursors point behind the ID of the last post.
+func (store *Store) ReportedPosts(c context.Context, queue models.ReportQueue) ([]models.Post, []int64, string, error) {
+	limit := queue.PageSize()
+	query := `SELECT id, ` + postColumns + ` FROM posts WHERE reports > 0`
+	var args []interface{}
+	if queue.Cursor != "" {
+		_, afterID, err := models.DecodeCursor(queue.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("ReportedPosts: %w", err)
+		}
+		query += ` AND id > ?`
+		args = append(args, afterID)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, limit+1)
+	posts, ids, err := store.queryPosts(c, query, args...)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("ReportedPosts: could not collect posts: %v", err)
+	}
+	var next string
+	if len(posts) > limit {
+		posts, ids = posts[:limit], ids[:limit]
+		next = models.EncodeCursor(0, ids[limit-1])
+	}
+	return posts, ids, next, nil
+}
+
+// GetReports retrieves the pending reports on a batch of posts ordered by date, keyed by post ID.
+func (store *Store) GetReports(c context.Context, ids []int64) (map[int64][]models.Report, error) {
+	reports := make(map[int64][]models.Report)
+	if len(ids) == 0 {
+		return reports, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := store.db.QueryContext(c, store.q(`SELECT `+reportColumns+` FROM reports WHERE post IN (`+placeholders(len(ids))+`) ORDER BY date`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetReports: could not collect reports: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetReports: could not collect reports: %v", err)
+		}
+		reports[report.Post] = append(reports[report.Post], report)
+	}
+	return reports, rows.Err()
+}
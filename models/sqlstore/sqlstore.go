@@ -0,0 +1,465 @@
+// Package sqlstore implements models.Store on top of a SQL database like SQLite or PostgreSQL.
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// Store is a models.Store backed by a SQL database.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// Open connects to the database using the given driver and migrates its schema.
+func Open(driver, dsn string) (*Store, error) {
+	dialect, err := DialectFor(driver)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %v", err)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Open: could not open database: %v", err)
+	}
+	store, err := New(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// New initializes a new store on an existing database handle and migrates its schema.
+func New(db *sql.DB, dialect Dialect) (*Store, error) {
+	if dialect.MaxConns > 0 {
+		db.SetMaxOpenConns(dialect.MaxConns)
+	}
+	store := &Store{db, dialect}
+	if err := store.Migrate(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close closes the underlying database.
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+// q rewrites a query into the dialect's placeholder style.
+func (store *Store) q(query string) string {
+	return store.dialect.rebind(query)
+}
+
+// karmaFromVotes computes the karma of the user in the surrounding users row from the votes on their posts.
+const karmaFromVotes = `(SELECT COALESCE(SUM(CASE WHEN votes.upvote THEN 1 ELSE -1 END), 0)
+	FROM votes JOIN posts ON posts.id = votes.post WHERE posts.author = users.id)`
+
+// GetKarma retrieves the amount of karma a user has earned.
+func (store *Store) GetKarma(c context.Context, author string) (int, error) {
+	var karma int
+	if err := store.db.QueryRowContext(c, store.q(`SELECT karma FROM users WHERE id = ?`), author).Scan(&karma); err != nil {
+		return 0, fmt.Errorf("GetKarma: could not find user: %w", notFound(err))
+	}
+	return karma, nil
+}
+
+// ReconcileKarma recomputes the karma of all users from the votes on their posts.
+func (store *Store) ReconcileKarma(c context.Context) (int, error) {
+	res, err := store.db.ExecContext(c, `UPDATE users SET karma = `+karmaFromVotes+` WHERE karma <> `+karmaFromVotes)
+	if err != nil {
+		return 0, fmt.Errorf("ReconcileKarma: could not update karma: %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ReconcileKarma: could not update karma: %v", err)
+	}
+	return int(n), nil
+}
+
+// addKarma adjusts the karma of a user inside the transaction. Unknown users are skipped.
+func (store *Store) addKarma(c context.Context, tx *sql.Tx, author string, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(c, store.q(`UPDATE users SET karma = karma + ? WHERE id = ?`), delta, author)
+	return err
+}
+
+// SubmitVote atomically toggles a user's vote on a post and updates the vote counters and rank of the post
+// as well as the karma of its author.
+// Concurrent votes on the same post are serialized by locking the post's row.
+func (store *Store) SubmitVote(c context.Context, author string, id int64, upvote bool) (bool, error) {
+	keep, _, err := store.submitVote(c, author, id, upvote, true)
+	return keep, err
+}
+
+// CastVote casts a vote like SubmitVote, but fails if the user already voted the same way.
+// It reports whether an opposite vote was flipped instead of a new vote being cast.
+func (store *Store) CastVote(c context.Context, author string, id int64, upvote bool) (bool, error) {
+	_, flipped, err := store.submitVote(c, author, id, upvote, false)
+	return flipped, err
+}
+
+// submitVote applies a vote in a transaction, a repeated vote is retracted if retract is set.
+// It reports whether the user has a vote on the post afterwards and whether an opposite vote was flipped.
+func (store *Store) submitVote(c context.Context, author string, id int64, upvote, retract bool) (bool, bool, error) {
+	// verify input
+	vote, err := models.NewVote(author, id, upvote)
+	if err != nil {
+		return false, false, err
+	}
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post, err := store.lockPost(c, tx, id)
+	if err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not find post: %w", notFound(err))
+	}
+	if locked, err := store.threadLocked(c, tx, id, post); err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not find thread: %w", notFound(err))
+	} else if locked {
+		return false, false, fmt.Errorf("SubmitVote: thread is locked: %w", models.ErrLocked)
+	}
+	var prev *models.Vote
+	if v, err := scanVote(tx.QueryRowContext(c, store.q(`SELECT `+voteColumns+` FROM votes WHERE post = ? AND author = ?`), id, vote.Author)); err == nil {
+		prev = &v
+	} else if err != sql.ErrNoRows {
+		return false, false, fmt.Errorf("SubmitVote: failed to retrieve vote status: %v", err)
+	}
+	if !retract && vote.Repeats(prev) {
+		return false, false, fmt.Errorf("SubmitVote: %w", models.ErrAlreadyVoted)
+	}
+	score := post.Score()
+	keep := post.ApplyVote(prev, vote)
+	if keep {
+		_, err = tx.ExecContext(c, store.q(`INSERT INTO votes (post, author, upvote, date) VALUES (?, ?, ?, ?)
+			ON CONFLICT (post, author) DO UPDATE SET upvote = excluded.upvote, date = excluded.date`), vote.Post, vote.Author, vote.Upvote, vote.Date)
+	} else {
+		_, err = tx.ExecContext(c, store.q(`DELETE FROM votes WHERE post = ? AND author = ?`), id, vote.Author)
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not submit vote: %v", err)
+	}
+	if err := store.saveCounters(c, tx, id, post); err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not update rank: %v", err)
+	}
+	if err := store.addKarma(c, tx, post.Author, post.Score()-score); err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not update karma: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, false, fmt.Errorf("SubmitVote: could not submit vote: %v", err)
+	}
+	return keep, keep && prev != nil, nil
+}
+
+// notFound translates missing rows into models.ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return models.ErrNotFound
+	}
+	return err
+}
+
+// lockPost loads a post and locks it until the transaction ends.
+func (store *Store) lockPost(c context.Context, tx *sql.Tx, id int64) (models.Post, error) {
+	return scanPost(tx.QueryRowContext(c, store.q(`SELECT `+postColumns+` FROM posts WHERE id = ?`+store.dialect.ForUpdate), id))
+}
+
+// threadLocked reports if the thread of the post with the given ID is locked.
+func (store *Store) threadLocked(c context.Context, tx *sql.Tx, id int64, post models.Post) (bool, error) {
+	if root := post.ThreadRoot(id); root != id {
+		err := tx.QueryRowContext(c, store.q(`SELECT locked FROM posts WHERE id = ?`), root).Scan(&post.Locked)
+		return post.Locked, err
+	}
+	return post.Locked, nil
+}
+
+// saveCounters writes the denormalized counters and ranks of a post.
+func (store *Store) saveCounters(c context.Context, tx *sql.Tx, id int64, post models.Post) error {
+	_, err := tx.ExecContext(c, store.q(`UPDATE posts SET upvotes = ?, downvotes = ?, comments = ?, rank = ?, hot = ?, confidence = ? WHERE id = ?`),
+		post.Upvotes, post.Downvotes, post.Comments, post.Rank, post.Hot, post.Confidence, id)
+	return err
+}
+
+// GetVoteBy retrieves a vote on a post by a user.
+func (store *Store) GetVoteBy(c context.Context, id int64, author string) (models.Vote, error) {
+	vote, err := scanVote(store.db.QueryRowContext(c, store.q(`SELECT `+voteColumns+` FROM votes WHERE post = ? AND author = ?`), id, author))
+	if err == sql.ErrNoRows {
+		return vote, fmt.Errorf("GetVoteBy: user has voted multiple times or never")
+	} else if err != nil {
+		return vote, fmt.Errorf("GetVoteBy: could not collect votes: %v", err)
+	}
+	return vote, nil
+}
+
+// GetVotesBy retrieves the votes of a user on a batch of posts, keyed by post ID.
+func (store *Store) GetVotesBy(c context.Context, ids []int64, author string) (map[int64]models.Vote, error) {
+	votes := make(map[int64]models.Vote)
+	if len(ids) == 0 {
+		return votes, nil
+	}
+	args := []interface{}{author}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := store.db.QueryContext(c, store.q(`SELECT `+voteColumns+` FROM votes WHERE author = ? AND post IN (`+placeholders(len(ids))+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetVotesBy: could not collect votes: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		vote, err := scanVote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetVotesBy: could not collect votes: %v", err)
+		}
+		votes[vote.Post] = vote
+	}
+	return votes, rows.Err()
+}
+
+// HasVotedOn retrieves if the user has submitted a vote on the given post.
+func (store *Store) HasVotedOn(c context.Context, post int64, author string) (bool, error) {
+	var count int
+	if err := store.db.QueryRowContext(c, store.q(`SELECT COUNT(*) FROM votes WHERE post = ? AND author = ?`), post, author).Scan(&count); err != nil {
+		return false, fmt.Errorf("HasVotedOn: could not collect votes: %v", err)
+	}
+	return count > 0, nil
+}
+
+// NumberOfVotes calculates the number of votes a post has received. This is a relative number.
+func (store *Store) NumberOfVotes(c context.Context, id int64) (int, error) {
+	post, err := store.GetPost(c, id)
+	if err != nil {
+		return 0, fmt.Errorf("NumberOfVotes: %w", err)
+	}
+	return post.Score(), nil
+}
+
+// rankColumns maps rankings to the column storing the rank.
+var rankColumns = map[models.Ranking]string{
+	models.Hot:  "hot",
+	models.Top:  "rank",
+	models.Best: "confidence",
+}
+
+// TopPosts collects a page of top-level posts using keyset pagination on the rank and ID.
+func (store *Store) TopPosts(c context.Context, listing models.Listing) ([]models.Post, []int64, string, error) {
+	column := rankColumns[listing.Ranking]
+	limit := listing.PageSize()
+	filter := `parent = 0 AND NOT removed AND NOT hidden AND NOT deleted`
+	var filterArgs []interface{}
+	if listing.Community != "" {
+		filter += ` AND community = ?`
+		filterArgs = append(filterArgs, listing.Community)
+	}
+	query := `SELECT id, ` + postColumns + ` FROM posts WHERE ` + filter + ` AND NOT pinned AND rank >= ?`
+	args := append(append([]interface{}{}, filterArgs...), listing.MinRank)
+	if listing.Cursor != "" {
+		afterRank, afterID, err := models.DecodeCursor(listing.Cursor)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: %w", err)
+		}
+		query += ` AND (` + column + ` < ? OR (` + column + ` = ? AND id > ?))`
+		args = append(args, afterRank, afterRank, afterID)
+	}
+	query += ` ORDER BY ` + column + ` DESC, id LIMIT ?`
+	args = append(args, limit+1)
+	posts, ids, err := store.queryPosts(c, query, args...)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("TopPosts: could not collect posts: %v", err)
+	}
+	var next string
+	if len(posts) > limit {
+		posts, ids = posts[:limit], ids[:limit]
+		next = models.EncodeCursor(listing.Ranking.Of(posts[limit-1]), ids[limit-1])
+	}
+	if listing.Cursor == "" {
+		pinned, pinnedIDs, err := store.queryPosts(c, `SELECT id, `+postColumns+` FROM posts WHERE `+filter+` AND pinned ORDER BY id`, filterArgs...)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("TopPosts: could not collect pinned posts: %v", err)
+		}
+		posts, ids = append(pinned, posts...), append(pinnedIDs, ids...)
+	}
+	return posts, ids, next, nil
+}
+
+// UpdateRank recomputes the denormalized counters and ranks of a post from its votes and replies.
+// The karma of the author is adjusted accordingly.
+func (store *Store) UpdateRank(c context.Context, id int64) error {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("UpdateRank: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post, err := store.lockPost(c, tx, id)
+	if err != nil {
+		return fmt.Errorf("UpdateRank: could not find post: %w", notFound(err))
+	}
+	score := post.Score()
+	if err := tx.QueryRowContext(c, store.q(`SELECT
+		COALESCE(SUM(CASE WHEN upvote THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN upvote THEN 0 ELSE 1 END), 0)
+		FROM votes WHERE post = ?`), id).Scan(&post.Upvotes, &post.Downvotes); err != nil {
+		return fmt.Errorf("UpdateRank: could not count votes: %v", err)
+	}
+	if err := tx.QueryRowContext(c, store.q(`SELECT COUNT(*) FROM posts WHERE parent = ?`), id).Scan(&post.Comments); err != nil {
+		return fmt.Errorf("UpdateRank: could not count comments: %v", err)
+	}
+	post.Rerank()
+	if err := store.saveCounters(c, tx, id, post); err != nil {
+		return fmt.Errorf("UpdateRank: could not save changes: %v", err)
+	}
+	if err := store.addKarma(c, tx, post.Author, post.Score()-score); err != nil {
+		return fmt.Errorf("UpdateRank: could not update karma: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("UpdateRank: could not save changes: %v", err)
+	}
+	return nil
+}
+
+// SubmitPost stores a post in the database and updates the comment counter of its parent.
+func (store *Store) SubmitPost(c context.Context, author, text, color, community string, parent int64, anonymous bool) (int64, error) {
+	// verify input
+	post, err := models.NewPost(author, text, color, parent, anonymous)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return 0, fmt.Errorf("SubmitPost: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	post.Community = community
+	if parent != 0 {
+		parentPost, err := store.lockPost(c, tx, parent)
+		if err != nil {
+			return 0, fmt.Errorf("SubmitPost: could not find parent: %w", notFound(err))
+		}
+		post.Root = parentPost.ThreadRoot(parent)
+		post.Community = parentPost.Community
+		if locked, err := store.threadLocked(c, tx, parent, parentPost); err != nil {
+			return 0, fmt.Errorf("SubmitPost: could not find thread: %w", notFound(err))
+		} else if locked {
+			return 0, fmt.Errorf("SubmitPost: thread is locked: %w", models.ErrLocked)
+		}
+		if _, err := tx.ExecContext(c, store.q(`UPDATE posts SET comments = comments + 1 WHERE id = ?`), parent); err != nil {
+			return 0, fmt.Errorf("SubmitPost: could not update parent: %v", err)
+		}
+	}
+	if post.Community != "" {
+		community, err := scanCommunity(tx.QueryRowContext(c, store.q(`SELECT `+communityColumns+` FROM communities WHERE slug = ?`), post.Community))
+		if err != nil {
+			return 0, fmt.Errorf("SubmitPost: could not find community: %w", notFound(err))
+		} else if !community.Accepts(post.Author) {
+			return 0, fmt.Errorf("SubmitPost: community does not accept posts: %w", models.ErrForbidden)
+		}
+	}
+	var id int64
+	if err := tx.QueryRowContext(c, store.q(`INSERT INTO posts (author, parent, root, text, color, date, rank, hot, confidence, anonymous, community)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`), post.Author, post.Parent, post.Root, post.Text, post.Color, post.Date, post.Rank, post.Hot, post.Confidence, post.Anonymous, post.Community).Scan(&id); err != nil {
+		return 0, fmt.Errorf("SubmitPost: could not submit post: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("SubmitPost: could not submit post: %v", err)
+	}
+	return id, nil
+}
+
+// NumberOfComments retrieves the number of direct replies a post has received.
+func (store *Store) NumberOfComments(c context.Context, id int64) (int, error) {
+	post, err := store.GetPost(c, id)
+	if err != nil {
+		return 0, fmt.Errorf("NumberOfComments: %w", err)
+	}
+	return post.Comments, nil
+}
+
+// GetPost retrieves a post from the database.
+func (store *Store) GetPost(c context.Context, id int64) (models.Post, error) {
+	post, err := scanPost(store.db.QueryRowContext(c, store.q(`SELECT `+postColumns+` FROM posts WHERE id = ?`), id))
+	if err != nil {
+		return post, fmt.Errorf("GetPost: could not find post: %w", notFound(err))
+	}
+	return post, nil
+}
+
+// GetComments retrieves all comments on the specified post ordered by date.
+func (store *Store) GetComments(c context.Context, id int64) ([]models.Post, []int64, error) {
+	comments, ids, err := store.queryPosts(c, `SELECT id, `+postColumns+` FROM posts
+		WHERE parent = ? ORDER BY date, id`, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetComments: could not collect posts: %v", err)
+	}
+	return comments, ids, nil
+}
+
+// postColumns lists the columns scanned by scanPost.
+const postColumns = `author, parent, root, text, color, date, rank, hot, confidence, upvotes, downvotes, comments, anonymous, community, removed, locked, pinned, reports, hidden, revisions, deleted`
+
+// scanner is implemented by sql.Row and sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPost reads a post selected using postColumns, optionally preceded by extra columns.
+func scanPost(row scanner, extra ...interface{}) (models.Post, error) {
+	var post models.Post
+	dest := append(extra, &post.Author, &post.Parent, &post.Root, &post.Text, &post.Color, &post.Date, &post.Rank, &post.Hot, &post.Confidence, &post.Upvotes, &post.Downvotes, &post.Comments, &post.Anonymous, &post.Community, &post.Removed, &post.Locked, &post.Pinned, &post.Reports, &post.Hidden, &post.Revisions, &post.Deleted)
+	err := row.Scan(dest...)
+	return post, err
+}
+
+// voteColumns lists the columns scanned by scanVote.
+const voteColumns = `post, author, upvote, date`
+
+// scanVote reads a vote selected using voteColumns.
+func scanVote(row scanner) (models.Vote, error) {
+	var vote models.Vote
+	err := row.Scan(&vote.Post, &vote.Author, &vote.Upvote, &vote.Date)
+	return vote, err
+}
+
+// GetThread retrieves all replies in the thread of a top-level post ordered by date.
+func (store *Store) GetThread(c context.Context, id int64) ([]models.Post, []int64, error) {
+	posts, ids, err := store.queryPosts(c, `SELECT id, `+postColumns+` FROM posts
+		WHERE root = ? ORDER BY date, id`, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetThread: could not collect posts: %v", err)
+	}
+	return posts, ids, nil
+}
+
+// queryPosts runs a query selecting the ID followed by postColumns.
+func (store *Store) queryPosts(c context.Context, query string, args ...interface{}) ([]models.Post, []int64, error) {
+	rows, err := store.db.QueryContext(c, store.q(query), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var (
+		posts []models.Post
+		ids   []int64
+	)
+	for rows.Next() {
+		var id int64
+		post, err := scanPost(rows, &id)
+		if err != nil {
+			return nil, nil, err
+		}
+		posts = append(posts, post)
+		ids = append(ids, id)
+	}
+	return posts, ids, rows.Err()
+}
+
+// compile-time check that Store implements models.Store
+var _ models.Store = (*Store)(nil)
@@ -0,0 +1,129 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/models/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, storetest.Backend{
+		New: func(t *testing.T) models.Store { return openAt(t, len(migrations)) },
+		SetKarma: func(t *testing.T, store models.Store, user string, karma int) {
+			if _, err := store.(*Store).db.Exec(`UPDATE users SET karma = ? WHERE id = ?`, karma, user); err != nil {
+				t.Fatal(err)
+			}
+		},
+	})
+}
+
+// countingConnector opens connections of a driver which count the statements they run.
+// The connections hide the optional query interfaces of the driver, so that every
+// query and exec is prepared.
+type countingConnector struct {
+	driver  driver.Driver
+	dsn     string
+	queries int64
+}
+
+func (connector *countingConnector) Connect(c context.Context) (driver.Conn, error) {
+	conn, err := connector.driver.Open(connector.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn, &connector.queries}, nil
+}
+
+func (connector *countingConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// countingConn counts the statements prepared on a connection.
+type countingConn struct {
+	driver.Conn
+	queries *int64
+}
+
+func (conn countingConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt64(conn.queries, 1)
+	return conn.Conn.Prepare(query)
+}
+
+// newCountingStore opens an in-memory SQLite store counting its queries.
+func newCountingStore(tb testing.TB) (*Store, *countingConnector) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	connector := &countingConnector{driver: db.Driver(), dsn: ":memory:"}
+	db.Close()
+	store, err := New(sql.OpenDB(connector), SQLite)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	return store, connector
+}
+
+// listingQueries counts the queries needed to render a page of the given size for a viewer,
+// which are collecting the posts, resolving the names of their authors and looking up the
+// votes of the viewer.
+func listingQueries(tb testing.TB, store *Store, connector *countingConnector, viewer string, limit int) int64 {
+	c := context.Background()
+	before := atomic.LoadInt64(&connector.queries)
+	posts, ids, _, err := store.TopPosts(c, models.Listing{Ranking: models.Hot, Limit: limit, MinRank: -10.0})
+	if err != nil {
+		tb.Fatal(err)
+	} else if len(posts) != limit {
+		tb.Fatalf("got %d posts, want %d", len(posts), limit)
+	}
+	if _, err := models.LoadNames(c, store, viewer, nil, posts); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := store.GetVotesBy(c, ids, viewer); err != nil {
+		tb.Fatal(err)
+	}
+	return atomic.LoadInt64(&connector.queries) - before
+}
+
+// BenchmarkListing verifies that the number of queries per listing page does not grow with the page size.
+func BenchmarkListing(b *testing.B) {
+	store, connector := newCountingStore(b)
+	c := context.Background()
+	viewer, err := store.EnsureUser(c, "viewer@example.com")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < models.MaxPageSize; i++ {
+		author, err := store.EnsureUser(c, "author"+strconv.Itoa(i)+"@example.com")
+		if err != nil {
+			b.Fatal(err)
+		}
+		id, err := store.SubmitPost(c, author.ID, "post "+strconv.Itoa(i), "blue", "", 0, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := store.SubmitVote(c, viewer.ID, id, i%2 == 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+	want := listingQueries(b, store, connector, viewer.ID, 1)
+	for _, limit := range []int{1, 10, models.MaxPageSize} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if got := listingQueries(b, store, connector, viewer.ID, limit); got != want {
+					b.Fatalf("page of %d posts needed %d queries, want %d", limit, got, want)
+				}
+			}
+			b.ReportMetric(float64(want), "queries/op")
+		})
+	}
+}
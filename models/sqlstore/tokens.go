@@ -0,0 +1,77 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// tokenColumns lists the columns scanned by scanToken.
+const tokenColumns = `hash, owner, name, scopes, created`
+
+// scanToken reads a token selected using tokenColumns. Scopes are stored space-separated.
+func scanToken(row scanner) (models.Token, error) {
+	var (
+		token  models.Token
+		scopes string
+	)
+	err := row.Scan(&token.Hash, &token.Owner, &token.Name, &scopes, &token.Created)
+	token.Scopes = strings.Fields(scopes)
+	return token, err
+}
+
+// CreateToken stores a new API token.
+func (store *Store) CreateToken(c context.Context, token models.Token) error {
+	if _, err := store.db.ExecContext(c, store.q(`INSERT INTO tokens (`+tokenColumns+`) VALUES (?, ?, ?, ?, ?)`),
+		token.Hash, token.Owner, token.Name, strings.Join(token.Scopes, " "), token.Created); err != nil {
+		return fmt.Errorf("CreateToken: could not store token: %v", err)
+	}
+	return nil
+}
+
+// GetToken retrieves an API token by the hash of its secret.
+func (store *Store) GetToken(c context.Context, hash string) (models.Token, error) {
+	token, err := scanToken(store.db.QueryRowContext(c, store.q(`SELECT `+tokenColumns+` FROM tokens WHERE hash = ?`), hash))
+	if err != nil {
+		return token, fmt.Errorf("GetToken: could not find token: %w", notFound(err))
+	}
+	return token, nil
+}
+
+// TokensBy retrieves all API tokens of a user ordered by creation date.
+func (store *Store) TokensBy(c context.Context, owner string) ([]models.Token, error) {
+	rows, err := store.db.QueryContext(c, store.q(`SELECT `+tokenColumns+` FROM tokens WHERE owner = ? ORDER BY created`), owner)
+	if err != nil {
+		return nil, fmt.Errorf("TokensBy: could not collect tokens: %v", err)
+	}
+	defer rows.Close()
+	tokens := make([]models.Token, 0)
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("TokensBy: could not collect tokens: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("TokensBy: could not collect tokens: %v", err)
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes an API token of a user.
+func (store *Store) RevokeToken(c context.Context, owner, hash string) error {
+	res, err := store.db.ExecContext(c, store.q(`DELETE FROM tokens WHERE hash = ? AND owner = ?`), hash, owner)
+	if err != nil {
+		return fmt.Errorf("RevokeToken: could not delete token: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("RevokeToken: could not delete token: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("RevokeToken: could not find token: %w", models.ErrNotFound)
+	}
+	return nil
+}
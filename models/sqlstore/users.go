@@ -0,0 +1,136 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// userColumns lists the columns scanned by scanUser.
+const userColumns = `id, handle, login, created, karma`
+
+// scanUser reads a user selected using userColumns.
+func scanUser(row scanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Handle, &user.Login, &user.Created, &user.Karma)
+	return user, err
+}
+
+// EnsureUser retrieves the user with the given login, creating a user with
+// a generated handle on their first login.
+func (store *Store) EnsureUser(c context.Context, login string) (models.User, error) {
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return models.User{}, fmt.Errorf("EnsureUser: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	user, err := scanUser(tx.QueryRowContext(c, store.q(`SELECT `+userColumns+` FROM users WHERE login = ?`), login))
+	if err == nil {
+		return user, nil
+	} else if err != sql.ErrNoRows {
+		return user, fmt.Errorf("EnsureUser: could not look up login: %v", err)
+	}
+	if user, err = models.NewUser(login); err != nil {
+		return user, err
+	}
+	for attempt := 0; ; attempt++ {
+		var taken int
+		if err := tx.QueryRowContext(c, store.q(`SELECT COUNT(*) FROM users WHERE handle = ?`), user.Handle).Scan(&taken); err != nil {
+			return user, fmt.Errorf("EnsureUser: could not look up handle: %v", err)
+		} else if taken == 0 {
+			break
+		}
+		if err := user.RegenerateHandle(attempt); err != nil {
+			return user, err
+		}
+	}
+	if _, err := tx.ExecContext(c, store.q(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?)`),
+		user.ID, user.Handle, user.Login, user.Created, user.Karma); err != nil {
+		return user, fmt.Errorf("EnsureUser: could not store user: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return user, fmt.Errorf("EnsureUser: could not commit transaction: %v", err)
+	}
+	return user, nil
+}
+
+// GetUser retrieves a user by ID.
+func (store *Store) GetUser(c context.Context, id string) (models.User, error) {
+	user, err := scanUser(store.db.QueryRowContext(c, store.q(`SELECT `+userColumns+` FROM users WHERE id = ?`), id))
+	if err != nil {
+		return user, fmt.Errorf("GetUser: could not find user: %w", notFound(err))
+	}
+	return user, nil
+}
+
+// GetUserByHandle retrieves a user by handle.
+func (store *Store) GetUserByHandle(c context.Context, handle string) (models.User, error) {
+	user, err := scanUser(store.db.QueryRowContext(c, store.q(`SELECT `+userColumns+` FROM users WHERE handle = ?`), handle))
+	if err != nil {
+		return user, fmt.Errorf("GetUserByHandle: could not find user: %w", notFound(err))
+	}
+	return user, nil
+}
+
+// GetUsers retrieves a batch of users, keyed by ID. Unknown IDs are skipped.
+func (store *Store) GetUsers(c context.Context, ids []string) (models.Users, error) {
+	users := make(models.Users, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := store.db.QueryContext(c, store.q(`SELECT `+userColumns+` FROM users WHERE id IN (`+placeholders(len(ids))+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetUsers: could not collect users: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetUsers: could not collect users: %v", err)
+		}
+		users[user.ID] = user
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetUsers: could not collect users: %v", err)
+	}
+	return users, nil
+}
+
+// SetHandle changes the handle of a user, failing if it is already taken.
+func (store *Store) SetHandle(c context.Context, id, handle string) error {
+	handle, err := models.NormalizeHandle(handle)
+	if err != nil {
+		return err
+	}
+	tx, err := store.db.BeginTx(c, nil)
+	if err != nil {
+		return fmt.Errorf("SetHandle: could not begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	var taken int
+	if err := tx.QueryRowContext(c, store.q(`SELECT COUNT(*) FROM users WHERE handle = ? AND id <> ?`), handle, id).Scan(&taken); err != nil {
+		return fmt.Errorf("SetHandle: could not look up handle: %v", err)
+	} else if taken > 0 {
+		return fmt.Errorf("SetHandle: handle is already taken")
+	}
+	res, err := tx.ExecContext(c, store.q(`UPDATE users SET handle = ? WHERE id = ?`), handle, id)
+	if err != nil {
+		return fmt.Errorf("SetHandle: could not update handle: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("SetHandle: could not update handle: %v", err)
+	} else if n == 0 {
+		return fmt.Errorf("SetHandle: could not find user: %w", models.ErrNotFound)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("SetHandle: could not commit transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package storetest
+
+import (
+	"time"
+
+	"github.com/lnsp/zwig/models"
+)
+
+func testEdit(s *suite) {
+	author, other := s.user(), s.user()
+	id := s.post(author, 0)
+	original := s.get(id).Text
+	for _, text := range []string{"first edit", "second edit"} {
+		if err := s.store.EditPost(s.c, author, id, text, time.Hour); err != nil {
+			s.Fatalf("EditPost: %v", err)
+		}
+	}
+	if post := s.get(id); post.Text != "second edit" || post.Revisions != 2 {
+		s.Errorf("edited post has text %q and %d revisions, want %q and 2", post.Text, post.Revisions, "second edit")
+	}
+	revisions, err := s.store.Revisions(s.c, id)
+	if err != nil {
+		s.Fatalf("Revisions: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Text != original || revisions[1].Text != "first edit" || revisions[0].Post != id {
+		s.Errorf("Revisions = %+v, want the original text and the first edit", revisions)
+	}
+
+	s.expect("EditPost by another user", s.store.EditPost(s.c, other, id, "text", time.Hour), models.ErrForbidden)
+	s.expect("EditPost without text", s.store.EditPost(s.c, author, id, " ", time.Hour), models.ErrInvalidInput)
+	s.expect("EditPost of a missing post", s.store.EditPost(s.c, author, id+100, "text", time.Hour), models.ErrNotFound)
+	time.Sleep(10 * time.Millisecond)
+	s.expect("EditPost after the window", s.store.EditPost(s.c, author, id, "text", time.Millisecond), models.ErrLocked)
+	if err := s.store.EditPost(s.c, author, id, "late edit", -1); err != nil {
+		s.Errorf("EditPost without window: %v", err)
+	}
+
+	hidden := s.post(author, 0)
+	s.report(other, hidden, 1)
+	s.expect("EditPost of a hidden post", s.store.EditPost(s.c, author, hidden, "text", -1), models.ErrLocked)
+	_, err = s.store.Revisions(s.c, id+100)
+	s.expect("Revisions of a missing post", err, models.ErrNotFound)
+}
+
+func testDelete(s *suite) {
+	author, other := s.user(), s.user()
+	id := s.post(author, 0)
+	reply := s.post(other, id)
+	if err := s.store.EditPost(s.c, author, id, "edited", -1); err != nil {
+		s.Fatalf("EditPost: %v", err)
+	}
+	s.expect("DeletePost by another user", s.store.DeletePost(s.c, other, id), models.ErrForbidden)
+	if err := s.store.DeletePost(s.c, author, id); err != nil {
+		s.Fatalf("DeletePost: %v", err)
+	}
+	if post := s.get(id); !post.Deleted || post.Text != "" || post.Revisions != 0 {
+		s.Errorf("deleted post = %+v, want it deleted without text and revisions", post)
+	}
+	if revisions, err := s.store.Revisions(s.c, id); err != nil || len(revisions) != 0 {
+		s.Errorf("Revisions of a deleted post = %+v, %v, want none", revisions, err)
+	}
+	if _, ids, err := s.store.GetComments(s.c, id); err != nil || len(ids) != 1 || ids[0] != reply {
+		s.Errorf("GetComments of a deleted post = %v, %v, want the reply", ids, err)
+	}
+	_, ids, _, err := s.store.TopPosts(s.c, models.Listing{MinRank: -10})
+	if err != nil {
+		s.Fatalf("TopPosts: %v", err)
+	}
+	s.ids("TopPosts with a deleted post", ids)
+	s.expect("DeletePost of a deleted post", s.store.DeletePost(s.c, author, id), models.ErrLocked)
+	s.expect("EditPost of a deleted post", s.store.EditPost(s.c, author, id, "text", -1), models.ErrLocked)
+	s.expect("DeletePost of a missing post", s.store.DeletePost(s.c, author, id+100), models.ErrNotFound)
+
+	removed := s.post(author, 0)
+	s.moderate(other, models.ActionRemove, removed)
+	s.expect("DeletePost of a removed post", s.store.DeletePost(s.c, author, removed), models.ErrLocked)
+}
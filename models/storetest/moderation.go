@@ -0,0 +1,177 @@
+package storetest
+
+import (
+	"github.com/lnsp/zwig/models"
+)
+
+// moderate applies a moderation action and fails on errors.
+func (s *suite) moderate(moderator, action string, id int64) {
+	s.Helper()
+	mod, err := models.NewModAction(moderator, action, id, "reason")
+	if err != nil {
+		s.Fatalf("NewModAction: %v", err)
+	}
+	if err := s.store.Moderate(s.c, mod); err != nil {
+		s.Fatalf("Moderate(%s): %v", action, err)
+	}
+}
+
+// report submits a report and returns the updated post.
+func (s *suite) report(reporter string, id int64, threshold int) models.Post {
+	s.Helper()
+	report, err := models.NewReport(reporter, id, "spam")
+	if err != nil {
+		s.Fatalf("NewReport: %v", err)
+	}
+	post, err := s.store.SubmitReport(s.c, report, threshold)
+	if err != nil {
+		s.Fatalf("SubmitReport: %v", err)
+	}
+	return post
+}
+
+func testModeration(s *suite) {
+	moderator, author := s.user(), s.user()
+	removed := s.post(author, 0)
+	pinned := s.post(author, 0)
+	thread := s.post(author, 0)
+	reply := s.post(author, thread)
+
+	s.moderate(moderator, models.ActionRemove, removed)
+	s.moderate(moderator, models.ActionPin, pinned)
+	_, ids, _, err := s.store.TopPosts(s.c, models.Listing{Ranking: models.Top, MinRank: -10})
+	if err != nil {
+		s.Fatalf("TopPosts: %v", err)
+	}
+	s.ids("TopPosts with removed and pinned posts", ids, pinned, thread)
+	s.moderate(moderator, models.ActionRestore, removed)
+	if post := s.get(removed); post.Removed {
+		s.Errorf("restored post is still removed")
+	}
+
+	// locking a reply locks its thread
+	s.moderate(moderator, models.ActionLock, reply)
+	if !s.get(thread).Locked || s.get(reply).Locked {
+		s.Errorf("lock was not applied to the top-level post of the thread")
+	}
+	_, err = s.store.SubmitPost(s.c, author, "text", "red", "", reply, false)
+	s.expect("SubmitPost in a locked thread", err, models.ErrLocked)
+	_, err = s.store.SubmitVote(s.c, author, reply, true)
+	s.expect("SubmitVote in a locked thread", err, models.ErrLocked)
+	err = s.store.EditPost(s.c, author, reply, "edited", -1)
+	s.expect("EditPost in a locked thread", err, models.ErrLocked)
+	s.moderate(moderator, models.ActionUnlock, thread)
+	s.post(author, reply)
+
+	mod, err := models.NewModAction(moderator, models.ActionPin, reply, "")
+	if err != nil {
+		s.Fatalf("NewModAction: %v", err)
+	}
+	s.expect("pinning a reply", s.store.Moderate(s.c, mod), models.ErrInvalidInput)
+	mod.Post = reply + 100
+	s.expect("moderating a missing post", s.store.Moderate(s.c, mod), models.ErrNotFound)
+
+	actions, next, err := s.store.ModerationLog(s.c, models.ModLog{Limit: 3})
+	if err != nil {
+		s.Fatalf("ModerationLog: %v", err)
+	}
+	if len(actions) != 3 || actions[0].Action != models.ActionUnlock || actions[0].Post != thread ||
+		actions[1].Action != models.ActionLock || actions[1].Post != thread || actions[2].Action != models.ActionRestore {
+		s.Errorf("ModerationLog = %+v, want the newest three actions", actions)
+	}
+	if actions, _, err := s.store.ModerationLog(s.c, models.ModLog{Limit: 3, Cursor: next}); err != nil || len(actions) != 2 ||
+		actions[0].Action != models.ActionPin || actions[1].Action != models.ActionRemove || actions[1].Moderator != moderator {
+		s.Errorf("second page of ModerationLog = %+v, %v, want the oldest two actions", actions, err)
+	}
+}
+
+func testReports(s *suite) {
+	author, reporter := s.user(), s.user()
+	first := s.post(author, 0)
+	second := s.post(author, 0)
+	s.post(author, 0)
+	if post := s.report(reporter, second, 0); post.Reports != 1 || post.Hidden {
+		s.Errorf("reported post has %d reports and is hidden: %t, want 1 and false", post.Reports, post.Hidden)
+	}
+	s.report(reporter, first, 0)
+	s.report(s.user(), first, 0)
+	_, err := s.store.SubmitReport(s.c, models.Report{Reporter: reporter, Post: second + 100, Reason: "spam"}, 0)
+	s.expect("SubmitReport on a missing post", err, models.ErrNotFound)
+
+	_, ids, next, err := s.store.ReportedPosts(s.c, models.ReportQueue{Limit: 1})
+	if err != nil {
+		s.Fatalf("ReportedPosts: %v", err)
+	}
+	s.ids("ReportedPosts", ids, first)
+	_, ids, _, err = s.store.ReportedPosts(s.c, models.ReportQueue{Limit: 1, Cursor: next})
+	if err != nil {
+		s.Fatalf("ReportedPosts: %v", err)
+	}
+	s.ids("second page of ReportedPosts", ids, second)
+	reports, err := s.store.GetReports(s.c, []int64{first, second})
+	if err != nil {
+		s.Fatalf("GetReports: %v", err)
+	}
+	if len(reports[first]) != 2 || len(reports[second]) != 1 || reports[second][0].Reporter != reporter || reports[second][0].Reason != "spam" {
+		s.Errorf("GetReports = %+v, want two reports on %d and one on %d", reports, first, second)
+	}
+
+	// approving resolves the reports
+	s.moderate(s.user(), models.ActionApprove, first)
+	if post := s.get(first); post.Reports != 0 {
+		s.Errorf("approved post has %d reports, want 0", post.Reports)
+	}
+	_, ids, _, err = s.store.ReportedPosts(s.c, models.ReportQueue{})
+	if err != nil {
+		s.Fatalf("ReportedPosts: %v", err)
+	}
+	s.ids("ReportedPosts after approval", ids, second)
+	if reports, err := s.store.GetReports(s.c, []int64{first}); err != nil || len(reports[first]) != 0 {
+		s.Errorf("GetReports after approval = %+v, %v, want none", reports, err)
+	}
+}
+
+func testReportThreshold(s *suite) {
+	author, reporters := s.user(), []string{s.user(), s.user(), s.user()}
+	id := s.post(author, 0)
+	other := s.post(author, 0)
+	for i, reporter := range reporters {
+		post := s.report(reporter, id, 3)
+		if post.Reports != i+1 || post.Hidden != (i == 2) {
+			s.Errorf("after %d reports the post has %d reports and is hidden: %t, want %d and %t",
+				i+1, post.Reports, post.Hidden, i+1, i == 2)
+		}
+		// reporting a post twice has no effect
+		if post := s.report(reporter, id, 3); post.Reports != i+1 {
+			s.Errorf("repeated report counted %d reports, want %d", post.Reports, i+1)
+		}
+	}
+	if post := s.get(id); post.Reports != 3 || !post.Hidden {
+		s.Errorf("stored post has %d reports and is hidden: %t, want 3 and true", post.Reports, post.Hidden)
+	}
+	if reports, err := s.store.GetReports(s.c, []int64{id}); err != nil || len(reports[id]) != 3 {
+		s.Errorf("GetReports = %+v, %v, want 3 reports", reports, err)
+	}
+	_, ids, _, err := s.store.TopPosts(s.c, models.Listing{MinRank: -10})
+	if err != nil {
+		s.Fatalf("TopPosts: %v", err)
+	}
+	s.ids("TopPosts with a hidden post", ids, other)
+
+	// approving shows the post again and resets the count
+	s.moderate(s.user(), models.ActionApprove, id)
+	if post := s.get(id); post.Reports != 0 || post.Hidden {
+		s.Errorf("approved post has %d reports and is hidden: %t, want 0 and false", post.Reports, post.Hidden)
+	}
+	if post := s.report(reporters[0], id, 3); post.Reports != 1 || post.Hidden {
+		s.Errorf("report after approval counted %d reports and hid the post: %t, want 1 and false", post.Reports, post.Hidden)
+	}
+
+	// a threshold below 1 never hides posts
+	for _, reporter := range reporters {
+		s.report(reporter, other, 0)
+	}
+	if post := s.get(other); post.Reports != 3 || post.Hidden {
+		s.Errorf("post without threshold has %d reports and is hidden: %t, want 3 and false", post.Reports, post.Hidden)
+	}
+}
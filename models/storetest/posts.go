@@ -0,0 +1,146 @@
+package storetest
+
+import (
+	"strings"
+
+	"github.com/lnsp/zwig/models"
+)
+
+func testPosts(s *suite) {
+	author := s.user()
+	id, err := s.store.SubmitPost(s.c, author, "  hello world  ", "red", "", 0, false)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	post := s.get(id)
+	if post.Author != author || post.Text != "hello world" || post.Color != "red" || post.Parent != 0 || post.Date.IsZero() {
+		s.Errorf("GetPost = %+v, want the submitted post", post)
+	}
+	_, err = s.store.GetPost(s.c, id+100)
+	s.expect("GetPost of a missing post", err, models.ErrNotFound)
+
+	_, err = s.store.SubmitPost(s.c, author, "", "red", "", 0, false)
+	s.expect("SubmitPost without text", err, models.ErrInvalidInput)
+	_, err = s.store.SubmitPost(s.c, author, "text", "purple", "", 0, false)
+	s.expect("SubmitPost with unknown color", err, models.ErrInvalidInput)
+	_, err = s.store.SubmitPost(s.c, author, strings.Repeat("x", models.MaxTextLength+1), "red", "", 0, false)
+	s.expect("SubmitPost with long text", err, models.ErrInvalidInput)
+	_, err = s.store.SubmitPost(s.c, author, "text", "red", "", id+100, false)
+	s.expect("SubmitPost to a missing parent", err, models.ErrNotFound)
+	_, err = s.store.SubmitPost(s.c, author, "text", "red", "none", 0, false)
+	s.expect("SubmitPost to a missing community", err, models.ErrNotFound)
+
+	first := s.post(s.user(), id)
+	second := s.post(s.user(), id)
+	s.post(author, first)
+	_, ids, err := s.store.GetComments(s.c, id)
+	if err != nil {
+		s.Fatalf("GetComments: %v", err)
+	}
+	s.ids("GetComments", ids, first, second)
+	if n, err := s.store.NumberOfComments(s.c, id); err != nil || n != 2 {
+		s.Errorf("NumberOfComments = %d, %v, want 2", n, err)
+	}
+	if post := s.get(id); post.Comments != 2 {
+		s.Errorf("Comments = %d, want 2", post.Comments)
+	}
+	_, err = s.store.NumberOfComments(s.c, id+100)
+	s.expect("NumberOfComments of a missing post", err, models.ErrNotFound)
+}
+
+func testThreads(s *suite) {
+	author := s.user()
+	root := s.post(author, 0)
+	reply := s.post(author, root)
+	nested := s.post(author, reply)
+	deeper := s.post(author, nested)
+	other := s.post(author, 0)
+	s.post(author, other)
+	for _, id := range []int64{reply, nested, deeper} {
+		if post := s.get(id); post.Root != root || post.ThreadRoot(id) != root {
+			s.Errorf("Root of %d = %d, want %d", id, post.Root, root)
+		}
+	}
+	posts, ids, err := s.store.GetThread(s.c, root)
+	if err != nil {
+		s.Fatalf("GetThread: %v", err)
+	}
+	s.ids("GetThread", ids, reply, nested, deeper)
+	thread := models.BuildThread(root, s.get(root), posts, ids, 0)
+	if len(thread.Replies) != 1 || len(thread.Replies[0].Replies) != 1 || thread.Replies[0].Replies[0].ID != nested {
+		s.Errorf("BuildThread did not nest the replies of the thread")
+	}
+}
+
+func testRankings(s *suite) {
+	author, voters := s.user(), []string{s.user(), s.user(), s.user(), s.user()}
+	// votes of 4:0, 2:0 and 1:3, the first two have the same upvote ratio
+	popular := s.post(author, 0)
+	liked := s.post(author, 0)
+	disputed := s.post(author, 0)
+	newest := s.post(author, 0)
+	for i, voter := range voters {
+		s.vote(voter, popular, true, true)
+		if i < 2 {
+			s.vote(voter, liked, true, true)
+		}
+		s.vote(voter, disputed, i == 0, true)
+	}
+	for _, test := range []struct {
+		ranking models.Ranking
+		want    []int64
+	}{
+		{models.Top, []int64{popular, liked, newest, disputed}},
+		{models.Best, []int64{popular, liked, disputed, newest}},
+		// newer posts only win with a comparable score
+		{models.Hot, []int64{popular, liked, newest, disputed}},
+	} {
+		_, ids, next, err := s.store.TopPosts(s.c, models.Listing{Ranking: test.ranking, MinRank: -10})
+		if err != nil {
+			s.Fatalf("TopPosts(%v): %v", test.ranking, err)
+		}
+		s.ids("TopPosts("+test.ranking.String()+")", ids, test.want...)
+		if next != "" {
+			s.Errorf("TopPosts(%v) returned cursor %q for a single page", test.ranking, next)
+		}
+	}
+	_, ids, _, err := s.store.TopPosts(s.c, models.Listing{Ranking: models.Top, MinRank: 0})
+	if err != nil {
+		s.Fatalf("TopPosts: %v", err)
+	}
+	s.ids("TopPosts with minimum rank", ids, popular, liked, newest)
+}
+
+func testPagination(s *suite) {
+	author := s.user()
+	for i := 0; i < 7; i++ {
+		s.post(author, 0)
+	}
+	for _, ranking := range models.Rankings() {
+		listing := models.Listing{Ranking: ranking, Limit: 3, MinRank: -10}
+		var pages []int
+		seen := make(map[int64]bool)
+		for {
+			_, ids, next, err := s.store.TopPosts(s.c, listing)
+			if err != nil {
+				s.Fatalf("TopPosts(%v): %v", ranking, err)
+			}
+			pages = append(pages, len(ids))
+			for _, id := range ids {
+				if seen[id] {
+					s.Errorf("TopPosts(%v) listed post %d twice", ranking, id)
+				}
+				seen[id] = true
+			}
+			if next == "" || len(pages) > 3 {
+				break
+			}
+			listing.Cursor = next
+		}
+		if len(pages) != 3 || pages[0] != 3 || pages[1] != 3 || pages[2] != 1 {
+			s.Errorf("TopPosts(%v) returned pages of %v posts, want [3 3 1]", ranking, pages)
+		}
+	}
+	_, _, _, err := s.store.TopPosts(s.c, models.Listing{Cursor: "not a cursor"})
+	s.expect("TopPosts with invalid cursor", err, models.ErrInvalidInput)
+}
@@ -0,0 +1,143 @@
+// Package storetest verifies that implementations of models.Store behave alike.
+// The stores run the same conformance tests from their own tests.
+package storetest
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// Backend creates the stores under test.
+type Backend struct {
+	// New creates an empty store. It is called once per test.
+	New func(t *testing.T) models.Store
+	// SetKarma overwrites the stored karma of a user behind the store's back to
+	// simulate drifted counters. Tests of ReconcileKarma are skipped if it is nil.
+	SetKarma func(t *testing.T, store models.Store, user string, karma int)
+}
+
+// suite is the state of a single conformance test.
+type suite struct {
+	*testing.T
+	store   models.Store
+	backend Backend
+	c       context.Context
+	// logins counts the users created by user
+	logins int
+}
+
+// Run runs the conformance tests against the stores of the backend.
+func Run(t *testing.T, backend Backend) {
+	tests := []struct {
+		name string
+		test func(s *suite)
+	}{
+		{"Posts", testPosts},
+		{"Threads", testThreads},
+		{"Votes", testVotes},
+		{"ToggleVotes", testToggleVotes},
+		{"CastVotes", testCastVotes},
+		{"ConcurrentVotes", testConcurrentVotes},
+		{"ReconcileKarma", testReconcileKarma},
+		{"Rankings", testRankings},
+		{"Pagination", testPagination},
+		{"Moderation", testModeration},
+		{"Reports", testReports},
+		{"ReportThreshold", testReportThreshold},
+		{"Edit", testEdit},
+		{"Delete", testDelete},
+		{"Communities", testCommunities},
+		{"Tokens", testTokens},
+		{"Accounts", testAccounts},
+		{"Users", testUsers},
+		{"Profile", testProfile},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(&suite{T: t, store: backend.New(t), backend: backend, c: context.Background()})
+		})
+	}
+}
+
+// user creates a new user and returns their ID.
+func (s *suite) user() string {
+	s.Helper()
+	s.logins++
+	user, err := s.store.EnsureUser(s.c, "user"+strconv.Itoa(s.logins)+"@example.com")
+	if err != nil {
+		s.Fatalf("EnsureUser: %v", err)
+	}
+	return user.ID
+}
+
+// post submits a post without community and returns its ID.
+func (s *suite) post(author string, parent int64) int64 {
+	s.Helper()
+	id, err := s.store.SubmitPost(s.c, author, "post by "+author, "blue", "", parent, false)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	return id
+}
+
+// get retrieves a post.
+func (s *suite) get(id int64) models.Post {
+	s.Helper()
+	post, err := s.store.GetPost(s.c, id)
+	if err != nil {
+		s.Fatalf("GetPost(%d): %v", id, err)
+	}
+	return post
+}
+
+// vote submits a vote and fails unless it is kept as wanted.
+func (s *suite) vote(author string, id int64, upvote, keep bool) {
+	s.Helper()
+	kept, err := s.store.SubmitVote(s.c, author, id, upvote)
+	if err != nil {
+		s.Fatalf("SubmitVote: %v", err)
+	} else if kept != keep {
+		s.Fatalf("SubmitVote(%t) kept the vote: %t, want %t", upvote, kept, keep)
+	}
+}
+
+// karma retrieves the karma of a user.
+func (s *suite) karma(user string) int {
+	s.Helper()
+	karma, err := s.store.GetKarma(s.c, user)
+	if err != nil {
+		s.Fatalf("GetKarma: %v", err)
+	}
+	return karma
+}
+
+// expect fails unless err wraps target. A nil target expects any error.
+func (s *suite) expect(op string, err, target error) {
+	s.Helper()
+	if err == nil {
+		s.Errorf("%s succeeded, want error", op)
+	} else if target != nil && !errors.Is(err, target) {
+		s.Errorf("%s = %v, want %v", op, err, target)
+	}
+}
+
+// ids fails unless the IDs are the wanted ones in order.
+func (s *suite) ids(op string, got []int64, want ...int64) {
+	s.Helper()
+	if len(got) != len(want) {
+		s.Errorf("%s = %v, want %v", op, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			s.Errorf("%s = %v, want %v", op, got, want)
+			return
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package storetest
+
+import (
+	"github.com/lnsp/zwig/models"
+)
+
+func testCommunities(s *suite) {
+	owner, member := s.user(), s.user()
+	for _, slug := range []string{"golang", "announcements", "hidden"} {
+		visibility := map[string]string{"announcements": models.VisibilityRestricted, "hidden": models.VisibilityUnlisted}[slug]
+		community, err := models.NewCommunity(slug, "The "+slug, "", owner, visibility)
+		if err != nil {
+			s.Fatalf("NewCommunity: %v", err)
+		}
+		if err := s.store.CreateCommunity(s.c, community); err != nil {
+			s.Fatalf("CreateCommunity: %v", err)
+		}
+	}
+	duplicate, _ := models.NewCommunity("golang", "Another", "", member, "")
+	s.expect("CreateCommunity with a taken slug", s.store.CreateCommunity(s.c, duplicate), nil)
+
+	community, err := s.store.GetCommunity(s.c, "golang")
+	if err != nil || community.Name != "The golang" || !community.IsOwner(owner) || community.IsOwner(member) || community.Visibility != models.VisibilityPublic {
+		s.Errorf("GetCommunity = %+v, %v, want the created community", community, err)
+	}
+	_, err = s.store.GetCommunity(s.c, "none")
+	s.expect("GetCommunity of a missing community", err, models.ErrNotFound)
+	communities, err := s.store.Communities(s.c)
+	if err != nil || len(communities) != 3 || communities[0].Slug != "announcements" || communities[1].Slug != "golang" || communities[2].Slug != "hidden" {
+		s.Errorf("Communities = %+v, %v, want all communities ordered by slug", communities, err)
+	}
+
+	post, err := s.store.SubmitPost(s.c, member, "text", "red", "golang", 0, false)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	s.post(member, 0)
+	if _, err := s.store.SubmitPost(s.c, member, "text", "red", "hidden", 0, false); err != nil {
+		s.Errorf("SubmitPost to an unlisted community: %v", err)
+	}
+	_, err = s.store.SubmitPost(s.c, member, "text", "red", "announcements", 0, false)
+	s.expect("SubmitPost of a member to a restricted community", err, models.ErrForbidden)
+	announcement, err := s.store.SubmitPost(s.c, owner, "text", "red", "announcements", 0, false)
+	if err != nil {
+		s.Fatalf("SubmitPost of the owner to a restricted community: %v", err)
+	}
+	// replies belong to the community of their parent and follow its rules
+	reply, err := s.store.SubmitPost(s.c, member, "text", "red", "", post, false)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	if community := s.get(reply).Community; community != "golang" {
+		s.Errorf("reply belongs to community %q, want golang", community)
+	}
+	_, err = s.store.SubmitPost(s.c, member, "text", "red", "", announcement, false)
+	s.expect("SubmitPost of a member's reply in a restricted community", err, models.ErrForbidden)
+	if _, err := s.store.SubmitPost(s.c, owner, "text", "red", "", announcement, false); err != nil {
+		s.Errorf("SubmitPost of the owner's reply in a restricted community: %v", err)
+	}
+	_, ids, _, err := s.store.TopPosts(s.c, models.Listing{Community: "golang", MinRank: -10})
+	if err != nil {
+		s.Fatalf("TopPosts: %v", err)
+	}
+	s.ids("TopPosts of a community", ids, post)
+}
+
+func testTokens(s *suite) {
+	owner, other := s.user(), s.user()
+	var hashes []string
+	for _, name := range []string{"first", "second"} {
+		token, _, err := models.NewToken(owner, name, []string{models.ScopeRead, models.ScopeVote})
+		if err != nil {
+			s.Fatalf("NewToken: %v", err)
+		}
+		if err := s.store.CreateToken(s.c, token); err != nil {
+			s.Fatalf("CreateToken: %v", err)
+		}
+		hashes = append(hashes, token.Hash)
+	}
+	token, err := s.store.GetToken(s.c, hashes[0])
+	if err != nil || token.Owner != owner || token.Name != "first" || !token.Allows(models.ScopeVote) || token.Allows(models.ScopePost) {
+		s.Errorf("GetToken = %+v, %v, want the first token", token, err)
+	}
+	_, err = s.store.GetToken(s.c, models.HashToken("unknown"))
+	s.expect("GetToken of an unknown secret", err, models.ErrNotFound)
+	tokens, err := s.store.TokensBy(s.c, owner)
+	if err != nil || len(tokens) != 2 || tokens[0].Name != "first" || tokens[1].Name != "second" {
+		s.Errorf("TokensBy = %+v, %v, want both tokens ordered by date", tokens, err)
+	}
+	if tokens, err := s.store.TokensBy(s.c, other); err != nil || len(tokens) != 0 {
+		s.Errorf("TokensBy of another user = %+v, %v, want none", tokens, err)
+	}
+
+	s.expect("RevokeToken by another user", s.store.RevokeToken(s.c, other, hashes[0]), models.ErrNotFound)
+	if err := s.store.RevokeToken(s.c, owner, hashes[0]); err != nil {
+		s.Fatalf("RevokeToken: %v", err)
+	}
+	_, err = s.store.GetToken(s.c, hashes[0])
+	s.expect("GetToken of a revoked token", err, models.ErrNotFound)
+	s.expect("RevokeToken of a revoked token", s.store.RevokeToken(s.c, owner, hashes[0]), models.ErrNotFound)
+}
+
+func testAccounts(s *suite) {
+	account, err := models.NewAccount("alice", "correct horse")
+	if err != nil {
+		s.Fatalf("NewAccount: %v", err)
+	}
+	if err := s.store.CreateAccount(s.c, account); err != nil {
+		s.Fatalf("CreateAccount: %v", err)
+	}
+	s.expect("CreateAccount with a taken name", s.store.CreateAccount(s.c, account), nil)
+	stored, err := s.store.GetAccount(s.c, "alice")
+	if err != nil {
+		s.Fatalf("GetAccount: %v", err)
+	}
+	if !stored.CheckPassword("correct horse") || stored.CheckPassword("wrong horse") {
+		s.Errorf("GetAccount did not preserve the password hash")
+	}
+	_, err = s.store.GetAccount(s.c, "bob")
+	s.expect("GetAccount of a missing account", err, models.ErrNotFound)
+}
+
+func testUsers(s *suite) {
+	user, err := s.store.EnsureUser(s.c, "alice@example.com")
+	if err != nil {
+		s.Fatalf("EnsureUser: %v", err)
+	}
+	if user.ID == "" || user.Handle == "" || user.Login != "alice@example.com" {
+		s.Errorf("EnsureUser = %+v, want a new user", user)
+	}
+	if again, err := s.store.EnsureUser(s.c, "alice@example.com"); err != nil || again.ID != user.ID || again.Handle != user.Handle {
+		s.Errorf("EnsureUser of a known login = %+v, %v, want %+v", again, err, user)
+	}
+	other := s.user()
+	if got, err := s.store.GetUser(s.c, user.ID); err != nil || got.Login != user.Login {
+		s.Errorf("GetUser = %+v, %v, want %+v", got, err, user)
+	}
+	_, err = s.store.GetUser(s.c, "unknown")
+	s.expect("GetUser of an unknown ID", err, models.ErrNotFound)
+
+	if err := s.store.SetHandle(s.c, user.ID, " Alice "); err != nil {
+		s.Fatalf("SetHandle: %v", err)
+	}
+	if got, err := s.store.GetUserByHandle(s.c, "alice"); err != nil || got.ID != user.ID {
+		s.Errorf("GetUserByHandle = %+v, %v, want the renamed user", got, err)
+	}
+	_, err = s.store.GetUserByHandle(s.c, user.Handle)
+	s.expect("GetUserByHandle of the previous handle", err, models.ErrNotFound)
+	s.expect("SetHandle to a taken handle", s.store.SetHandle(s.c, other, "alice"), nil)
+	s.expect("SetHandle to an invalid handle", s.store.SetHandle(s.c, other, "a"), nil)
+	s.expect("SetHandle of an unknown user", s.store.SetHandle(s.c, "unknown", "bob"), models.ErrNotFound)
+	if err := s.store.SetHandle(s.c, user.ID, "alice"); err != nil {
+		s.Errorf("SetHandle to the current handle: %v", err)
+	}
+
+	users, err := s.store.GetUsers(s.c, []string{user.ID, other, "unknown"})
+	if err != nil || len(users) != 2 || users.Handle(user.ID) != "alice" || users.Handle("unknown") != "[deleted]" {
+		s.Errorf("GetUsers = %+v, %v, want both known users", users, err)
+	}
+}
+
+func testProfile(s *suite) {
+	author, voter := s.user(), s.user()
+	var posts []int64
+	for i := 0; i < 3; i++ {
+		posts = append(posts, s.post(author, 0))
+	}
+	comment := s.post(author, posts[0])
+	anonymous, err := s.store.SubmitPost(s.c, author, "secret", "red", "", 0, true)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	s.vote(voter, posts[1], true, true)
+	s.vote(voter, comment, false, true)
+	s.vote(author, posts[2], true, true)
+	// votes on anonymous posts count towards the karma but not the statistics
+	anonymousComment, err := s.store.SubmitPost(s.c, author, "secret", "red", "", posts[1], true)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	s.vote(voter, anonymous, true, true)
+	s.vote(voter, anonymousComment, true, true)
+	if karma := s.karma(author); karma != 3 {
+		s.Errorf("karma = %d, want 3", karma)
+	}
+
+	page, ids, next, err := s.store.PostsBy(s.c, author, models.History{Limit: 2})
+	if err != nil {
+		s.Fatalf("PostsBy: %v", err)
+	}
+	s.ids("PostsBy", ids, posts[2], posts[1])
+	if len(page) != 2 || page[0].Author != author {
+		s.Errorf("PostsBy returned %d posts, want 2", len(page))
+	}
+	_, ids, next, err = s.store.PostsBy(s.c, author, models.History{Limit: 2, Cursor: next})
+	if err != nil {
+		s.Fatalf("PostsBy: %v", err)
+	}
+	s.ids("second page of PostsBy", ids, posts[0])
+	if next != "" {
+		s.Errorf("PostsBy returned cursor %q on the last page", next)
+	}
+	_, ids, _, err = s.store.PostsBy(s.c, author, models.History{Comments: true})
+	if err != nil {
+		s.Fatalf("PostsBy: %v", err)
+	}
+	s.ids("PostsBy of comments", ids, comment)
+	_, ids, _, err = s.store.PostsBy(s.c, author, models.History{Anonymous: true, Limit: 1})
+	if err != nil {
+		s.Fatalf("PostsBy: %v", err)
+	}
+	s.ids("PostsBy including anonymous posts", ids, anonymous)
+
+	stats, err := s.store.GetStats(s.c, author)
+	if err != nil {
+		s.Fatalf("GetStats: %v", err)
+	}
+	if want := (models.UserStats{PostKarma: 2, CommentKarma: -1, Posts: 3, Comments: 1, Upvotes: 1}); stats != want {
+		s.Errorf("GetStats = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,232 @@
+package storetest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lnsp/zwig/models"
+)
+
+func testVotes(s *suite) {
+	author, up, down := s.user(), s.user(), s.user()
+	id := s.post(author, 0)
+	other := s.post(author, 0)
+	s.vote(up, id, true, true)
+	s.vote(author, id, true, true)
+	s.vote(down, id, false, true)
+	s.vote(up, other, false, true)
+	if post := s.get(id); post.Upvotes != 2 || post.Downvotes != 1 || post.Rank != 1 {
+		s.Errorf("post has %d upvotes, %d downvotes and rank %v, want 2, 1 and 1", post.Upvotes, post.Downvotes, post.Rank)
+	}
+	if n, err := s.store.NumberOfVotes(s.c, id); err != nil || n != 1 {
+		s.Errorf("NumberOfVotes = %d, %v, want 1", n, err)
+	}
+	_, err := s.store.NumberOfVotes(s.c, id+100)
+	s.expect("NumberOfVotes of a missing post", err, models.ErrNotFound)
+	if karma := s.karma(author); karma != 0 {
+		s.Errorf("karma = %d, want 0", karma)
+	}
+	if karma := s.karma(up); karma != 0 {
+		s.Errorf("karma of a voter = %d, want 0", karma)
+	}
+
+	if vote, err := s.store.GetVoteBy(s.c, id, down); err != nil || vote.Upvote || vote.Post != id || vote.Author != down {
+		s.Errorf("GetVoteBy = %+v, %v, want the downvote", vote, err)
+	}
+	if voted, err := s.store.HasVotedOn(s.c, other, down); err != nil || voted {
+		s.Errorf("HasVotedOn = %t, %v, want false", voted, err)
+	}
+	if voted, err := s.store.HasVotedOn(s.c, other, up); err != nil || !voted {
+		s.Errorf("HasVotedOn = %t, %v, want true", voted, err)
+	}
+	votes, err := s.store.GetVotesBy(s.c, []int64{id, other, other + 100}, up)
+	if err != nil {
+		s.Fatalf("GetVotesBy: %v", err)
+	}
+	if len(votes) != 2 || !votes[id].Upvote || votes[other].Upvote {
+		s.Errorf("GetVotesBy = %+v, want an upvote on %d and a downvote on %d", votes, id, other)
+	}
+
+	_, err = s.store.SubmitVote(s.c, up, other+100, true)
+	s.expect("SubmitVote on a missing post", err, models.ErrNotFound)
+	_, err = s.store.SubmitVote(s.c, "", id, true)
+	s.expect("SubmitVote without author", err, nil)
+
+	if err := s.store.UpdateRank(s.c, id); err != nil {
+		s.Fatalf("UpdateRank: %v", err)
+	}
+	if post := s.get(id); post.Upvotes != 2 || post.Downvotes != 1 {
+		s.Errorf("UpdateRank changed the counters to %d and %d, want 2 and 1", post.Upvotes, post.Downvotes)
+	}
+	if karma := s.karma(author); karma != 0 {
+		s.Errorf("karma after UpdateRank = %d, want 0", karma)
+	}
+}
+
+func testToggleVotes(s *suite) {
+	author, voter := s.user(), s.user()
+	id := s.post(author, 0)
+	for _, step := range []struct {
+		name               string
+		upvote, keep       bool
+		upvotes, downvotes int
+	}{
+		{"upvote", true, true, 1, 0},
+		{"flip to downvote", false, true, 0, 1},
+		{"retract downvote", false, false, 0, 0},
+		{"downvote", false, true, 0, 1},
+		{"flip to upvote", true, true, 1, 0},
+		{"retract upvote", true, false, 0, 0},
+	} {
+		s.vote(voter, id, step.upvote, step.keep)
+		post := s.get(id)
+		if post.Upvotes != step.upvotes || post.Downvotes != step.downvotes {
+			s.Errorf("after %s post has %d upvotes and %d downvotes, want %d and %d",
+				step.name, post.Upvotes, post.Downvotes, step.upvotes, step.downvotes)
+		}
+		if karma := s.karma(author); karma != post.Score() {
+			s.Errorf("after %s karma = %d, want %d", step.name, karma, post.Score())
+		}
+		if voted, err := s.store.HasVotedOn(s.c, id, voter); err != nil || voted != step.keep {
+			s.Errorf("after %s HasVotedOn = %t, %v, want %t", step.name, voted, err, step.keep)
+		}
+		if vote, err := s.store.GetVoteBy(s.c, id, voter); step.keep && (err != nil || vote.Upvote != step.upvote) {
+			s.Errorf("after %s GetVoteBy = %+v, %v, want upvote %t", step.name, vote, err, step.upvote)
+		} else if !step.keep && err == nil {
+			s.Errorf("after %s GetVoteBy = %+v, want error", step.name, vote)
+		}
+	}
+}
+
+func testCastVotes(s *suite) {
+	author, voter := s.user(), s.user()
+	id := s.post(author, 0)
+	if flipped, err := s.store.CastVote(s.c, voter, id, true); err != nil || flipped {
+		s.Errorf("CastVote = %t, %v, want a new vote", flipped, err)
+	}
+	_, err := s.store.CastVote(s.c, voter, id, true)
+	s.expect("CastVote repeating the vote", err, models.ErrAlreadyVoted)
+	if post := s.get(id); post.Upvotes != 1 || post.Downvotes != 0 {
+		s.Errorf("repeated vote changed the counters to %d and %d, want 1 and 0", post.Upvotes, post.Downvotes)
+	}
+	if flipped, err := s.store.CastVote(s.c, voter, id, false); err != nil || !flipped {
+		s.Errorf("CastVote of the opposite vote = %t, %v, want a flipped vote", flipped, err)
+	}
+	_, err = s.store.CastVote(s.c, voter, id, false)
+	s.expect("CastVote repeating the flipped vote", err, models.ErrAlreadyVoted)
+	if post := s.get(id); post.Upvotes != 0 || post.Downvotes != 1 {
+		s.Errorf("flipped vote changed the counters to %d and %d, want 0 and 1", post.Upvotes, post.Downvotes)
+	}
+	if karma := s.karma(author); karma != -1 {
+		s.Errorf("karma = %d, want -1", karma)
+	}
+	_, err = s.store.CastVote(s.c, voter, id+100, true)
+	s.expect("CastVote on a missing post", err, models.ErrNotFound)
+}
+
+// testConcurrentVotes submits votes of many users on a single post at once and verifies
+// that no update of the counters or the karma of the author is lost.
+func testConcurrentVotes(s *suite) {
+	author := s.user()
+	id := s.post(author, 0)
+	voters := make([]string, 20)
+	for i := range voters {
+		voters[i] = s.user()
+	}
+	errs := make(chan error, 3*len(voters))
+	var wg sync.WaitGroup
+	for i, voter := range voters {
+		wg.Add(1)
+		go func(i int, voter string) {
+			defer wg.Done()
+			// every third voter changes their mind and downvotes instead
+			votes := []bool{true}
+			if i%3 == 0 {
+				votes = append(votes, false)
+			}
+			for _, upvote := range votes {
+				if _, err := s.store.SubmitVote(s.c, voter, id, upvote); err != nil {
+					errs <- err
+				}
+			}
+		}(i, voter)
+	}
+	// the same vote cast twice at once is only counted once
+	twice := s.post(author, 0)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.store.CastVote(s.c, voters[0], twice, true)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var repeated int
+	for err := range errs {
+		if errors.Is(err, models.ErrAlreadyVoted) {
+			repeated++
+		} else if err != nil {
+			s.Errorf("concurrent vote: %v", err)
+		}
+	}
+	if repeated != 1 {
+		s.Errorf("%d concurrent CastVote calls failed with ErrAlreadyVoted, want 1", repeated)
+	}
+
+	if post := s.get(id); post.Upvotes != 13 || post.Downvotes != 7 {
+		s.Errorf("post has %d upvotes and %d downvotes, want 13 and 7", post.Upvotes, post.Downvotes)
+	}
+	if post := s.get(twice); post.Upvotes != 1 {
+		s.Errorf("post voted twice at once has %d upvotes, want 1", post.Upvotes)
+	}
+	if karma := s.karma(author); karma != 7 {
+		s.Errorf("karma = %d, want 7", karma)
+	}
+	if n, err := s.store.ReconcileKarma(s.c); err != nil || n != 0 {
+		s.Errorf("ReconcileKarma corrected %d users, %v, want none", n, err)
+	}
+}
+
+// testReconcileKarma drifts the stored karma of users and verifies that
+// ReconcileKarma recomputes it from the votes.
+func testReconcileKarma(s *suite) {
+	if s.backend.SetKarma == nil {
+		s.Skip("the backend cannot change karma directly")
+	}
+	author, other, voter := s.user(), s.user(), s.user()
+	id := s.post(author, 0)
+	downvoted := s.post(other, 0)
+	s.vote(voter, id, true, true)
+	s.vote(author, id, true, true)
+	s.vote(voter, downvoted, false, true)
+	// an anonymous post still earns its author karma
+	anonymous, err := s.store.SubmitPost(s.c, author, "anonymous", "blue", "", 0, true)
+	if err != nil {
+		s.Fatalf("SubmitPost: %v", err)
+	}
+	s.vote(other, anonymous, true, true)
+
+	s.backend.SetKarma(s.T, s.store, author, 10)
+	s.backend.SetKarma(s.T, s.store, other, 0)
+	s.backend.SetKarma(s.T, s.store, voter, -5)
+	if n, err := s.store.ReconcileKarma(s.c); err != nil || n != 3 {
+		s.Errorf("ReconcileKarma corrected %d users, %v, want 3", n, err)
+	}
+	for _, test := range []struct {
+		user  string
+		karma int
+	}{
+		{author, 3},
+		{other, -1},
+		{voter, 0},
+	} {
+		if karma := s.karma(test.user); karma != test.karma {
+			s.Errorf("reconciled karma = %d, want %d", karma, test.karma)
+		}
+	}
+	if n, err := s.store.ReconcileKarma(s.c); err != nil || n != 0 {
+		s.Errorf("ReconcileKarma of reconciled karma corrected %d users, %v, want none", n, err)
+	}
+}
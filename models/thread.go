@@ -0,0 +1,56 @@
+package models
+
+// collection of thread depth limits
+const (
+	DefaultThreadDepth = 8
+	MaxThreadDepth     = 32
+)
+
+// Thread is a post together with its nested replies.
+type Thread struct {
+	ID      int64
+	Post    Post
+	Depth   int
+	Replies []*Thread
+	// More reports if replies have been omitted because of the depth limit.
+	More bool
+}
+
+// ThreadRoot returns the ID of the top-level post of the thread the post with the given ID belongs to.
+// Replies stored before threads were introduced lack their root until the store resolved it,
+// for them the parent is returned, which is the root only for direct replies to top-level posts.
+func (post Post) ThreadRoot(id int64) int64 {
+	if post.Root != 0 {
+		return post.Root
+	}
+	if post.Parent != 0 {
+		return post.Parent
+	}
+	return id
+}
+
+// BuildThread arranges the posts of a thread into a tree below the post with the given ID.
+// Posts are expected in the order their replies should be shown. Replies nested deeper
+// than maxDepth are omitted, the depth is bounded by MaxThreadDepth.
+func BuildThread(id int64, post Post, posts []Post, ids []int64, maxDepth int) *Thread {
+	if maxDepth <= 0 || maxDepth > MaxThreadDepth {
+		maxDepth = MaxThreadDepth
+	}
+	children := make(map[int64][]int, len(posts))
+	for i, p := range posts {
+		children[p.Parent] = append(children[p.Parent], i)
+	}
+	var build func(id int64, post Post, depth int) *Thread
+	build = func(id int64, post Post, depth int) *Thread {
+		thread := &Thread{ID: id, Post: post, Depth: depth}
+		if depth >= maxDepth {
+			thread.More = len(children[id]) > 0
+			return thread
+		}
+		for _, i := range children[id] {
+			thread.Replies = append(thread.Replies, build(ids[i], posts[i], depth+1))
+		}
+		return thread
+	}
+	return build(id, post, 0)
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestThreadRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		post Post
+		id   int64
+		want int64
+	}{
+		{"top-level post", Post{}, 9, 9},
+		{"reply", Post{Parent: 3, Root: 1}, 9, 1},
+		{"unresolved legacy reply", Post{Parent: 3}, 9, 3},
+	}
+	for _, test := range tests {
+		if got := test.post.ThreadRoot(test.id); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// format writes a thread as ID(replies...), marking omitted replies with +.
+func format(thread *Thread) string {
+	s := strconv.FormatInt(thread.ID, 10)
+	if thread.More {
+		s += "+"
+	}
+	if len(thread.Replies) > 0 {
+		replies := make([]string, len(thread.Replies))
+		for i, reply := range thread.Replies {
+			replies[i] = format(reply)
+		}
+		s += "(" + strings.Join(replies, ",") + ")"
+	}
+	return s
+}
+
+func TestBuildThread(t *testing.T) {
+	// parents of the posts of the thread below post 1
+	parents := map[int64]int64{2: 1, 3: 2, 4: 1, 5: 3}
+	tests := []struct {
+		name  string
+		order []int64
+		depth int
+		want  string
+	}{
+		{"unbounded", []int64{2, 3, 4, 5}, 0, "1(2(3(5)),4)"},
+		{"above maximum", []int64{2, 3, 4, 5}, MaxThreadDepth + 1, "1(2(3(5)),4)"},
+		{"depth 1", []int64{2, 3, 4, 5}, 1, "1(2+,4)"},
+		{"depth 2", []int64{2, 3, 4, 5}, 2, "1(2(3+),4)"},
+		{"exact depth", []int64{2, 3, 4, 5}, 3, "1(2(3(5)),4)"},
+		{"order kept", []int64{4, 2, 5, 3}, 0, "1(4,2(3(5)))"},
+		{"no replies", nil, 0, "1"},
+	}
+	for _, test := range tests {
+		posts := make([]Post, len(test.order))
+		for i, id := range test.order {
+			posts[i] = Post{Parent: parents[id], Root: 1}
+		}
+		thread := BuildThread(1, Post{}, posts, test.order, test.depth)
+		if got := format(thread); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildThreadDepth(t *testing.T) {
+	// a chain of replies deeper than MaxThreadDepth
+	var posts []Post
+	var ids []int64
+	for id := int64(2); id <= MaxThreadDepth+2; id++ {
+		posts = append(posts, Post{Parent: id - 1, Root: 1})
+		ids = append(ids, id)
+	}
+	thread := BuildThread(1, Post{}, posts, ids, 0)
+	depth := 0
+	for ; len(thread.Replies) > 0; depth++ {
+		if thread.Replies[0].Depth != depth+1 {
+			t.Fatalf("got depth %d, want %d", thread.Replies[0].Depth, depth+1)
+		}
+		thread = thread.Replies[0]
+	}
+	if depth != MaxThreadDepth || !thread.More {
+		t.Errorf("got depth %d with more %v, want %d with more replies", depth, thread.More, MaxThreadDepth)
+	}
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// collection of API token scopes
+const (
+	// ScopeRead allows reading private account information like karma.
+	ScopeRead = "read"
+	// ScopePost allows submitting posts and comments.
+	ScopePost = "post"
+	// ScopeVote allows voting on posts.
+	ScopeVote = "vote"
+	// ScopeModerate allows moderating posts and reading the moderation log.
+	ScopeModerate = "moderate"
+)
+
+// tokenPrefix marks API token secrets to make them recognizable.
+const tokenPrefix = "zwig_"
+
+// Scopes lists all available API token scopes.
+func Scopes() []string {
+	return []string{ScopeRead, ScopePost, ScopeVote, ScopeModerate}
+}
+
+// Token is a personal API token. Only the hash of the secret is stored.
+type Token struct {
+	Hash    string
+	Owner   string
+	Name    string
+	Scopes  []string
+	Created time.Time
+}
+
+// NewToken generates a new API token and returns it together with its secret.
+func NewToken(owner, name string, scopes []string) (Token, string, error) {
+	owner = strings.TrimSpace(owner)
+	name = strings.TrimSpace(name)
+	if len(owner) < 1 || len(name) < 1 {
+		return Token{}, "", fmt.Errorf("NewToken: token needs owner and name")
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return Token{}, "", fmt.Errorf("NewToken: unknown scope %q", scope)
+		}
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return Token{}, "", fmt.Errorf("NewToken: could not generate secret: %v", err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return Token{
+		Hash:    HashToken(secret),
+		Owner:   owner,
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now(),
+	}, secret, nil
+}
+
+// HashToken derives the stored hash of a token secret.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Allows reports if the token has been granted the scope.
+func (token Token) Allows(scope string) bool {
+	for _, s := range token.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
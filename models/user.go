@@ -0,0 +1,128 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// handlePattern restricts the handles of users.
+var handlePattern = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+
+// word lists used to generate handles
+var (
+	handleAdjectives = []string{"blue", "red", "orange", "green", "quiet", "brave", "sunny", "lucky", "swift", "curious"}
+	handleNouns      = []string{"otter", "falcon", "badger", "heron", "lynx", "panda", "raven", "walrus", "gecko", "moose"}
+)
+
+// User is a pseudonymous user profile. Posts, votes and API tokens are keyed by
+// the user's opaque ID, only the handle is ever shown to other users.
+type User struct {
+	ID     string
+	Handle string
+	// Login is the identity provided by the authenticator, like an email address.
+	// It is private to the user.
+	Login   string
+	Created time.Time
+	// Karma is the sum of the scores of the user's posts.
+	Karma int
+}
+
+// NewUser initializes a new user for the login with an opaque ID and a generated handle.
+func NewUser(login string) (User, error) {
+	login = strings.TrimSpace(login)
+	if len(login) < 1 {
+		return User{}, fmt.Errorf("NewUser: user needs a login")
+	}
+	id, err := NewUserID()
+	if err != nil {
+		return User{}, err
+	}
+	handle, err := GenerateHandle()
+	if err != nil {
+		return User{}, err
+	}
+	return User{
+		ID:      id,
+		Handle:  handle,
+		Login:   login,
+		Created: time.Now(),
+	}, nil
+}
+
+// NewUserID generates a random opaque user ID.
+func NewUserID() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("NewUserID: could not generate ID: %v", err)
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(raw)), nil
+}
+
+// GenerateHandle generates a random handle like "swift-otter-4821".
+// Handles are not guaranteed to be unique, callers have to retry on collisions.
+func GenerateHandle() (string, error) {
+	var picks [3]int64
+	for i, n := range []int{len(handleAdjectives), len(handleNouns), 10000} {
+		v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+		if err != nil {
+			return "", fmt.Errorf("GenerateHandle: could not generate handle: %v", err)
+		}
+		picks[i] = v.Int64()
+	}
+	return fmt.Sprintf("%s-%s-%d", handleAdjectives[picks[0]], handleNouns[picks[1]], picks[2]), nil
+}
+
+// NormalizeHandle verifies a chosen handle and returns its canonical lowercase form.
+func NormalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimSpace(handle))
+	if !handlePattern.MatchString(handle) {
+		return "", fmt.Errorf("NormalizeHandle: handle must have 3 to 32 lowercase letters, digits, dashes or underscores")
+	}
+	return handle, nil
+}
+
+// maxHandleAttempts bounds the number of generated handles tried when creating a user.
+const maxHandleAttempts = 10
+
+// RegenerateHandle replaces the generated handle of the user after a collision.
+// It fails once too many handles have been tried.
+func (user *User) RegenerateHandle(attempt int) error {
+	if attempt >= maxHandleAttempts {
+		return fmt.Errorf("RegenerateHandle: could not find a free handle")
+	}
+	handle, err := GenerateHandle()
+	if err != nil {
+		return err
+	}
+	user.Handle = handle
+	return nil
+}
+
+// Authors collects the distinct authors of the posts.
+func Authors(posts []Post) []string {
+	seen := make(map[string]bool, len(posts))
+	authors := make([]string, 0, len(posts))
+	for _, post := range posts {
+		if !seen[post.Author] {
+			seen[post.Author] = true
+			authors = append(authors, post.Author)
+		}
+	}
+	return authors
+}
+
+// Users maps user IDs to users.
+type Users map[string]User
+
+// Handle returns the handle of the user with the given ID. Unknown users are shown as "[deleted]".
+func (users Users) Handle(id string) string {
+	if user, ok := users[id]; ok {
+		return user.Handle
+	}
+	return "[deleted]"
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxTextLength bounds the number of characters in the text of a post.
+const MaxTextLength = 1000
+
+// Colors are the colors posts can be displayed in.
+var Colors = []string{"blue", "red", "orange", "green"}
+
+// FieldError describes the problem with a single field of the input.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the invalid fields of the input. It matches ErrInvalidInput.
+type ValidationError []FieldError
+
+func (err ValidationError) Error() string {
+	problems := make([]string, len(err))
+	for i, field := range err {
+		problems[i] = field.Field + ": " + field.Message
+	}
+	return ErrInvalidInput.Error() + ": " + strings.Join(problems, "; ")
+}
+
+// Is reports if the target is ErrInvalidInput.
+func (err ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// invalidField returns a ValidationError for a single field with a formatted message.
+func invalidField(field, format string, args ...interface{}) error {
+	return ValidationError{{Field: field, Message: fmt.Sprintf(format, args...)}}
+}
+
+// ValidatePost verifies the text and color of a new post and returns the normalized text.
+// It fails with a ValidationError listing every invalid field.
+func ValidatePost(text, color string) (string, error) {
+	var invalid ValidationError
+	text, problem := checkText(text)
+	if problem != "" {
+		invalid = append(invalid, FieldError{Field: "text", Message: problem})
+	}
+	if !ValidColor(color) {
+		invalid = append(invalid, FieldError{
+			Field:   "color",
+			Message: fmt.Sprintf("color must be one of %s", strings.Join(Colors, ", ")),
+		})
+	}
+	if len(invalid) > 0 {
+		return "", invalid
+	}
+	return text, nil
+}
+
+// ValidateText verifies the text of a post and returns it normalized.
+// It fails with a ValidationError if the text is invalid.
+func ValidateText(text string) (string, error) {
+	text, problem := checkText(text)
+	if problem != "" {
+		return "", invalidField("text", "%s", problem)
+	}
+	return text, nil
+}
+
+// ValidColor reports if posts can be displayed in the color.
+func ValidColor(color string) bool {
+	for _, c := range Colors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
+
+// checkText normalizes the text to NFC without surrounding whitespace and unifies line
+// endings. It returns the problem with the text if it is empty, too long or contains
+// control characters other than newlines and tabs.
+func checkText(text string) (string, string) {
+	if !utf8.ValidString(text) {
+		return "", "text must be valid UTF-8"
+	}
+	text = strings.TrimSpace(norm.NFC.String(strings.Replace(text, "\r\n", "\n", -1)))
+	if len(text) < 1 {
+		return "", "text must not be empty"
+	}
+	if utf8.RuneCountInString(text) > MaxTextLength {
+		return "", fmt.Sprintf("text must not exceed %d characters", MaxTextLength)
+	}
+	if strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t'
+	}) >= 0 {
+		return "", "text must not contain control characters"
+	}
+	return text, ""
+}
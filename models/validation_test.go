@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		problem string
+	}{
+		{"plain", "hello", "hello", ""},
+		{"trimmed", " \t\n hello \r\n", "hello", ""},
+		{"inner whitespace", "hello\tworld\n\nagain", "hello\tworld\n\nagain", ""},
+		{"line endings", "one\r\ntwo", "one\ntwo", ""},
+		{"composed", "café", "café", ""},
+		{"decomposed", "cafe\u0301", "café", ""},
+		{"decomposed hangul", "\u1100\u1161", "가", ""},
+		{"empty", "", "", "text must not be empty"},
+		{"whitespace only", " \r\n\t ", "", "text must not be empty"},
+		{"longest", strings.Repeat("a", MaxTextLength), strings.Repeat("a", MaxTextLength), ""},
+		{"longest multibyte", strings.Repeat("é", MaxTextLength), strings.Repeat("é", MaxTextLength), ""},
+		{"longest after normalization", strings.Repeat("e\u0301", MaxTextLength), strings.Repeat("é", MaxTextLength), ""},
+		{"longest after trimming", "  " + strings.Repeat("a", MaxTextLength) + "\n", strings.Repeat("a", MaxTextLength), ""},
+		{"too long", strings.Repeat("a", MaxTextLength+1), "", "text must not exceed 1000 characters"},
+		{"too long multibyte", strings.Repeat("é", MaxTextLength+1), "", "text must not exceed 1000 characters"},
+		{"null", "hello\x00world", "", "text must not contain control characters"},
+		{"bell", "hello\aworld", "", "text must not contain control characters"},
+		{"escape", "\x1b[31mred", "", "text must not contain control characters"},
+		{"carriage return", "one\rtwo", "", "text must not contain control characters"},
+		{"delete", "hello\x7f", "", "text must not contain control characters"},
+		{"C1 control", "hello\u0085world", "", "text must not contain control characters"},
+		{"invalid UTF-8", "hello\xff", "", "text must be valid UTF-8"},
+	}
+	for _, test := range tests {
+		got, problem := checkText(test.text)
+		if got != test.want || problem != test.problem {
+			t.Errorf("checkText of %s = %q, %q, want %q, %q", test.name, got, problem, test.want, test.problem)
+		}
+	}
+}
+
+func TestValidColor(t *testing.T) {
+	for _, color := range Colors {
+		if !ValidColor(color) {
+			t.Errorf("ValidColor(%q) = false, want true", color)
+		}
+	}
+	for _, color := range []string{"", "purple", "Blue", " red", "#ff0000", "red;"} {
+		if ValidColor(color) {
+			t.Errorf("ValidColor(%q) = true, want false", color)
+		}
+	}
+}
+
+func TestValidatePost(t *testing.T) {
+	tests := []struct {
+		text, color string
+		want        string
+		fields      []string
+	}{
+		{" hello ", "red", "hello", nil},
+		{"cafe\u0301", "blue", "café", nil},
+		{"hello", "purple", "", []string{"color"}},
+		{"", "red", "", []string{"text"}},
+		{"\x00", "", "", []string{"text", "color"}},
+	}
+	for _, test := range tests {
+		got, err := ValidatePost(test.text, test.color)
+		if got != test.want {
+			t.Errorf("ValidatePost(%q, %q) = %q, want %q", test.text, test.color, got, test.want)
+		}
+		if test.fields == nil {
+			if err != nil {
+				t.Errorf("ValidatePost(%q, %q) = %v, want no error", test.text, test.color, err)
+			}
+			continue
+		}
+		var invalid ValidationError
+		if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidInput) || len(invalid) != len(test.fields) {
+			t.Errorf("ValidatePost(%q, %q) = %v, want invalid fields %v", test.text, test.color, err, test.fields)
+			continue
+		}
+		for i, field := range invalid {
+			if field.Field != test.fields[i] || field.Message == "" {
+				t.Errorf("ValidatePost(%q, %q) = %v, want invalid fields %v", test.text, test.color, err, test.fields)
+			}
+		}
+	}
+}
+
+func TestValidateText(t *testing.T) {
+	if got, err := ValidateText(" café\r\n"); err != nil || got != "café" {
+		t.Errorf("ValidateText = %q, %v, want %q", got, err, "café")
+	}
+	_, err := ValidateText(strings.Repeat("a", MaxTextLength+1))
+	var invalid ValidationError
+	if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidInput) || len(invalid) != 1 || invalid[0].Field != "text" {
+		t.Errorf("ValidateText of a long text = %v, want an invalid text", err)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, ErrInvalidInput.Error()+": text: ") {
+		t.Errorf("error message %q, want the field and problem", msg)
+	}
+}
@@ -0,0 +1,309 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models/memory"
+)
+
+// sessionRequest returns a request carrying the session cookie.
+func sessionRequest(value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: value})
+	return r
+}
+
+// sessionCookie returns the session cookie set by the response.
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	s := newSessions([]byte("secret"))
+	w := httptest.NewRecorder()
+	s.set(w, httptest.NewRequest(http.MethodGet, "/", nil), "alice@example.com")
+	cookie := sessionCookie(w)
+	if cookie == nil || !cookie.HttpOnly || cookie.MaxAge != authCookieDuration {
+		t.Fatalf("session cookie = %+v, want an HTTP only cookie lasting %d seconds", cookie, authCookieDuration)
+	}
+	if user := s.get(sessionRequest(cookie.Value)); user != "alice@example.com" {
+		t.Errorf("get = %q, want %q", user, "alice@example.com")
+	}
+
+	// payload signs a session of the user expiring at the given time
+	payload := func(user string, expires time.Time) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(user)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	}
+	valid := payload("alice@example.com", time.Now().Add(time.Hour))
+	forged := payload("mallory@example.com", time.Now().Add(time.Hour))
+	expired := payload("alice@example.com", time.Now().Add(-time.Minute))
+	sig := s.sign(valid)
+	for _, test := range []struct {
+		name  string
+		value string
+	}{
+		{"empty cookie", ""},
+		{"missing signature", valid},
+		{"empty signature", valid + "."},
+		{"tampered user", forged + "." + sig},
+		{"tampered expiry", payload("alice@example.com", time.Now().Add(48*time.Hour)) + "." + sig},
+		{"tampered signature", valid + "." + strings.ToUpper(sig)},
+		{"signature of another key", valid + "." + newSessions([]byte("other")).sign(valid)},
+		{"expired session", expired + "." + s.sign(expired)},
+		{"missing expiry", "YWxpY2U." + s.sign("YWxpY2U")},
+		{"malformed expiry", "YWxpY2U.soon." + s.sign("YWxpY2U.soon")},
+		{"malformed user", "!!!.9999999999." + s.sign("!!!.9999999999")},
+	} {
+		if user := s.get(sessionRequest(test.value)); user != "" {
+			t.Errorf("get with %s = %q, want no user", test.name, user)
+		}
+	}
+	if user := s.get(httptest.NewRequest(http.MethodGet, "/", nil)); user != "" {
+		t.Errorf("get without cookie = %q, want no user", user)
+	}
+
+	// random keys differ
+	if a, b := newSessions(nil), newSessions(nil); a.sign(valid) == b.sign(valid) {
+		t.Error("random session keys are equal")
+	}
+	w = httptest.NewRecorder()
+	s.clear(w)
+	if cookie := sessionCookie(w); cookie == nil || cookie.MaxAge >= 0 || cookie.Value != "" {
+		t.Errorf("clear set %+v, want an expired cookie", cookie)
+	}
+}
+
+func TestLocalDest(t *testing.T) {
+	for _, test := range []struct {
+		dest string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/post/1?ranking=top", "/post/1?ranking=top"},
+		{"post/1", "/"},
+		{"//evil.example.com/", "/"},
+		{"/\\evil.example.com/", "/"},
+		{"https://evil.example.com/", "/"},
+		{"javascript:alert(1)", "/"},
+	} {
+		if got := localDest(test.dest); got != test.want {
+			t.Errorf("localDest(%q) = %q, want %q", test.dest, got, test.want)
+		}
+	}
+}
+
+func TestLocalAuth(t *testing.T) {
+	store := memory.New()
+	auth := NewLocalAuth(store, LocalConfig{TemplateDir: "../appengine/static/templates", SessionKey: []byte("secret")})
+	do := func(path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, r)
+		return w
+	}
+
+	form := url.Values{"name": {"alice"}, "password": {"correct horse"}, "confirm": {"battery staple"}, "dest": {"/post/1"}}
+	if w := do("/auth/local/register", form); sessionCookie(w) != nil || !strings.Contains(w.Body.String(), "Passwords do not match.") {
+		t.Errorf("register with a wrong confirmation = %d %s, want an error", w.Code, w.Body)
+	}
+	form.Set("confirm", "correct horse")
+	w := do("/auth/local/register", form)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/post/1" || sessionCookie(w) == nil {
+		t.Fatalf("register = %d %s, want a session and a redirect to /post/1", w.Code, w.Body)
+	}
+	if w := do("/auth/local/register", form); sessionCookie(w) != nil {
+		t.Errorf("register of a taken name = %d %s, want no session", w.Code, w.Body)
+	}
+	if _, err := store.GetAccount(context.Background(), "alice"); err != nil {
+		t.Fatalf("GetAccount of the registered account: %v", err)
+	}
+
+	for _, test := range []struct {
+		name, password string
+	}{
+		{"alice", "wrong"},
+		{"alice", ""},
+		{"alice", "correct horse "},
+		{"bob", "correct horse"},
+	} {
+		w := do("/auth/local/login", url.Values{"name": {test.name}, "password": {test.password}})
+		if w.Code != http.StatusOK || sessionCookie(w) != nil || !strings.Contains(w.Body.String(), "Unknown name or wrong password.") {
+			t.Errorf("login of %s with %q = %d, want an error and no session", test.name, test.password, w.Code)
+		}
+	}
+	w = do("/auth/local/login", url.Values{"name": {"alice"}, "password": {"correct horse"}, "dest": {"//evil.example.com"}})
+	cookie := sessionCookie(w)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" || cookie == nil {
+		t.Fatalf("login = %d %s, want a session and a redirect to /", w.Code, w.Body)
+	}
+	if user := auth.Current(sessionRequest(cookie.Value)); user != "alice" {
+		t.Errorf("Current = %q, want %q", user, "alice")
+	}
+	// sessions of another key are rejected
+	other := NewLocalAuth(store, LocalConfig{TemplateDir: "../appengine/static/templates", SessionKey: []byte("other")})
+	if user := other.Current(sessionRequest(cookie.Value)); user != "" {
+		t.Errorf("Current with another key = %q, want no user", user)
+	}
+	if w := do("/auth/local/signout", nil); w.Code != http.StatusFound || sessionCookie(w) == nil || sessionCookie(w).MaxAge >= 0 {
+		t.Errorf("signout = %d, want an expired session cookie", w.Code)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		auth       ProxyAuth
+		remoteAddr string
+		header     string
+		want       string
+	}{
+		{ProxyAuth{}, "127.0.0.1:1234", DefaultProxyHeader, "alice"},
+		{ProxyAuth{}, "[::1]:1234", DefaultProxyHeader, "alice"},
+		{ProxyAuth{}, "127.0.0.1", DefaultProxyHeader, "alice"},
+		{ProxyAuth{}, "192.0.2.1:1234", DefaultProxyHeader, ""},
+		{ProxyAuth{}, "10.1.2.3:1234", DefaultProxyHeader, ""},
+		{ProxyAuth{}, "localhost:1234", DefaultProxyHeader, ""},
+		{ProxyAuth{}, "", DefaultProxyHeader, ""},
+		{ProxyAuth{}, "127.0.0.1:1234", "X-Remote-User", ""},
+		{ProxyAuth{Header: "X-Remote-User"}, "127.0.0.1:1234", "X-Remote-User", "alice"},
+		{ProxyAuth{Header: "X-Remote-User"}, "127.0.0.1:1234", DefaultProxyHeader, ""},
+		// configured networks replace loopback
+		{ProxyAuth{Trusted: []*net.IPNet{network}}, "10.1.2.3:1234", DefaultProxyHeader, "alice"},
+		{ProxyAuth{Trusted: []*net.IPNet{network}}, "127.0.0.1:1234", DefaultProxyHeader, ""},
+		{ProxyAuth{Trusted: []*net.IPNet{network}}, "192.0.2.1:1234", DefaultProxyHeader, ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set(test.header, " alice ")
+		if got := test.auth.Current(r); got != test.want {
+			t.Errorf("Current of %+v from %q with %s = %q, want %q", test.auth, test.remoteAddr, test.header, got, test.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if url, err := (ProxyAuth{}).LoginURL(r, "/post/1"); err != nil || url != "/post/1" {
+		t.Errorf("LoginURL without proxy login = %q, %v, want the destination", url, err)
+	}
+	if url, err := (ProxyAuth{Logout: "/sso/logout"}).LogoutURL(r, "/post/1"); err != nil || url != "/sso/logout" {
+		t.Errorf("LogoutURL = %q, %v, want the proxy's logout URL", url, err)
+	}
+}
+
+// newTestProvider serves the discovery document of an OpenID Connect provider.
+func newTestProvider(t *testing.T) *httptest.Server {
+	var provider *httptest.Server
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                provider.URL,
+			"authorization_endpoint":                provider.URL + "/authorize",
+			"token_endpoint":                        provider.URL + "/token",
+			"jwks_uri":                              provider.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	t.Cleanup(provider.Close)
+	return provider
+}
+
+func TestOIDCAuth(t *testing.T) {
+	provider := newTestProvider(t)
+	auth, err := NewOIDCAuth(context.Background(), OIDCConfig{
+		Issuer:      provider.URL,
+		ClientID:    "zwig",
+		RedirectURL: "https://zwig.example.com/auth/oidc/callback",
+		SessionKey:  []byte("secret"),
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCAuth: %v", err)
+	}
+	if _, err := NewOIDCAuth(context.Background(), OIDCConfig{Issuer: provider.URL + "/missing"}); err == nil {
+		t.Error("NewOIDCAuth of a missing provider succeeded")
+	}
+	serve := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, r)
+		return w
+	}
+
+	// login redirects to the provider and remembers the state
+	w := serve("/auth/oidc/login?dest=/post/1", nil)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), provider.URL+"/authorize?") {
+		t.Fatalf("login = %d to %q, want a redirect to the provider", w.Code, w.Header().Get("Location"))
+	}
+	state := location.Query().Get("state")
+	if state == "" || location.Query().Get("nonce") != state || location.Query().Get("client_id") != "zwig" {
+		t.Errorf("login redirects to %s, want the state as nonce", location)
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly || cookie.Value != state+"."+base64.RawURLEncoding.EncodeToString([]byte("/post/1")) {
+		t.Fatalf("login state cookie = %+v, want the state and destination", cookie)
+	}
+	if again := serve("/auth/oidc/login", nil); strings.Contains(again.Header().Get("Location"), "state="+state) {
+		t.Error("login reused the state")
+	}
+
+	// callbacks without matching state are rejected before contacting the provider
+	for _, test := range []struct {
+		name   string
+		path   string
+		cookie *http.Cookie
+	}{
+		{"missing state cookie", "/auth/oidc/callback?state=" + state + "&code=code", nil},
+		{"missing state", "/auth/oidc/callback?code=code", cookie},
+		{"wrong state", "/auth/oidc/callback?state=other&code=code", cookie},
+		{"malformed state cookie", "/auth/oidc/callback?state=" + state + "&code=code", &http.Cookie{Name: oidcStateCookieName, Value: state}},
+	} {
+		if w := serve(test.path, test.cookie); w.Code != http.StatusBadRequest || sessionCookie(w) != nil {
+			t.Errorf("callback with %s = %d, want %d and no session", test.name, w.Code, http.StatusBadRequest)
+		}
+	}
+	// the provider does not issue tokens
+	if w := serve("/auth/oidc/callback?state="+state+"&code=code", cookie); w.Code != http.StatusUnauthorized || sessionCookie(w) != nil {
+		t.Errorf("callback with a failed exchange = %d, want %d and no session", w.Code, http.StatusUnauthorized)
+	}
+
+	// sessions signed with the configured key are accepted
+	w = httptest.NewRecorder()
+	newSessions([]byte("secret")).set(w, httptest.NewRequest(http.MethodGet, "/", nil), "alice@example.com")
+	if user := auth.Current(sessionRequest(sessionCookie(w).Value)); user != "alice@example.com" {
+		t.Errorf("Current = %q, want %q", user, "alice@example.com")
+	}
+	if w := serve("/auth/oidc/signout?dest=//evil.example.com", nil); w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Errorf("signout = %d to %q, want a redirect to /", w.Code, w.Header().Get("Location"))
+	}
+}
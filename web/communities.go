@@ -0,0 +1,77 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// community lists the posts of the community at /c/{slug}, or renders the community directory at /c/.
+func (handler *Handler) community(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	slug := strings.Trim(strings.TrimPrefix(r.URL.Path, "/c/"), "/")
+	if slug == "" {
+		handler.communities(w, r, auth, user)
+		return
+	}
+	community, err := handler.store.GetCommunity(handler.config.Context(r), slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	handler.listing(w, r, user, &community)
+}
+
+// communities shows the directory of listed communities and creates a community on POST.
+func (handler *Handler) communities(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	c := handler.config.Context(r)
+	var message string
+	if r.Method == http.MethodPost {
+		if !auth {
+			http.Redirect(w, r, "/auth/login", http.StatusFound)
+			return
+		}
+		community, err := models.NewCommunity(r.FormValue("slug"), r.FormValue("name"), r.FormValue("description"), user, r.FormValue("visibility"))
+		if err == nil {
+			err = handler.store.CreateCommunity(c, community)
+		}
+		if err != nil {
+			message = err.Error()
+		} else {
+			http.Redirect(w, r, "/c/"+community.Slug, http.StatusFound)
+			return
+		}
+	}
+	communities, err := handler.store.Communities(c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	listed := make([]models.Community, 0, len(communities))
+	for _, community := range communities {
+		if community.Listed() {
+			listed = append(listed, community)
+		}
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := handler.communitiesTmpl.Execute(w, struct {
+		Karma        int
+		Main         string
+		User         string
+		Communities  []models.Community
+		Visibilities []string
+		Message      string
+	}{
+		Karma:        karma,
+		User:         user,
+		Communities:  listed,
+		Visibilities: models.Visibilities(),
+		Message:      message,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
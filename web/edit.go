@@ -0,0 +1,121 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/utils"
+)
+
+// template-internal revision representation
+type revisionItem struct {
+	HTML  template.HTML
+	Since string
+}
+
+// edit replaces the text of the user's own post on POST and returns to the thread.
+func (handler *Handler) edit(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := handler.config.Context(r)
+	id, err := strconv.ParseInt(r.FormValue("post"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := handler.store.EditPost(c, user, id, r.FormValue("text"), handler.config.EditWindow); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	http.Redirect(w, r, "/comments?id="+pageOf(r, id), http.StatusFound)
+}
+
+// delete deletes the user's own post on POST and returns to the thread.
+func (handler *Handler) delete(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := handler.config.Context(r)
+	id, err := strconv.ParseInt(r.FormValue("post"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := handler.store.DeletePost(c, user, id); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	http.Redirect(w, r, "/comments?id="+pageOf(r, id), http.StatusFound)
+}
+
+// revisions shows the previous versions of the text of a post.
+func (handler *Handler) revisions(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	c := handler.config.Context(r)
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post, err := handler.store.GetPost(c, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, user, handler.config.Moderators, []models.Post{post})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var items []revisionItem
+	if !names.Concealed(post) {
+		revisions, err := handler.store.Revisions(c, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items = make([]revisionItem, len(revisions))
+		for i, revision := range revisions {
+			items[len(items)-1-i] = revisionItem{
+				HTML:  RenderText(revision.Text),
+				Since: utils.HumanTimeFormat(revision.Date),
+			}
+		}
+	}
+	votes, err := handler.votesBy(c, []int64{id}, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := handler.revisionsTmpl.Execute(w, struct {
+		Karma     int
+		Main      string
+		User      string
+		Post      postItem
+		Revisions []revisionItem
+	}{
+		Karma:     karma,
+		User:      user,
+		Post:      handler.toPostItem(id, post, user, votes, names),
+		Revisions: items,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// pageOf returns the post shown on the page a form has been submitted from.
+func pageOf(r *http.Request, id int64) string {
+	if page := r.FormValue("page"); page != "" {
+		return page
+	}
+	return strconv.FormatInt(id, 10)
+}
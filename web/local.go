@@ -0,0 +1,143 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+)
+
+// the template file of the login and registration page
+const (
+	loginTemplateFile = "login.html"
+)
+
+// LocalConfig configures a LocalAuth.
+type LocalConfig struct {
+	// TemplateDir is the directory containing the HTML templates.
+	TemplateDir string
+	// Context derives the request context passed to the store.
+	// Defaults to the context of the request.
+	Context func(*http.Request) context.Context
+	// SessionKey signs the session cookies. Defaults to a random key,
+	// which invalidates all sessions on restart.
+	SessionKey []byte
+}
+
+// LocalAuth authenticates users with local accounts protected by a password
+// and keeps them logged in using signed session cookies.
+// It serves the login and registration page below /auth/.
+type LocalAuth struct {
+	mux       *http.ServeMux
+	store     models.UserStore
+	config    LocalConfig
+	sessions  sessions
+	loginTmpl *template.Template
+}
+
+// NewLocalAuth initializes a new local account authenticator bound to the given store.
+func NewLocalAuth(store models.UserStore, config LocalConfig) *LocalAuth {
+	if config.TemplateDir == "" {
+		config.TemplateDir = DefaultTemplateDir
+	}
+	if config.Context == nil {
+		config.Context = func(r *http.Request) context.Context { return r.Context() }
+	}
+	mux := http.NewServeMux()
+	auth := &LocalAuth{mux, store, config, newSessions(config.SessionKey), nil}
+	auth.loginTmpl = template.Must(template.ParseFiles(
+		filepath.Join(config.TemplateDir, baseTemplateFile),
+		filepath.Join(config.TemplateDir, loginTemplateFile)))
+	mux.HandleFunc("/auth/local/login", auth.login)
+	mux.HandleFunc("/auth/local/register", auth.register)
+	mux.HandleFunc("/auth/local/signout", auth.signout)
+	return auth
+}
+
+// Current returns the user of the request's session.
+func (auth *LocalAuth) Current(r *http.Request) string {
+	return auth.sessions.get(r)
+}
+
+// LoginURL returns the URL of the login page.
+func (auth *LocalAuth) LoginURL(r *http.Request, dest string) (string, error) {
+	return "/auth/local/login?dest=" + url.QueryEscape(dest), nil
+}
+
+// LogoutURL returns the URL ending the session.
+func (auth *LocalAuth) LogoutURL(r *http.Request, dest string) (string, error) {
+	return "/auth/local/signout?dest=" + url.QueryEscape(dest), nil
+}
+
+// ServeHTTP serves the login and registration pages.
+func (auth *LocalAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth.mux.ServeHTTP(w, r)
+}
+
+func (auth *LocalAuth) login(w http.ResponseWriter, r *http.Request) {
+	dest := localDest(r.FormValue("dest"))
+	if r.Method != http.MethodPost {
+		auth.render(w, dest, "", "")
+		return
+	}
+	c := auth.config.Context(r)
+	name := r.FormValue("name")
+	account, err := auth.store.GetAccount(c, name)
+	if err != nil || !account.CheckPassword(r.FormValue("password")) {
+		auth.render(w, dest, name, "Unknown name or wrong password.")
+		return
+	}
+	auth.sessions.set(w, r, account.Name)
+	http.Redirect(w, r, dest, http.StatusFound)
+}
+
+func (auth *LocalAuth) register(w http.ResponseWriter, r *http.Request) {
+	dest := localDest(r.FormValue("dest"))
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/auth/local/login?dest="+url.QueryEscape(dest), http.StatusFound)
+		return
+	}
+	c := auth.config.Context(r)
+	name := r.FormValue("name")
+	if r.FormValue("password") != r.FormValue("confirm") {
+		auth.render(w, dest, name, "Passwords do not match.")
+		return
+	}
+	account, err := models.NewAccount(name, r.FormValue("password"))
+	if err != nil {
+		auth.render(w, dest, name, err.Error())
+		return
+	}
+	if err := auth.store.CreateAccount(c, account); err != nil {
+		auth.render(w, dest, name, err.Error())
+		return
+	}
+	auth.sessions.set(w, r, account.Name)
+	http.Redirect(w, r, dest, http.StatusFound)
+}
+
+func (auth *LocalAuth) signout(w http.ResponseWriter, r *http.Request) {
+	auth.sessions.clear(w)
+	http.Redirect(w, r, localDest(r.FormValue("dest")), http.StatusFound)
+}
+
+func (auth *LocalAuth) render(w http.ResponseWriter, dest, name, message string) {
+	if err := auth.loginTmpl.Execute(w, struct {
+		Karma   int
+		Main    string
+		User    string
+		Dest    string
+		Name    string
+		Message string
+	}{
+		Dest:    dest,
+		Name:    name,
+		Message: message,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
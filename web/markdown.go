@@ -0,0 +1,137 @@
+package web
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// trailingPunctuation is stripped from the end of autolinked URLs.
+const trailingPunctuation = ".,;:!?)'"
+
+// linkTerminators end autolinked URLs like whitespace does.
+const linkTerminators = `<>"`
+
+// RenderText renders the restricted Markdown subset supported in posts as sanitized HTML:
+// **bold**, *italics* or _italics_, `code`, lines quoted with > and autolinked http(s) URLs.
+// Everything else is escaped, so the result is safe to embed into pages.
+func RenderText(text string) template.HTML {
+	var b strings.Builder
+	quoted := false
+	for i, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		quote := strings.HasPrefix(line, ">")
+		if quote {
+			line = strings.TrimPrefix(line[1:], " ")
+		}
+		switch {
+		case quote && !quoted:
+			b.WriteString("<blockquote>")
+		case !quote && quoted:
+			b.WriteString("</blockquote>")
+		case i > 0:
+			b.WriteString("<br>")
+		}
+		quoted = quote
+		renderInline(&b, line)
+	}
+	if quoted {
+		b.WriteString("</blockquote>")
+	}
+	return template.HTML(b.String())
+}
+
+// renderInline writes a single line of text, replacing inline markup by HTML elements.
+func renderInline(b *strings.Builder, text string) {
+	plain := 0
+	flush := func(end int) {
+		b.WriteString(template.HTMLEscapeString(text[plain:end]))
+	}
+	for i := 0; i < len(text); {
+		var (
+			n     int
+			write func()
+		)
+		switch {
+		case text[i] == '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end > 0 {
+				code := text[i+1 : i+1+end]
+				n, write = end+2, func() {
+					b.WriteString("<code>" + template.HTMLEscapeString(code) + "</code>")
+				}
+			}
+		case strings.HasPrefix(text[i:], "**"):
+			if end := strings.Index(text[i+2:], "**"); end > 0 && emphasized(text[i+2:i+2+end]) {
+				inner := text[i+2 : i+2+end]
+				n, write = end+4, func() {
+					b.WriteString("<strong>")
+					renderInline(b, inner)
+					b.WriteString("</strong>")
+				}
+			}
+		case text[i] == '*' || text[i] == '_' && !wordBefore(text, i):
+			delim := text[i]
+			end := strings.IndexByte(text[i+1:], delim)
+			if end > 0 && emphasized(text[i+1:i+1+end]) && (delim == '*' || !wordAfter(text, i+2+end)) {
+				inner := text[i+1 : i+1+end]
+				n, write = end+2, func() {
+					b.WriteString("<em>")
+					renderInline(b, inner)
+					b.WriteString("</em>")
+				}
+			}
+		case (strings.HasPrefix(text[i:], "http://") || strings.HasPrefix(text[i:], "https://")) && !wordBefore(text, i):
+			if link := autolink(text[i:]); link != "" {
+				n, write = len(link), func() {
+					href := template.HTMLEscapeString(link)
+					b.WriteString(`<a href="` + href + `" rel="nofollow">` + href + `</a>`)
+				}
+			}
+		}
+		if write == nil {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			continue
+		}
+		flush(i)
+		write()
+		i += n
+		plain = i
+	}
+	flush(len(text))
+}
+
+// emphasized reports if the text between emphasis delimiters forms a valid span.
+func emphasized(inner string) bool {
+	return inner != "" && strings.TrimSpace(inner) == inner
+}
+
+// wordBefore reports if the byte at index i is preceded by a letter or digit.
+func wordBefore(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return i > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// wordAfter reports if the text continues with a letter or digit at index i.
+func wordAfter(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return i < len(text) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// autolink returns the URL at the start of the text without trailing punctuation,
+// or an empty string if it is not a valid http(s) URL.
+func autolink(text string) string {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(linkTerminators, r)
+	})
+	if end < 0 {
+		end = len(text)
+	}
+	link := strings.TrimRight(text[:end], trailingPunctuation)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return link
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"script tag", "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"ampersand", "a & b", "a &amp; b"},
+		{"bold", "**bold**", "<strong>bold</strong>"},
+		{"italics", "*it* and _it_", "<em>it</em> and <em>it</em>"},
+		{"underscores inside words", "snake_case_name", "snake_case_name"},
+		{"nested emphasis", "**a *b* c**", "<strong>a <em>b</em> c</strong>"},
+		{"code in bold", "**`code`**", "<strong><code>code</code></strong>"},
+		{"unclosed bold", "**unclosed", "**unclosed"},
+		{"unclosed italics in bold", "**a *b c**", "<strong>a *b c</strong>"},
+		{"delimiters only", "***", "***"},
+		{"spaced bold", "** spaced **", "** spaced **"},
+		{"code", "`code`", "<code>code</code>"},
+		{"unclosed code", "`unclosed", "`unclosed"},
+		{"empty code", "``", "``"},
+		{"markup in code", "`**not bold**`", "<code>**not bold**</code>"},
+		{"html in code", "`<b>`", "<code>&lt;b&gt;</code>"},
+		{"line break", "a\nb", "a<br>b"},
+		{"quote", "> quote\n> more\nafter", "<blockquote>quote<br>more</blockquote>after"},
+		{"empty quote", ">", "<blockquote></blockquote>"},
+		{"html in quote", "> <script>", "<blockquote>&lt;script&gt;</blockquote>"},
+		{"link", "see https://example.com/a?b=1&c=2.",
+			`see <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow">https://example.com/a?b=1&amp;c=2</a>.`},
+		{"link in parentheses", "(https://example.com)",
+			`(<a href="https://example.com" rel="nofollow">https://example.com</a>)`},
+		{"link inside word", "xhttps://example.com", "xhttps://example.com"},
+		{"double quote ends link", `https://example.com/"onmouseover="alert(1)`,
+			`<a href="https://example.com/" rel="nofollow">https://example.com/</a>&#34;onmouseover=&#34;alert(1)`},
+		{"single quote escaped in link", "https://example.com/'onmouseover='alert(1)",
+			`<a href="https://example.com/&#39;onmouseover=&#39;alert(1" rel="nofollow">https://example.com/&#39;onmouseover=&#39;alert(1</a>)`},
+		{"tag ends link", "https://example.com/<script>",
+			`<a href="https://example.com/" rel="nofollow">https://example.com/</a>&lt;script&gt;`},
+		{"javascript url", "javascript:alert(1)", "javascript:alert(1)"},
+		{"markdown link", "[x](javascript:alert(1))", "[x](javascript:alert(1))"},
+		{"link without host", "http://javascript:alert(1)", "http://javascript:alert(1)"},
+	}
+	for _, test := range tests {
+		if got := string(RenderText(test.text)); got != test.want {
+			t.Errorf("%s: RenderText(%q) = %q, want %q", test.name, test.text, got, test.want)
+		}
+	}
+}
+
+// TestRenderTextLinks verifies that all links are marked as nofollow and only use http(s).
+func TestRenderTextLinks(t *testing.T) {
+	for _, text := range []string{
+		"https://example.com",
+		"**https://example.com**",
+		"> http://example.com/path",
+		"javascript:alert(1) https://example.com data:text/html,x",
+	} {
+		html := string(RenderText(text))
+		if links := strings.Count(html, "<a "); links != 1 || strings.Count(html, `rel="nofollow"`) != links {
+			t.Errorf("RenderText(%q) = %q, want one nofollow link", text, html)
+		}
+		if strings.Contains(html, `href="javascript`) || strings.Contains(html, `href="data`) {
+			t.Errorf("RenderText(%q) = %q links to an unsafe scheme", text, html)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/utils"
+)
+
+// template-internal audit log entry representation
+type modActionItem struct {
+	Moderator string
+	Action    string
+	Post      int64
+	Reason    string
+	Since     string
+}
+
+// moderate applies a moderation action to a post on POST and returns to the thread, or to dest if given.
+func (handler *Handler) moderate(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := handler.config.Context(r)
+	id, err := strconv.ParseInt(r.FormValue("post"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post, err := handler.store.GetPost(c, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if ok, err := models.CanModerate(c, handler.store, handler.config.Moderators, user, post); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !ok {
+		http.Error(w, "Only moderators can moderate this post", http.StatusForbidden)
+		return
+	}
+	action, err := models.NewModAction(user, r.FormValue("action"), id, r.FormValue("reason"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := handler.store.Moderate(c, action); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	if dest := r.FormValue("dest"); dest != "" {
+		http.Redirect(w, r, localDest(dest), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/comments?id="+pageOf(r, id), http.StatusFound)
+}
+
+// modlog shows the moderation audit log to moderators, newest first.
+func (handler *Handler) modlog(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	c := handler.config.Context(r)
+	viewer, err := handler.store.GetUser(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !handler.config.Moderators.Includes(viewer) {
+		http.Error(w, "Only moderators can view the moderation log", http.StatusForbidden)
+		return
+	}
+	actions, next, err := handler.store.ModerationLog(c, models.ModLog{
+		Limit:  handler.config.PageSize,
+		Cursor: r.URL.Query().Get("cursor"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	moderators := make([]string, len(actions))
+	for i, action := range actions {
+		moderators[i] = action.Moderator
+	}
+	users, err := handler.store.GetUsers(c, moderators)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]modActionItem, len(actions))
+	for i, action := range actions {
+		items[i] = modActionItem{
+			Moderator: users.Handle(action.Moderator),
+			Action:    action.Action,
+			Post:      action.Post,
+			Reason:    action.Reason,
+			Since:     utils.HumanTimeFormat(action.Date),
+		}
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := handler.modlogTmpl.Execute(w, struct {
+		Karma   int
+		Main    string
+		User    string
+		Actions []modActionItem
+		Next    string
+	}{
+		Karma:   karma,
+		User:    user,
+		Actions: items,
+		Next:    next,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
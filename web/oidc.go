@@ -0,0 +1,161 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// the name and lifetime in seconds of the cookie tracking a login in progress
+const (
+	oidcStateCookieName = "zwig_oidc_state"
+	oidcStateDuration   = 600
+)
+
+// OIDCConfig configures an OIDCAuth.
+type OIDCConfig struct {
+	// Issuer is the URL of the OpenID Connect provider used for discovery.
+	Issuer string
+	// ClientID and ClientSecret are the credentials registered with the provider.
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of /auth/oidc/callback registered with the provider.
+	RedirectURL string
+	// SessionKey signs the session cookies. Defaults to a random key,
+	// which invalidates all sessions on restart.
+	SessionKey []byte
+}
+
+// OIDCAuth authenticates users with a generic OpenID Connect provider and
+// keeps them logged in using signed session cookies. Users are identified by
+// their verified email address, or by their subject if the provider does not
+// disclose a verified email. It serves the login flow below /auth/oidc/.
+type OIDCAuth struct {
+	mux      *http.ServeMux
+	sessions sessions
+	verifier *oidc.IDTokenVerifier
+	oauth2   oauth2.Config
+}
+
+// NewOIDCAuth discovers the provider and initializes a new OpenID Connect authenticator.
+func NewOIDCAuth(c context.Context, config OIDCConfig) (*OIDCAuth, error) {
+	provider, err := oidc.NewProvider(c, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	auth := &OIDCAuth{
+		mux:      mux,
+		sessions: newSessions(config.SessionKey),
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email"},
+		},
+	}
+	mux.HandleFunc("/auth/oidc/login", auth.login)
+	mux.HandleFunc("/auth/oidc/callback", auth.callback)
+	mux.HandleFunc("/auth/oidc/signout", auth.signout)
+	return auth, nil
+}
+
+// Current returns the user of the request's session.
+func (auth *OIDCAuth) Current(r *http.Request) string {
+	return auth.sessions.get(r)
+}
+
+// LoginURL returns the URL starting the login flow.
+func (auth *OIDCAuth) LoginURL(r *http.Request, dest string) (string, error) {
+	return "/auth/oidc/login?dest=" + url.QueryEscape(dest), nil
+}
+
+// LogoutURL returns the URL ending the session.
+func (auth *OIDCAuth) LogoutURL(r *http.Request, dest string) (string, error) {
+	return "/auth/oidc/signout?dest=" + url.QueryEscape(dest), nil
+}
+
+// ServeHTTP serves the login flow.
+func (auth *OIDCAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth.mux.ServeHTTP(w, r)
+}
+
+// login redirects to the provider. The state doubles as nonce of the ID token
+// and is remembered in a cookie together with the destination.
+func (auth *OIDCAuth) login(w http.ResponseWriter, r *http.Request) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		http.Error(w, "Failed to generate state: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(raw)
+	dest := localDest(r.FormValue("dest"))
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state + "." + base64.RawURLEncoding.EncodeToString([]byte(dest)),
+		Path:     "/auth/oidc/",
+		MaxAge:   oidcStateDuration,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, auth.oauth2.AuthCodeURL(state, oidc.Nonce(state)), http.StatusFound)
+}
+
+func (auth *OIDCAuth) callback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		http.Error(w, "Missing login state", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(cookie.Value, ".", 2)
+	state := parts[0]
+	if len(parts) != 2 || r.FormValue("state") != state {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	dest, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	token, err := auth.oauth2.Exchange(r.Context(), r.FormValue("code"))
+	if err != nil {
+		http.Error(w, "Failed to exchange code: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "Missing ID token", http.StatusUnauthorized)
+		return
+	}
+	idToken, err := auth.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil || idToken.Nonce != state {
+		http.Error(w, "Invalid ID token", http.StatusUnauthorized)
+		return
+	}
+	claims := struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}{}
+	if err := idToken.Claims(&claims); err != nil {
+		http.Error(w, "Invalid ID token: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	user := idToken.Subject
+	if claims.Email != "" && claims.EmailVerified {
+		user = claims.Email
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookieName, Path: "/auth/oidc/", MaxAge: -1})
+	auth.sessions.set(w, r, user)
+	http.Redirect(w, r, localDest(string(dest)), http.StatusFound)
+}
+
+func (auth *OIDCAuth) signout(w http.ResponseWriter, r *http.Request) {
+	auth.sessions.clear(w)
+	http.Redirect(w, r, localDest(r.FormValue("dest")), http.StatusFound)
+}
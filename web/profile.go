@@ -0,0 +1,92 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/utils"
+)
+
+// profile shows the posts or comments of a user, newest first, together with their karma.
+// Anonymous posts are only listed for the user themselves and for moderators.
+func (handler *Handler) profile(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	c := handler.config.Context(r)
+	profile, err := handler.store.GetUserByHandle(c, strings.TrimPrefix(r.URL.Path, "/u/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	history := models.History{
+		Comments: r.URL.Query().Get("kind") == "comments",
+		Limit:    handler.config.PageSize,
+		Cursor:   r.URL.Query().Get("cursor"),
+	}
+	if auth {
+		viewer, err := handler.store.GetUser(c, user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		history.Anonymous = user == profile.ID || handler.config.Moderators.Includes(viewer)
+	}
+	stats, err := handler.store.GetStats(c, profile.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	posts, ids, next, err := handler.store.PostsBy(c, profile.ID, history)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	votes, err := handler.votesBy(c, ids, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, user, handler.config.Moderators, posts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]postItem, len(posts))
+	for i := range posts {
+		items[i] = handler.toPostItem(ids[i], posts[i], user, votes, names)
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	kind := "posts"
+	if history.Comments {
+		kind = "comments"
+	}
+	if err := handler.profileTmpl.Execute(w, struct {
+		Karma     int
+		Main      string
+		User      string
+		Handle    string
+		Joined    string
+		UserKarma int
+		Stats     models.UserStats
+		Kind      string
+		Posts     []postItem
+		Next      string
+		OwnPage   bool
+	}{
+		Karma:     karma,
+		User:      user,
+		Handle:    profile.Handle,
+		Joined:    utils.HumanTimeFormat(profile.Created),
+		UserKarma: profile.Karma,
+		Stats:     stats,
+		Kind:      kind,
+		Posts:     items,
+		Next:      next,
+		OwnPage:   user == profile.ID,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
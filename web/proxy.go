@@ -0,0 +1,72 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultProxyHeader is the header read by ProxyAuth if none is configured.
+const DefaultProxyHeader = "X-Forwarded-User"
+
+// ProxyAuth trusts a reverse proxy, like an SSO gateway, to authenticate users
+// and pass the user in a request header. The proxy must strip the header from
+// incoming requests, requests from outside of Trusted are always anonymous.
+type ProxyAuth struct {
+	// Header carries the user, defaults to DefaultProxyHeader.
+	Header string
+	// Trusted lists the networks of the proxies. If empty, only loopback peers are trusted.
+	Trusted []*net.IPNet
+	// Login and Logout are the proxy's login and logout URLs.
+	// If empty, the user is sent straight to the destination.
+	Login, Logout string
+}
+
+// Current returns the user passed by the proxy.
+func (auth ProxyAuth) Current(r *http.Request) string {
+	if !auth.trusts(r) {
+		return ""
+	}
+	header := auth.Header
+	if header == "" {
+		header = DefaultProxyHeader
+	}
+	return strings.TrimSpace(r.Header.Get(header))
+}
+
+// LoginURL returns the proxy's login URL.
+func (auth ProxyAuth) LoginURL(r *http.Request, dest string) (string, error) {
+	if auth.Login == "" {
+		return dest, nil
+	}
+	return auth.Login, nil
+}
+
+// LogoutURL returns the proxy's logout URL.
+func (auth ProxyAuth) LogoutURL(r *http.Request, dest string) (string, error) {
+	if auth.Logout == "" {
+		return dest, nil
+	}
+	return auth.Logout, nil
+}
+
+// trusts reports if the request has been sent by a trusted proxy.
+func (auth ProxyAuth) trusts(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if len(auth.Trusted) == 0 {
+		return ip.IsLoopback()
+	}
+	for _, network := range auth.Trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/utils"
+)
+
+// template-internal report representation
+type reportItem struct {
+	Reporter string
+	Reason   string
+	Since    string
+}
+
+// template-internal representation of a post in the report queue
+type reportedItem struct {
+	postItem
+	Reports []reportItem
+}
+
+// report records the user's report of a post on POST and returns to dest.
+func (handler *Handler) report(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := handler.config.Context(r)
+	id, err := strconv.ParseInt(r.FormValue("post"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := models.NewReport(user, id, r.FormValue("reason"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := handler.store.SubmitReport(c, report, handler.config.ReportThreshold); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	http.Redirect(w, r, localDest(r.FormValue("dest")), http.StatusFound)
+}
+
+// reports shows the queue of reported posts to moderators, who can approve or remove them.
+func (handler *Handler) reports(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	c := handler.config.Context(r)
+	viewer, err := handler.store.GetUser(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !handler.config.Moderators.Includes(viewer) {
+		http.Error(w, "Only moderators can review reports", http.StatusForbidden)
+		return
+	}
+	posts, ids, next, err := handler.store.ReportedPosts(c, models.ReportQueue{
+		Limit:  handler.config.PageSize,
+		Cursor: r.URL.Query().Get("cursor"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	reports, err := handler.store.GetReports(c, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, user, handler.config.Moderators, posts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var reporters []string
+	for _, id := range ids {
+		for _, report := range reports[id] {
+			reporters = append(reporters, report.Reporter)
+		}
+	}
+	users, err := handler.store.GetUsers(c, reporters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	votes, err := handler.votesBy(c, ids, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]reportedItem, len(posts))
+	for i := range posts {
+		items[i].postItem = handler.toPostItem(ids[i], posts[i], user, votes, names)
+		for _, report := range reports[ids[i]] {
+			items[i].Reports = append(items[i].Reports, reportItem{
+				Reporter: users.Handle(report.Reporter),
+				Reason:   report.Reason,
+				Since:    utils.HumanTimeFormat(report.Date),
+			})
+		}
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := handler.reportsTmpl.Execute(w, struct {
+		Karma int
+		Main  string
+		User  string
+		Posts []reportedItem
+		Next  string
+	}{
+		Karma: karma,
+		User:  user,
+		Posts: items,
+		Next:  next,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
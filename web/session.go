@@ -0,0 +1,105 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the name of the session cookie
+const (
+	sessionCookieName = "zwig_session"
+)
+
+// sessions issues and verifies session cookies signed with a secret key.
+// A cookie holds the user, its expiry and an HMAC over both.
+type sessions struct {
+	key []byte
+}
+
+// newSessions initializes sessions signed with the given key. A random key
+// is generated if none is given, invalidating all sessions on restart.
+func newSessions(key []byte) sessions {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic("web: could not generate session key: " + err.Error())
+		}
+	}
+	return sessions{key}
+}
+
+func (s sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// set starts a session for the user lasting authCookieDuration seconds.
+func (s sessions) set(w http.ResponseWriter, r *http.Request, user string) {
+	expires := time.Now().Add(authCookieDuration * time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    payload + "." + s.sign(payload),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   authCookieDuration,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// get returns the user of a valid session or an empty string.
+func (s sessions) get(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	i := strings.LastIndex(cookie.Value, ".")
+	if i < 0 {
+		return ""
+	}
+	payload, sig := cookie.Value[:i], cookie.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return ""
+	}
+	parts := strings.SplitN(payload, ".", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ""
+	}
+	user, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ""
+	}
+	return string(user)
+}
+
+// clear ends the session.
+func (s sessions) clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// localDest restricts redirect destinations to paths on this site.
+func localDest(dest string) string {
+	if !strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "//") || strings.HasPrefix(dest, "/\\") {
+		return "/"
+	}
+	return dest
+}
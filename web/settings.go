@@ -0,0 +1,47 @@
+package web
+
+import (
+	"net/http"
+)
+
+// settings shows the profile of the user and changes their handle on POST.
+func (handler *Handler) settings(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	if !auth {
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	c := handler.config.Context(r)
+	var message string
+	if r.Method == http.MethodPost {
+		if err := handler.store.SetHandle(c, user, r.FormValue("handle")); err != nil {
+			message = err.Error()
+		} else {
+			http.Redirect(w, r, "/settings", http.StatusFound)
+			return
+		}
+	}
+	profile, err := handler.store.GetUser(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := handler.settingsTmpl.Execute(w, struct {
+		Karma   int
+		Main    string
+		User    string
+		Handle  string
+		Message string
+	}{
+		Karma:   karma,
+		User:    user,
+		Handle:  profile.Handle,
+		Message: message,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
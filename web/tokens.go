@@ -0,0 +1,89 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/utils"
+)
+
+// template-internal API token representation
+type tokenItem struct {
+	Hash   string
+	Name   string
+	Scopes []string
+	Since  string
+}
+
+// tokens lists the API tokens of the user and creates or revokes them on POST.
+// The secret of a new token is only rendered once and can not be recovered.
+func (handler *Handler) tokens(w http.ResponseWriter, r *http.Request, auth bool, user string) {
+	if !auth {
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	c := handler.config.Context(r)
+	var created, secret string
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "create":
+			token, s, err := models.NewToken(user, r.FormValue("name"), r.Form["scope"])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := handler.store.CreateToken(c, token); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			created, secret = token.Name, s
+		case "revoke":
+			if err := handler.store.RevokeToken(c, user, r.FormValue("token")); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/tokens", http.StatusFound)
+			return
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+	}
+	tokens, err := handler.store.TokensBy(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items := make([]tokenItem, len(tokens))
+	for i, token := range tokens {
+		items[i] = tokenItem{
+			Hash:   token.Hash,
+			Name:   token.Name,
+			Scopes: token.Scopes,
+			Since:  utils.HumanTimeFormat(token.Created),
+		}
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := handler.tokensTmpl.Execute(w, struct {
+		Karma   int
+		Main    string
+		User    string
+		Tokens  []tokenItem
+		Scopes  []string
+		Created string
+		Secret  string
+	}{
+		Karma:   karma,
+		User:    user,
+		Tokens:  items,
+		Scopes:  models.Scopes(),
+		Created: created,
+		Secret:  secret,
+	}); err != nil {
+		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -1,15 +1,16 @@
 package web
 
 import (
+	"errors"
 	"html/template"
+	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/user"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -18,50 +19,152 @@ import (
 	"github.com/lnsp/zwig/models"
 )
 
-// the duration of the auth cookie
+// the duration of the auth cookie in seconds
 const (
 	authCookieDuration = 608400
 )
 
 // collection of template file names
 const (
-	baseTemplateFile = "static/templates/base.html"
-	showTemplateFile = "static/templates/show.html"
-	listTemplateFile = "static/templates/list.html"
+	baseTemplateFile        = "base.html"
+	showTemplateFile        = "show.html"
+	listTemplateFile        = "list.html"
+	tokensTemplateFile      = "tokens.html"
+	settingsTemplateFile    = "settings.html"
+	profileTemplateFile     = "profile.html"
+	communitiesTemplateFile = "communities.html"
+	modlogTemplateFile      = "modlog.html"
+	reportsTemplateFile     = "reports.html"
+	revisionsTemplateFile   = "revisions.html"
 )
 
+// DefaultTemplateDir is the template directory used if none is configured.
+const DefaultTemplateDir = "static/templates"
+
 // collection of available colors
 var (
-	colors = [4]string{"blue", "red", "orange", "green"}
+	colors = models.Colors
 )
 
+// authHandleFunc handles a request on behalf of the user with the given ID, if authenticated.
 type authHandleFunc func(http.ResponseWriter, *http.Request, bool, string)
 
+// Authenticator identifies the user behind a request.
+type Authenticator interface {
+	// Current returns the requesting user or an empty string if the request is anonymous.
+	Current(r *http.Request) string
+	// LoginURL returns the URL a user has to visit to login and return to dest.
+	LoginURL(r *http.Request, dest string) (string, error)
+	// LogoutURL returns the URL a user has to visit to logout and return to dest.
+	LogoutURL(r *http.Request, dest string) (string, error)
+}
+
+// Authenticators keeping their own sessions, like LocalAuth and OIDCAuth, also
+// implement http.Handler to serve their pages below /auth/.
+
+// anonymous is an Authenticator treating every request as anonymous.
+type anonymous struct{}
+
+func (anonymous) Current(r *http.Request) string                         { return "" }
+func (anonymous) LoginURL(r *http.Request, dest string) (string, error)  { return dest, nil }
+func (anonymous) LogoutURL(r *http.Request, dest string) (string, error) { return dest, nil }
+
+// Config configures a web handler.
+type Config struct {
+	// TemplateDir is the directory containing the HTML templates.
+	TemplateDir string
+	// Context derives the request context passed to the store.
+	// Defaults to the context of the request.
+	Context func(*http.Request) context.Context
+	// Auth identifies users. Defaults to treating every request as anonymous.
+	Auth Authenticator
+	// PageSize is the number of posts per listing page.
+	// It is bounded by models.MaxPageSize.
+	PageSize int
+	// Moderators may see the real authors of anonymous posts.
+	Moderators models.Moderators
+	// ReportThreshold is the number of pending reports hiding a post until a moderator
+	// reviews it. Defaults to models.DefaultReportThreshold, negative values never hide posts.
+	ReportThreshold int
+	// EditWindow is the time after submitting a post during which its author may edit it.
+	// Defaults to models.DefaultEditWindow, negative values never expire.
+	EditWindow time.Duration
+}
+
 // Handler presents a Web UI to interact with posts.
 type Handler struct {
-	mux                *http.ServeMux
-	listTmpl, showTmpl *template.Template
+	mux                          *http.ServeMux
+	store                        models.Store
+	config                       Config
+	listTmpl, showTmpl           *template.Template
+	tokensTmpl, settingsTmpl     *template.Template
+	profileTmpl, communitiesTmpl *template.Template
+	modlogTmpl, reportsTmpl      *template.Template
+	revisionsTmpl                *template.Template
 }
 
-// New initializes a new web handler.
-func New() *Handler {
+// New initializes a new web handler bound to the given store.
+func New(store models.Store, config Config) *Handler {
+	if config.TemplateDir == "" {
+		config.TemplateDir = DefaultTemplateDir
+	}
+	if config.Context == nil {
+		config.Context = func(r *http.Request) context.Context { return r.Context() }
+	}
+	if config.Auth == nil {
+		config.Auth = anonymous{}
+	}
+	config.PageSize = models.Listing{Limit: config.PageSize}.PageSize()
+	if config.ReportThreshold == 0 {
+		config.ReportThreshold = models.DefaultReportThreshold
+	}
+	if config.EditWindow == 0 {
+		config.EditWindow = models.DefaultEditWindow
+	}
 	mux := http.NewServeMux()
-	web := &Handler{mux, nil, nil}
+	web := &Handler{mux, store, config, nil, nil, nil, nil, nil, nil, nil, nil, nil}
 	// load templates
-	web.listTmpl = template.Must(template.ParseFiles(baseTemplateFile, listTemplateFile))
-	web.showTmpl = template.Must(template.ParseFiles(baseTemplateFile, showTemplateFile))
+	base := filepath.Join(config.TemplateDir, baseTemplateFile)
+	web.listTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, listTemplateFile)))
+	web.showTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, showTemplateFile)))
+	web.tokensTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, tokensTemplateFile)))
+	web.settingsTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, settingsTemplateFile)))
+	web.profileTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, profileTemplateFile)))
+	web.communitiesTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, communitiesTemplateFile)))
+	web.modlogTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, modlogTemplateFile)))
+	web.reportsTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, reportsTemplateFile)))
+	web.revisionsTmpl = template.Must(template.ParseFiles(base, filepath.Join(config.TemplateDir, revisionsTemplateFile)))
 	// add dynamic routes
 	mux.Handle("/", web.auth(web.list, false))
 	mux.Handle("/comments", web.auth(web.comments, false))
 	mux.Handle("/post", web.auth(web.post, true))
 	mux.Handle("/vote", web.auth(web.vote, true))
+	mux.Handle("/tokens", web.auth(web.tokens, true))
+	mux.Handle("/settings", web.auth(web.settings, true))
+	mux.Handle("/u/", web.auth(web.profile, false))
+	mux.Handle("/c/", web.auth(web.community, false))
+	mux.Handle("/moderate", web.auth(web.moderate, true))
+	mux.Handle("/modlog", web.auth(web.modlog, true))
+	mux.Handle("/report", web.auth(web.report, true))
+	mux.Handle("/reports", web.auth(web.reports, true))
+	mux.Handle("/edit", web.auth(web.edit, true))
+	mux.Handle("/delete", web.auth(web.delete, true))
+	mux.Handle("/revisions", web.auth(web.revisions, false))
+	mux.HandleFunc("/auth/login", web.login)
 	mux.HandleFunc("/auth/logout", web.logout)
+	if pages, ok := config.Auth.(http.Handler); ok {
+		mux.Handle("/auth/", pages)
+	}
 	return web
 }
 
+func (handler *Handler) login(w http.ResponseWriter, r *http.Request) {
+	loginURL, _ := handler.config.Auth.LoginURL(r, "/")
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
 func (handler *Handler) logout(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-	logoutURL, _ := user.LogoutURL(c, "/")
+	logoutURL, _ := handler.config.Auth.LogoutURL(r, "/")
 	http.Redirect(w, r, logoutURL, http.StatusFound)
 }
 
@@ -83,18 +186,87 @@ type postItem struct {
 	Voted        bool   `json:"voted"`
 	HasDownvoted bool   `json:"downvoted"`
 	SincePost    string `json:"since"`
+	Anonymous    bool   `json:"anonymous"`
+	RealUser     string `json:"real_user"`
+	Community    string `json:"community"`
+	Removed      bool   `json:"removed"`
+	Pinned       bool   `json:"pinned"`
+	Hidden       bool   `json:"hidden"`
+	Edited       bool   `json:"edited"`
+	Deleted      bool   `json:"deleted"`
+	// Editable is set if the viewer wrote the post and may still edit it.
+	Editable bool `json:"editable"`
+	// Handle links to the author's profile, it is empty for anonymous posts.
+	Handle string `json:"handle"`
+	// HTML is the displayed text rendered by RenderText.
+	HTML template.HTML `json:"html"`
+}
+
+// template-internal comment representation
+type commentItem struct {
+	postItem
+	// Page is the post shown on the page the comment is rendered on.
+	Page       int64
+	ReplyColor string
+	More       bool
+	Replies    []commentItem
+	Thread     *threadState
+}
+
+// threadState is shared by all comments of a rendered thread.
+type threadState struct {
+	// Locked hides the reply forms and vote buttons.
+	Locked bool
+	// Moderate shows the moderation actions.
+	Moderate bool
 }
 
 func (handler *Handler) list(w http.ResponseWriter, r *http.Request, auth bool, user string) {
-	c := appengine.NewContext(r)
-	posts, ids, err := models.TopPosts(c, 30, -10)
+	handler.listing(w, r, user, nil)
+}
+
+// listing renders the top-level posts of a community, or of all communities if it is nil.
+func (handler *Handler) listing(w http.ResponseWriter, r *http.Request, user string, community *models.Community) {
+	c := handler.config.Context(r)
+	listing := models.Listing{
+		Limit:   handler.config.PageSize,
+		MinRank: -10,
+		Cursor:  r.URL.Query().Get("cursor"),
+	}
+	path := "/"
+	if community != nil {
+		listing.Community = community.Slug
+		path = "/c/" + community.Slug
+	}
+	ranking, err := models.ParseRanking(r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	listing.Ranking = ranking
+	posts, ids, next, err := handler.store.TopPosts(c, listing)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	votes, err := handler.votesBy(c, ids, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, user, handler.config.Moderators, posts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	karma, err := handler.karma(c, user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	items := make([]postItem, len(posts))
 	for i := range posts {
-		items[i] = handler.toPostItem(c, ids[i], posts[i], user)
+		items[i] = handler.toPostItem(ids[i], posts[i], user, votes, names)
 	}
 	if err := handler.listTmpl.Execute(w, struct {
 		Karma     int
@@ -102,48 +274,90 @@ func (handler *Handler) list(w http.ResponseWriter, r *http.Request, auth bool,
 		Posts     []postItem
 		Main      string
 		User      string
+		Sort      models.Ranking
+		Sorts     []models.Ranking
+		Next      string
+		Path      string
+		Community *models.Community
 	}{
-		Karma:     models.GetKarma(c, user),
+		Karma:     karma,
 		NextColor: colors[rand.Intn(len(colors))],
 		Posts:     items,
 		Main:      "",
 		User:      user,
+		Sort:      ranking,
+		Sorts:     models.Rankings(),
+		Next:      next,
+		Path:      path,
+		Community: community,
 	}); err != nil {
 		http.Error(w, "Failed to render template: "+err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func (handler *Handler) comments(w http.ResponseWriter, r *http.Request, auth bool, user string) {
-	c := appengine.NewContext(r)
+	c := handler.config.Context(r)
 	reqID := strings.TrimSpace(r.URL.Query().Get("id"))
 	id, err := strconv.ParseInt(reqID, 10, 64)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	post, err := models.GetPost(c, id)
+	post, err := handler.store.GetPost(c, id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	comments, ids, err := models.GetComments(c, id)
+	rootID := post.ThreadRoot(id)
+	root := post
+	if rootID != id {
+		if root, err = handler.store.GetPost(c, rootID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	comments, ids, err := handler.store.GetThread(c, rootID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	thread := models.BuildThread(id, post, comments, ids, models.DefaultThreadDepth)
+	votes, err := handler.votesBy(c, append(ids, id), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names, err := models.LoadNames(c, handler.store, user, handler.config.Moderators, append(comments, post))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	karma, err := handler.karma(c, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	moderate, err := models.CanModerate(c, handler.store, handler.config.Moderators, user, post)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	items := make([]postItem, len(comments))
-	for i := range comments {
-		items[i] = handler.toPostItem(c, ids[i], comments[i], user)
+	names.Pseudonyms = models.Pseudonyms(rootID, root, comments, ids)
+	state := &threadState{Locked: root.Locked, Moderate: moderate}
+	items := handler.toCommentItems(id, thread.Replies, user, votes, names, state)
+	main := commentItem{
+		postItem: handler.toPostItem(id, post, user, votes, names),
+		Page:     id,
+		Thread:   state,
 	}
-	main := handler.toPostItem(c, id, post, user)
 	if err := handler.showTmpl.Execute(w, struct {
 		Karma     int
 		NextColor string
-		Main      postItem
-		Comments  []postItem
+		Main      commentItem
+		Comments  []commentItem
 		User      string
 	}{
-		Karma:     models.GetKarma(c, user),
+		Karma:     karma,
 		NextColor: colors[rand.Intn(len(colors))],
 		Main:      main,
 		Comments:  items,
@@ -158,15 +372,24 @@ func (handler *Handler) post(w http.ResponseWriter, r *http.Request, auth bool,
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
-	c := appengine.NewContext(r)
+	c := handler.config.Context(r)
 	text := r.FormValue("text")
 	color := r.FormValue("color")
 	topic := r.FormValue("topic")
 	keep := r.FormValue("keep")
-	log.Debugf(c, "web.post: user=%s color=%s topic=%s keep=%s\n", user, color, topic, keep)
+	page := r.FormValue("page")
+	community := r.FormValue("community")
+	anonymous := r.FormValue("anonymous") != ""
 	redirectURL := "/"
+	if community != "" {
+		redirectURL = "/c/" + url.PathEscape(community)
+	}
 	if keep != "" {
-		redirectURL = "/comments?id=" + topic
+		if page != "" {
+			redirectURL = "/comments?id=" + page
+		} else {
+			redirectURL = "/comments?id=" + topic
+		}
 	}
 	if strings.TrimSpace(text) == "" {
 		http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
@@ -177,31 +400,29 @@ func (handler *Handler) post(w http.ResponseWriter, r *http.Request, auth bool,
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if _, err := models.SubmitPost(c, user, text, color, parent); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := handler.store.SubmitPost(c, user, text, color, community, parent, anonymous); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
 	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 }
 
 func (handler *Handler) vote(w http.ResponseWriter, r *http.Request, auth bool, user string) {
-	c := appengine.NewContext(r)
+	c := handler.config.Context(r)
 	if !auth {
-		log.Debugf(c, "web.vote: user not authorized")
+		log.Printf("web.vote: user not authorized")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 	upvote := r.FormValue("upvote")
-	downvote := r.FormValue("downvote")
 	post := r.FormValue("post")
 	keep := r.FormValue("keep")
 	topic := r.FormValue("topic")
 	id, err := strconv.ParseInt(post, 10, 64)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	log.Debugf(c, "web.vote: post=%s keep=%s topic=%s upvote=%s downvote%s\n", post, keep, topic, upvote, downvote)
 	redirectURL := "/"
 	if keep != "" {
 		if topic != "" {
@@ -211,24 +432,32 @@ func (handler *Handler) vote(w http.ResponseWriter, r *http.Request, auth bool,
 		}
 	}
 	state := upvote != ""
-	if _, err := models.SubmitVote(c, user, id, state); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if _, err := handler.store.SubmitVote(c, user, id, state); err != nil {
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
 	http.Redirect(w, r, redirectURL, http.StatusFound)
 }
 
+// authMiddleware resolves the login of the requesting user to their user ID.
 type authMiddleware struct {
 	handler  authHandleFunc
+	auth     Authenticator
+	store    models.UserStore
+	context  func(*http.Request) context.Context
 	required bool
 }
 
 func (auth authMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	c := appengine.NewContext(r)
-	if u := user.Current(c); u != nil {
-		auth.handler(w, r, true, u.Email)
+	if login := auth.auth.Current(r); login != "" {
+		user, err := auth.store.EnsureUser(auth.context(r), login)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auth.handler(w, r, true, user.ID)
 	} else if auth.required {
-		loginURL, _ := user.LoginURL(c, r.URL.String())
+		loginURL, _ := auth.auth.LoginURL(r, r.URL.String())
 		http.Redirect(w, r, loginURL, http.StatusFound)
 	} else {
 		auth.handler(w, r, false, "")
@@ -238,25 +467,87 @@ func (auth authMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (handler *Handler) auth(f authHandleFunc, require bool) *authMiddleware {
 	return &authMiddleware{
 		handler:  f,
+		auth:     handler.config.Auth,
+		store:    handler.store,
+		context:  handler.config.Context,
 		required: require,
 	}
 }
 
-func (handler *Handler) toPostItem(c context.Context, id int64, post models.Post, user string) postItem {
-	vote, err := models.GetVoteBy(c, id, user)
-	numVotes, _ := models.NumberOfVotes(c, id)
+// karma retrieves the karma of the user shown in the header, anonymous visitors have none.
+func (handler *Handler) karma(c context.Context, user string) (int, error) {
+	if user == "" {
+		return 0, nil
+	}
+	return handler.store.GetKarma(c, user)
+}
+
+// votesBy retrieves the votes of the user on a page of posts in a single batch.
+func (handler *Handler) votesBy(c context.Context, ids []int64, user string) (map[int64]models.Vote, error) {
+	if user == "" {
+		return nil, nil
+	}
+	return handler.store.GetVotesBy(c, ids, user)
+}
 
-	return postItem{
+func (handler *Handler) toPostItem(id int64, post models.Post, user string, votes map[int64]models.Vote, names models.Names) postItem {
+	vote, voted := votes[id]
+
+	item := postItem{
 		Post:         id,
-		User:         post.Author,
-		Text:         post.Text,
-		Votes:        numVotes,
+		User:         names.Author(id, post),
+		Text:         names.Text(post),
+		HTML:         RenderText(names.Text(post)),
+		Votes:        post.Score(),
 		Color:        post.Color,
 		Topic:        post.Parent,
 		OwnPost:      post.Author == user,
-		HasUpvoted:   err == nil && vote.Upvote,
-		HasDownvoted: err == nil && !vote.Upvote,
+		HasUpvoted:   voted && vote.Upvote,
+		HasDownvoted: voted && !vote.Upvote,
 		SincePost:    utils.HumanTimeFormat(post.Date),
-		Voted:        err == nil,
+		Voted:        voted,
+		Anonymous:    post.Anonymous,
+		RealUser:     names.RealAuthor(post),
+		Community:    post.Community,
+		Removed:      post.Removed,
+		Pinned:       post.Pinned,
+		Hidden:       post.Hidden,
+		Edited:       post.Revisions > 0,
+		Deleted:      post.Deleted,
+		Editable:     post.Editable(user, handler.config.EditWindow, time.Now()),
+	}
+	if !post.Anonymous && !names.Concealed(post) {
+		item.Handle = names.Users.Handle(post.Author)
+	}
+	return item
+}
+
+func (handler *Handler) toCommentItems(page int64, replies []*models.Thread, user string, votes map[int64]models.Vote, names models.Names, thread *threadState) []commentItem {
+	items := make([]commentItem, len(replies))
+	for i, reply := range replies {
+		items[i] = commentItem{
+			postItem:   handler.toPostItem(reply.ID, reply.Post, user, votes, names),
+			Page:       page,
+			ReplyColor: colors[rand.Intn(len(colors))],
+			More:       reply.More,
+			Replies:    handler.toCommentItems(page, reply.Replies, user, votes, names, thread),
+			Thread:     thread,
+		}
+	}
+	return items
+}
+
+// statusOf returns the HTTP status code reporting the error of a store operation.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvalidInput):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrAlreadyVoted), errors.Is(err, models.ErrLocked):
+		return http.StatusConflict
 	}
+	return http.StatusInternalServerError
 }
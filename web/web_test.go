@@ -0,0 +1,180 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/lnsp/zwig/models"
+	"github.com/lnsp/zwig/models/memory"
+)
+
+// loginHeader identifies the requesting user in the tests.
+const loginHeader = "X-Test-Login"
+
+// headerAuth trusts the login sent in loginHeader.
+type headerAuth struct{}
+
+func (headerAuth) Current(r *http.Request) string                         { return r.Header.Get(loginHeader) }
+func (headerAuth) LoginURL(r *http.Request, dest string) (string, error)  { return dest, nil }
+func (headerAuth) LogoutURL(r *http.Request, dest string) (string, error) { return dest, nil }
+
+// testWeb serves the web UI on a memory store for the tests.
+type testWeb struct {
+	t       *testing.T
+	store   *memory.Store
+	handler *Handler
+}
+
+func newTestWeb(t *testing.T, config Config) *testWeb {
+	store := memory.New()
+	config.TemplateDir = "../appengine/static/templates"
+	config.Auth = headerAuth{}
+	return &testWeb{t, store, New(store, config)}
+}
+
+// user creates a user with the given login and returns their ID.
+func (web *testWeb) user(login string) string {
+	user, err := web.store.EnsureUser(context.Background(), login)
+	if err != nil {
+		web.t.Fatal(err)
+	}
+	return user.ID
+}
+
+// post submits a post and returns its ID.
+func (web *testWeb) post(author string, parent int64) int64 {
+	id, err := web.store.SubmitPost(context.Background(), author, "text", "red", "", parent, false)
+	if err != nil {
+		web.t.Fatal(err)
+	}
+	return id
+}
+
+// do serves a request of the user with the login, the form is sent as body of POST requests.
+func (web *testWeb) do(method, path, login string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	if method == http.MethodPost {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if login != "" {
+		r.Header.Set(loginHeader, login)
+	}
+	w := httptest.NewRecorder()
+	web.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestModerateStatus(t *testing.T) {
+	web := newTestWeb(t, Config{Moderators: []string{"mod@example.com"}})
+	thread := web.post(web.user("author@example.com"), 0)
+	reply := web.post(web.user("author@example.com"), thread)
+	for _, test := range []struct {
+		login  string
+		action string
+		post   int64
+		want   int
+	}{
+		{"mod@example.com", "pin", thread, http.StatusFound},
+		{"mod@example.com", "pin", reply, http.StatusUnprocessableEntity},
+		{"mod@example.com", "explode", thread, http.StatusBadRequest},
+		{"mod@example.com", "pin", reply + 100, http.StatusNotFound},
+		{"author@example.com", "remove", thread, http.StatusForbidden},
+	} {
+		form := url.Values{"post": {strconv.FormatInt(test.post, 10)}, "action": {test.action}}
+		if w := web.do(http.MethodPost, "/moderate", test.login, form); w.Code != test.want {
+			t.Errorf("%s of post %d = %d %s, want %d", test.action, test.post, w.Code, w.Body, test.want)
+		}
+	}
+}
+
+func TestReportStatus(t *testing.T) {
+	web := newTestWeb(t, Config{})
+	id := web.post(web.user("author@example.com"), 0)
+	for _, test := range []struct {
+		post   int64
+		reason string
+		want   int
+	}{
+		{id, "spam", http.StatusFound},
+		{id, "", http.StatusBadRequest},
+		{id + 100, "spam", http.StatusNotFound},
+	} {
+		form := url.Values{"post": {strconv.FormatInt(test.post, 10)}, "reason": {test.reason}}
+		if w := web.do(http.MethodPost, "/report", "reader@example.com", form); w.Code != test.want {
+			t.Errorf("report of post %d for %q = %d %s, want %d", test.post, test.reason, w.Code, w.Body, test.want)
+		}
+	}
+}
+
+func TestListingCursor(t *testing.T) {
+	web := newTestWeb(t, Config{PageSize: 1})
+	author := web.user("author@example.com")
+	for i := 0; i < 2; i++ {
+		web.post(author, 0)
+	}
+	w := web.do(http.MethodGet, "/", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "cursor=") {
+		t.Fatalf("first page = %d, want 200 with a link to the next page", w.Code)
+	}
+	for _, test := range []struct {
+		cursor string
+		want   int
+	}{
+		{models.EncodeCursor(0, 1), http.StatusOK},
+		{"not-a-cursor", http.StatusUnprocessableEntity},
+		{"bm90IGEgY3Vyc29y", http.StatusUnprocessableEntity},
+	} {
+		if w := web.do(http.MethodGet, "/?cursor="+test.cursor, "", nil); w.Code != test.want {
+			t.Errorf("page at cursor %q = %d %s, want %d", test.cursor, w.Code, w.Body, test.want)
+		}
+	}
+	if w := web.do(http.MethodGet, "/?sort=random", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("page of an unknown ranking = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestModeratorPageCursors(t *testing.T) {
+	web := newTestWeb(t, Config{Moderators: []string{"mod@example.com"}})
+	for _, page := range []string{"/modlog", "/reports"} {
+		for _, test := range []struct {
+			cursor string
+			want   int
+		}{
+			{"", http.StatusOK},
+			{models.EncodeCursor(0, 1), http.StatusOK},
+			{"not-a-cursor", http.StatusUnprocessableEntity},
+		} {
+			if w := web.do(http.MethodGet, page+"?cursor="+test.cursor, "mod@example.com", nil); w.Code != test.want {
+				t.Errorf("%s at cursor %q = %d %s, want %d", page, test.cursor, w.Code, w.Body, test.want)
+			}
+		}
+	}
+}
+
+func TestProfileCursor(t *testing.T) {
+	web := newTestWeb(t, Config{})
+	id := web.user("author@example.com")
+	user, err := web.store.GetUser(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		path string
+		want int
+	}{
+		{"/u/" + user.Handle, http.StatusOK},
+		{"/u/" + user.Handle + "?kind=comments&cursor=" + models.EncodeCursor(0, 1), http.StatusOK},
+		{"/u/" + user.Handle + "?cursor=not-a-cursor", http.StatusUnprocessableEntity},
+		{"/u/nobody", http.StatusNotFound},
+	} {
+		if w := web.do(http.MethodGet, test.path, "", nil); w.Code != test.want {
+			t.Errorf("%s = %d %s, want %d", test.path, w.Code, w.Body, test.want)
+		}
+	}
+}